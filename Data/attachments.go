@@ -0,0 +1,50 @@
+package Data
+
+import (
+	"context"
+	"strings"
+)
+
+type sqlAttachments struct {
+	conn conn
+}
+
+func (s *sqlAttachments) ForPost(ctx context.Context, postID int) ([]string, error) {
+	images, err := s.ForPosts(ctx, []int{postID})
+	return images[postID], err
+}
+
+// ForPosts charge les images de plusieurs sujets en une seule requête
+func (s *sqlAttachments) ForPosts(ctx context.Context, postIDs []int) (map[int][]string, error) {
+	images := map[int][]string{}
+	if len(postIDs) == 0 {
+		return images, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(postIDs)), ", ")
+	rows, err := s.conn.query(ctx, "SELECT post_id, image FROM posts WHERE post_id IN ("+placeholders+") AND image IS NOT NULL ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var image string
+		if err := rows.Scan(&postID, &image); err != nil {
+			return nil, err
+		}
+		images[postID] = append(images[postID], image)
+	}
+	return images, rows.Err()
+}
+
+func (s *sqlAttachments) Add(ctx context.Context, post *Post, path string) error {
+	// title et content sont obligatoires dans posts : la ligne de l'image reprend ceux du sujet
+	_, err := s.conn.exec(ctx, "INSERT INTO posts (title, content, image, post_id) VALUES (?, ?, ?, ?)", post.Title, post.Content, path, post.ID)
+	return err
+}
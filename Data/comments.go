@@ -0,0 +1,68 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlComments struct {
+	conn conn
+}
+
+const commentColumns = "c.id, c.post_id, c.user_id, u.username, c.content, c.created_at"
+
+func (s *sqlComments) ForPost(ctx context.Context, postID, viewerID int) ([]Comment, error) {
+	return s.list(ctx, "SELECT "+commentColumns+" FROM comments c JOIN utilisateurs u ON c.user_id = u.id WHERE c.post_id = ? AND "+visibleAuthor+" ORDER BY c.id", postID, viewerID)
+}
+
+func (s *sqlComments) Page(ctx context.Context, postID, viewerID, afterID, limit int) ([]Comment, error) {
+	return s.list(ctx, "SELECT "+commentColumns+" FROM comments c JOIN utilisateurs u ON c.user_id = u.id WHERE c.post_id = ? AND "+visibleAuthor+" AND c.id > ? ORDER BY c.id LIMIT ?", postID, viewerID, afterID, limit)
+}
+
+func (s *sqlComments) Latest(ctx context.Context, postID, limit int) ([]Comment, error) {
+	return s.list(ctx, "SELECT "+commentColumns+" FROM comments c JOIN utilisateurs u ON c.user_id = u.id WHERE c.post_id = ? AND u.shadowbanned = FALSE ORDER BY c.id DESC LIMIT ?", postID, limit)
+}
+
+func (s *sqlComments) list(ctx context.Context, query string, args ...interface{}) ([]Comment, error) {
+	rows, err := s.conn.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, *c)
+	}
+	return comments, rows.Err()
+}
+
+func scanComment(row scanner) (*Comment, error) {
+	var c Comment
+	if err := row.Scan(&c.ID, &c.PostID, &c.UserID, &c.Username, &c.Content, &c.Created); err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (s *sqlComments) Get(ctx context.Context, id, viewerID int) (*Comment, error) {
+	return scanComment(s.conn.queryRow(ctx, "SELECT "+commentColumns+" FROM comments c JOIN utilisateurs u ON c.user_id = u.id WHERE c.id = ? AND "+visibleAuthor, id, viewerID))
+}
+
+func (s *sqlComments) Create(ctx context.Context, c *Comment) (int, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	id, err := s.conn.insert(ctx, "INSERT INTO comments (post_id, user_id, content, created_at) VALUES (?, ?, ?, ?)", c.PostID, c.UserID, c.Content, formatTimestamp(now))
+	if err == nil {
+		c.Created = sql.NullTime{Time: now, Valid: true}
+	}
+	return id, err
+}
+
+func (s *sqlComments) Update(ctx context.Context, id int, content string) error {
+	return s.conn.execOne(ctx, "UPDATE comments SET content = ? WHERE id = ?", content, id)
+}
@@ -0,0 +1,107 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// conn exécute les requêtes des dépôts, écrites avec des marqueurs ?, dans la syntaxe du
+// moteur de la base. Les booléens s'écrivent TRUE et FALSE, compris par les trois moteurs.
+type conn struct {
+	db     dbtx
+	driver string
+}
+
+// dbtx est satisfaite par *sql.DB et *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func newConn(db *sql.DB) conn {
+	return conn{db: db, driver: driverName(db)}
+}
+
+// rebind remplace les marqueurs ? par $1, $2… pour PostgreSQL
+func (c conn) rebind(query string) string {
+	if c.driver != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (c conn) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(ctx, c.rebind(query), args...)
+}
+
+func (c conn) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, c.rebind(query), args...)
+}
+
+func (c conn) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(ctx, c.rebind(query), args...)
+}
+
+// insert exécute un INSERT et retourne l'ID de la ligne créée. PostgreSQL ne connaît pas
+// LastInsertId : l'ID y est lu par RETURNING.
+func (c conn) insert(ctx context.Context, query string, args ...interface{}) (int, error) {
+	if c.driver == Postgres {
+		var id int
+		err := c.queryRow(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	result, err := c.exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// execOne exécute une mise à jour qui doit toucher une ligne, ErrNotFound sinon
+func (c conn) execOne(ctx context.Context, query string, args ...interface{}) error {
+	result, err := c.exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// inTx exécute fn dans une transaction, validée seulement si fn réussit. Dans une transaction
+// déjà ouverte, fn en fait simplement partie.
+func (c conn) inTx(ctx context.Context, fn func(tx conn) error) error {
+	db, ok := c.db.(*sql.DB)
+	if !ok {
+		return fn(c)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(conn{db: tx, driver: c.driver}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
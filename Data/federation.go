@@ -0,0 +1,143 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlFederation struct {
+	conn conn
+}
+
+func (s *sqlFederation) Key(ctx context.Context, userID int) (private, public string, err error) {
+	err = s.conn.queryRow(ctx, "SELECT private_key, public_key FROM ap_keys WHERE user_id = ?", userID).Scan(&private, &public)
+	return private, public, notFound(err)
+}
+
+func (s *sqlFederation) SaveKey(ctx context.Context, userID int, private, public string) error {
+	query := "INSERT INTO ap_keys (user_id, private_key, public_key) VALUES (?, ?, ?) "
+	if s.conn.driver == MySQL {
+		query += "ON DUPLICATE KEY UPDATE user_id = user_id"
+	} else {
+		query += "ON CONFLICT (user_id) DO NOTHING"
+	}
+	_, err := s.conn.exec(ctx, query, userID, private, public)
+	return err
+}
+
+func (s *sqlFederation) Followers(ctx context.Context, userID int) ([]Follower, error) {
+	rows, err := s.conn.query(ctx, "SELECT user_id, actor, inbox, created_at FROM ap_followers WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var followers []Follower
+	for rows.Next() {
+		var f Follower
+		if err := rows.Scan(&f.UserID, &f.Actor, &f.Inbox, &f.Created); err != nil {
+			return nil, err
+		}
+		followers = append(followers, f)
+	}
+	return followers, rows.Err()
+}
+
+func (s *sqlFederation) CountFollowers(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := s.conn.queryRow(ctx, "SELECT COUNT(*) FROM ap_followers WHERE user_id = ?", userID).Scan(&n)
+	return n, err
+}
+
+func (s *sqlFederation) AddFollower(ctx context.Context, f *Follower) error {
+	query := "INSERT INTO ap_followers (user_id, actor, inbox) VALUES (?, ?, ?) "
+	if s.conn.driver == MySQL {
+		query += "ON DUPLICATE KEY UPDATE inbox = VALUES(inbox)"
+	} else {
+		query += "ON CONFLICT (user_id, actor) DO UPDATE SET inbox = excluded.inbox"
+	}
+	_, err := s.conn.exec(ctx, query, f.UserID, f.Actor, f.Inbox)
+	return err
+}
+
+func (s *sqlFederation) RemoveFollower(ctx context.Context, userID int, actor string) error {
+	_, err := s.conn.exec(ctx, "DELETE FROM ap_followers WHERE user_id = ? AND actor = ?", userID, actor)
+	return err
+}
+
+func (s *sqlFederation) RemoteActor(ctx context.Context, actor string) (*RemoteActor, error) {
+	var a RemoteActor
+	err := s.conn.queryRow(ctx, "SELECT actor, username, inbox, key_id, public_key, fetched_at FROM ap_remote_actors WHERE actor = ?", actor).
+		Scan(&a.Actor, &a.Username, &a.Inbox, &a.KeyID, &a.PublicKey, &a.Fetched)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &a, nil
+}
+
+func (s *sqlFederation) SaveRemoteActor(ctx context.Context, a *RemoteActor) error {
+	query := "INSERT INTO ap_remote_actors (actor, username, inbox, key_id, public_key, fetched_at) VALUES (?, ?, ?, ?, ?, ?) "
+	if s.conn.driver == MySQL {
+		query += "ON DUPLICATE KEY UPDATE username = VALUES(username), inbox = VALUES(inbox), key_id = VALUES(key_id), public_key = VALUES(public_key), fetched_at = VALUES(fetched_at)"
+	} else {
+		query += "ON CONFLICT (actor) DO UPDATE SET username = excluded.username, inbox = excluded.inbox, key_id = excluded.key_id, public_key = excluded.public_key, fetched_at = excluded.fetched_at"
+	}
+	_, err := s.conn.exec(ctx, query, a.Actor, a.Username, a.Inbox, a.KeyID, a.PublicKey, formatTimestamp(a.Fetched))
+	return err
+}
+
+func (s *sqlFederation) RemoteAccount(ctx context.Context, actor string) (*User, error) {
+	return scanUser(s.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE remote_actor = ?", actor))
+}
+
+func (s *sqlFederation) CreateRemoteAccount(ctx context.Context, actor, username string) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO utilisateurs (email, username, password, remote_actor) VALUES ('', ?, '', ?)", username, actor)
+}
+
+func (s *sqlFederation) ObjectPost(ctx context.Context, objectID string) (int, error) {
+	var postID int
+	err := s.conn.queryRow(ctx, "SELECT post_id FROM comments WHERE ap_id = ?", objectID).Scan(&postID)
+	return postID, notFound(err)
+}
+
+func (s *sqlFederation) AddComment(ctx context.Context, c *Comment, objectID string) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO comments (post_id, user_id, content, created_at, ap_id) VALUES (?, ?, ?, ?, ?)",
+		c.PostID, c.UserID, c.Content, nullTimestamp(c.Created), objectID)
+}
+
+func (s *sqlFederation) Enqueue(ctx context.Context, userID int, inbox, activity string) error {
+	_, err := s.conn.exec(ctx, "INSERT INTO ap_deliveries (user_id, inbox, activity, status, next_attempt_at) VALUES (?, ?, ?, ?, ?)",
+		userID, inbox, activity, DeliveryPending, formatTimestamp(time.Now()))
+	return err
+}
+
+func (s *sqlFederation) Due(ctx context.Context, now time.Time, limit int) ([]ActivityDelivery, error) {
+	rows, err := s.conn.query(ctx, "SELECT id, user_id, inbox, activity, status, attempts, next_attempt_at, error, created_at FROM ap_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?",
+		DeliveryPending, formatTimestamp(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []ActivityDelivery
+	for rows.Next() {
+		var d ActivityDelivery
+		var errText sql.NullString
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Inbox, &d.Activity, &d.Status, &d.Attempts, &d.NextAttempt, &errText, &d.Created); err != nil {
+			return nil, err
+		}
+		d.Error = errText.String
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *sqlFederation) Record(ctx context.Context, d *ActivityDelivery) error {
+	var errText sql.NullString
+	if d.Error != "" {
+		errText = sql.NullString{String: d.Error, Valid: true}
+	}
+	return s.conn.execOne(ctx, "UPDATE ap_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, error = ? WHERE id = ?",
+		d.Status, d.Attempts, nullTimestamp(d.NextAttempt), errText, d.ID)
+}
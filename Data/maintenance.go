@@ -0,0 +1,141 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrSQLiteOnly est retournée par les opérations propres aux fichiers SQLite. Les bases
+// MySQL et PostgreSQL se sauvegardent avec les outils de leur moteur.
+var ErrSQLiteOnly = errors.New("opération réservée aux bases SQLite : utilisez mysqldump ou pg_dump")
+
+// BackupSQLite copie la base dans le fichier dest avec l'API de sauvegarde en ligne de SQLite :
+// la copie est cohérente même si le serveur écrit dans la base pendant ce temps.
+func BackupSQLite(ctx context.Context, db *sql.DB, dest string) error {
+	if driverName(db) != SQLite {
+		return ErrSQLiteOnly
+	}
+	destDB, err := sql.Open(SQLite, dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			backup, err := destRaw.(*sqlite3.SQLiteConn).Backup("main", srcRaw.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// IntegrityCheck retourne les problèmes relevés par PRAGMA integrity_check, aucun si la base est saine
+func IntegrityCheck(ctx context.Context, db *sql.DB) ([]string, error) {
+	if driverName(db) != SQLite {
+		return nil, ErrSQLiteOnly
+	}
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// Orphan est une ligne qui pointe vers un sujet ou un utilisateur disparu
+type Orphan struct {
+	Table  string
+	ID     int
+	Reason string
+}
+
+func (o Orphan) String() string {
+	return fmt.Sprintf("%s #%d : %s", o.Table, o.ID, o.Reason)
+}
+
+var orphanQueries = []struct {
+	table  string
+	reason string
+	query  string
+}{
+	{"comments", "sujet inexistant", "SELECT c.id FROM comments c LEFT JOIN posts p ON p.id = c.post_id WHERE p.id IS NULL"},
+	{"comments", "auteur inexistant", "SELECT c.id FROM comments c LEFT JOIN utilisateurs u ON u.id = c.user_id WHERE u.id IS NULL"},
+	{"posts", "auteur inexistant", "SELECT p.id FROM posts p LEFT JOIN utilisateurs u ON u.id = p.user_id WHERE p.user_id IS NOT NULL AND u.id IS NULL"},
+	{"posts", "image d'un sujet inexistant", "SELECT i.id FROM posts i LEFT JOIN posts p ON p.id = i.post_id WHERE i.post_id IS NOT NULL AND p.id IS NULL"},
+}
+
+// Orphans liste les lignes dont le sujet ou l'auteur n'existe plus
+func Orphans(ctx context.Context, db *sql.DB) ([]Orphan, error) {
+	var orphans []Orphan
+	for _, q := range orphanQueries {
+		rows, err := db.QueryContext(ctx, q.query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			o := Orphan{Table: q.table, Reason: q.reason}
+			if err := rows.Scan(&o.ID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			orphans = append(orphans, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return orphans, nil
+}
+
+// MediaPaths retourne les chemins des vidéos et images enregistrés en base
+func MediaPaths(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT video FROM posts WHERE video IS NOT NULL AND video <> '' UNION SELECT image FROM posts WHERE image IS NOT NULL AND image <> ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
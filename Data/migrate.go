@@ -0,0 +1,302 @@
+package Data
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Chaque migration est un couple de fichiers NNNN_nom.up.sql / NNNN_nom.down.sql, écrit
+// pour chaque moteur dans migrations/<pilote>. Toutes les séries gardent les mêmes versions.
+//
+//go:embed migrations/sqlite3/*.sql migrations/mysql/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus indique si une migration a été appliquée, et quand
+type MigrationStatus struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+// Migrations retourne les migrations embarquées pour le moteur driver, triées par version
+func Migrations(driver string) ([]Migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("nom de migration invalide : %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d nommée à la fois %s et %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s incomplète : il faut un fichier up et un fichier down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureSchemaVersion crée la table qui garde trace des migrations appliquées
+func ensureSchemaVersion(db *sql.DB) error {
+	// PostgreSQL ne connaît pas DATETIME, et TIMESTAMP a sous MySQL un comportement à part
+	timestamp := "DATETIME"
+	if driverName(db) == Postgres {
+		timestamp = "TIMESTAMP"
+	}
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS schema_version (
+        version INTEGER PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        applied_at ` + timestamp + ` NOT NULL
+    )`)
+	if err != nil {
+		return err
+	}
+	return adoptLegacySchema(db)
+}
+
+// Colonnes qui prouvent qu'une base créée avant schema_version a déjà reçu une migration :
+// l'ancien InitDB créait les tables et ajoutait ces colonnes au démarrage, sous SQLite seulement.
+var legacyMarkers = []struct {
+	version int
+	table   string
+	column  string
+}{
+	{1, "utilisateurs", "id"},
+	{2, "utilisateurs", "shadowbanned"},
+	{3, "posts", "last_activity_at"},
+}
+
+// adoptLegacySchema enregistre dans schema_version les migrations déjà présentes dans une
+// base antérieure aux migrations, pour ne pas les rejouer
+func adoptLegacySchema(db *sql.DB) error {
+	var count int
+	if driverName(db) != SQLite {
+		return nil
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		return err
+	}
+
+	for _, marker := range legacyMarkers {
+		var found int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", marker.table, marker.column).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if found == 0 {
+			return nil
+		}
+		for _, m := range migrations {
+			if m.Version == marker.version {
+				if _, err := db.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaVersion retourne la version de la dernière migration appliquée, 0 pour une base vide
+func SchemaVersion(db *sql.DB) (int, error) {
+	if err := ensureSchemaVersion(db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// LatestVersion retourne la version de la migration la plus récente pour le moteur de db
+func LatestVersion(db *sql.DB) (int, error) {
+	migrations, err := Migrations(driverName(db))
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Migrate applique toutes les migrations en attente
+func Migrate(db *sql.DB) error {
+	latest, err := LatestVersion(db)
+	if err != nil {
+		return err
+	}
+	return MigrateTo(db, latest)
+}
+
+// MigrateTo amène le schéma à la version target, en appliquant les migrations up
+// ou en annulant les migrations down nécessaires
+func MigrateTo(db *sql.DB, target int) error {
+	migrations, err := Migrations(driverName(db))
+	if err != nil {
+		return err
+	}
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if target >= current {
+		for _, m := range migrations {
+			if m.Version > current && m.Version <= target {
+				if err := applyMigration(db, m, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= current && m.Version > target {
+			if err := applyMigration(db, m, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rollback annule les n dernières migrations appliquées
+func Rollback(db *sql.DB, n int) error {
+	rows, err := db.Query(newConn(db).rebind("SELECT version FROM schema_version ORDER BY version DESC LIMIT ?"), n+1)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	target := 0
+	if len(versions) > n {
+		target = versions[n]
+	}
+	return MigrateTo(db, target)
+}
+
+// applyMigration exécute une migration et met à jour schema_version dans la même transaction.
+// PostgreSQL et SQLite annulent toute la migration en cas d'échec, mais MySQL valide
+// implicitement chaque instruction DDL : une migration qui échoue à mi-chemin
+// y laisse les instructions déjà exécutées, à annuler à la main.
+func applyMigration(db *sql.DB, m Migration, up bool) error {
+	c := newConn(db)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return fmt.Errorf("migration %04d_%s : %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(c.rebind("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)"), m.Version, m.Name, time.Now().UTC()); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return fmt.Errorf("annulation de la migration %04d_%s : %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(c.rebind("DELETE FROM schema_version WHERE version = ?"), m.Version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Status retourne toutes les migrations connues avec leur date d'application
+func Status(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(driverName(db))
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureSchemaVersion(db); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	rows, err := db.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			statuses[i].AppliedAt = sql.NullTime{Time: at, Valid: true}
+		}
+	}
+	return statuses, nil
+}
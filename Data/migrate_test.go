@@ -0,0 +1,186 @@
+package Data
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openSQLite ouvre une base SQLite vide dans un répertoire temporaire du test
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(SQLite, filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// assertApplied vérifie que Status marque appliquées exactement les migrations jusqu'à version
+func assertApplied(t *testing.T, db *sql.DB, version int) {
+	t.Helper()
+	statuses, err := Status(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("aucune migration embarquée")
+	}
+	for _, s := range statuses {
+		if want := s.Version <= version; s.AppliedAt.Valid != want {
+			t.Errorf("migration %04d_%s : appliquée = %v, attendu %v", s.Version, s.Name, s.AppliedAt.Valid, want)
+		}
+	}
+	current, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != version {
+		t.Errorf("SchemaVersion = %d, attendu %d", current, version)
+	}
+}
+
+// tableExists indique si la table existe dans la base SQLite
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	db := openSQLite(t)
+	latest, err := LatestVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, db, 0)
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, db, latest)
+	if !tableExists(t, db, "utilisateurs") {
+		t.Error("table utilisateurs absente après Migrate")
+	}
+
+	if err := MigrateTo(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, db, 0)
+	// Les migrations down ne laissent que schema_version
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%' AND name != 'schema_version'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		t.Errorf("%s toujours présent après MigrateTo(0)", name)
+	}
+	rows.Close()
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, db, latest)
+
+	// Une base à jour ne rejoue rien
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, db, latest)
+}
+
+func TestMigrateStepByStep(t *testing.T) {
+	db := openSQLite(t)
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if err := MigrateTo(db, m.Version); err != nil {
+			t.Fatal(err)
+		}
+		assertApplied(t, db, m.Version)
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if err := Rollback(db, 1); err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if i > 0 {
+			want = migrations[i-1].Version
+		}
+		assertApplied(t, db, want)
+	}
+}
+
+func TestMigrationsMatchAcrossEngines(t *testing.T) {
+	reference, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, driver := range []string{MySQL, Postgres} {
+		migrations, err := Migrations(driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != len(reference) {
+			t.Fatalf("%s : %d migrations, %d pour SQLite", driver, len(migrations), len(reference))
+		}
+		for i, m := range migrations {
+			if m.Version != reference[i].Version || m.Name != reference[i].Name {
+				t.Errorf("%s : migration %04d_%s, %04d_%s pour SQLite", driver, m.Version, m.Name, reference[i].Version, reference[i].Name)
+			}
+		}
+	}
+}
+
+// TestAdoptLegacySchema part d'une base créée par l'ancien InitDB, sans schema_version
+func TestAdoptLegacySchema(t *testing.T) {
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		applied int // migrations déjà présentes dans la base
+	}{
+		{"schéma initial", 1},
+		{"avec les sanctions", 2},
+		{"avec l'état des sujets", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openSQLite(t)
+			for _, m := range migrations[:tt.applied] {
+				if _, err := db.Exec(m.Up); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := db.Exec("INSERT INTO utilisateurs (email, username, password) VALUES ('ancien@example.com', 'ancien', 'secret')"); err != nil {
+				t.Fatal(err)
+			}
+
+			assertApplied(t, db, migrations[tt.applied-1].Version)
+			if err := Migrate(db); err != nil {
+				t.Fatal(err)
+			}
+			assertApplied(t, db, migrations[len(migrations)-1].Version)
+
+			var username, role string
+			if err := db.QueryRow("SELECT username, role FROM utilisateurs WHERE email = 'ancien@example.com'").Scan(&username, &role); err != nil {
+				t.Fatal(err)
+			}
+			if username != "ancien" || role != "user" {
+				t.Errorf("compte existant = %q, rôle %q", username, role)
+			}
+		})
+	}
+}
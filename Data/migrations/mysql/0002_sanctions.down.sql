@@ -0,0 +1,5 @@
+ALTER TABLE utilisateurs
+    DROP COLUMN shadowbanned,
+    DROP COLUMN suspended_until,
+    DROP COLUMN banned,
+    DROP COLUMN role;
@@ -0,0 +1,5 @@
+ALTER TABLE utilisateurs
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+    ADD COLUMN banned TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN suspended_until DATETIME NULL,
+    ADD COLUMN shadowbanned TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE posts
+    DROP COLUMN last_activity_at,
+    DROP COLUMN archived,
+    DROP COLUMN locked,
+    DROP COLUMN pinned;
@@ -0,0 +1,5 @@
+ALTER TABLE posts
+    ADD COLUMN pinned TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN locked TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN archived TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN last_activity_at DATETIME NULL;
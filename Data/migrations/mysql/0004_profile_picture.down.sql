@@ -0,0 +1 @@
+ALTER TABLE utilisateurs DROP COLUMN profile_picture;
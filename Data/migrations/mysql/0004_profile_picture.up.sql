@@ -0,0 +1,2 @@
+-- Lue par la page d'accueil pour afficher la photo de l'utilisateur connecté
+ALTER TABLE utilisateurs ADD COLUMN profile_picture VARCHAR(255) NULL;
@@ -0,0 +1 @@
+DROP INDEX posts_search ON posts;
@@ -0,0 +1,2 @@
+-- Recherche plein texte par MATCH … AGAINST
+CREATE FULLTEXT INDEX posts_search ON posts (title, content);
@@ -0,0 +1,9 @@
+-- Sujets et commentaires créés par un import, sous leur ID d'origine : réimporter la même
+-- archive ne les duplique pas
+CREATE TABLE imported_rows (
+    source VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    original_id INT NOT NULL,
+    local_id INT NOT NULL,
+    PRIMARY KEY (source, kind, original_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
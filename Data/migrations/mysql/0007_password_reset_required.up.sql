@@ -0,0 +1,2 @@
+-- Comptes importés d'un autre forum, sans mot de passe utilisable
+ALTER TABLE utilisateurs ADD COLUMN must_reset_password TINYINT(1) NOT NULL DEFAULT 0;
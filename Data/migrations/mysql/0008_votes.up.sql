@@ -0,0 +1,9 @@
+-- Un vote par utilisateur et par sujet : 1 pour, -1 contre
+CREATE TABLE votes (
+    user_id INT NOT NULL,
+    post_id INT NOT NULL,
+    value TINYINT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id),
+    INDEX votes_post (post_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
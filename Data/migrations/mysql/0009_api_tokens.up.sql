@@ -0,0 +1,13 @@
+-- Jetons d'accès personnels à l'API : seule l'empreinte SHA-256 du secret est conservée
+CREATE TABLE api_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(255) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    last_used_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    INDEX api_tokens_user (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,26 @@
+-- Webhooks déclarés par les administrateurs ; events liste les événements séparés par des espaces
+CREATE TABLE webhooks (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Journal des livraisons, rejouées jusqu'au succès ou à l'abandon
+CREATE TABLE webhook_deliveries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    webhook_id INT NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload MEDIUMTEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NULL,
+    status_code INT NULL,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    delivered_at DATETIME NULL,
+    INDEX webhook_deliveries_due (status, next_attempt_at),
+    INDEX webhook_deliveries_webhook (webhook_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,10 @@
+-- Signalements d'un sujet, ou d'un de ses commentaires lorsque comment_id est renseigné
+CREATE TABLE reports (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    post_id INT NOT NULL,
+    comment_id INT NULL,
+    reason TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX reports_post (post_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+-- Date des commentaires, inconnue pour ceux écrits avant cette migration
+ALTER TABLE comments ADD COLUMN created_at DATETIME NULL;
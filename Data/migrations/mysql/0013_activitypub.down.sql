@@ -0,0 +1,6 @@
+DROP TABLE ap_deliveries;
+DROP TABLE ap_remote_actors;
+DROP TABLE ap_followers;
+DROP TABLE ap_keys;
+ALTER TABLE comments DROP INDEX comments_ap_id, DROP COLUMN ap_id;
+ALTER TABLE utilisateurs DROP INDEX utilisateurs_remote_actor, DROP COLUMN remote_actor;
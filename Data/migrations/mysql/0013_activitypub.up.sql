@@ -0,0 +1,44 @@
+-- Fédération ActivityPub : comptes et commentaires venus d'autres serveurs
+ALTER TABLE utilisateurs ADD COLUMN remote_actor VARCHAR(512) NULL, ADD UNIQUE INDEX utilisateurs_remote_actor (remote_actor);
+ALTER TABLE comments ADD COLUMN ap_id VARCHAR(512) NULL, ADD UNIQUE INDEX comments_ap_id (ap_id);
+
+-- Paires de clés RSA des acteurs locaux, qui signent les requêtes sortantes
+CREATE TABLE ap_keys (
+    user_id INT PRIMARY KEY,
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Acteurs distants abonnés aux acteurs locaux
+CREATE TABLE ap_followers (
+    user_id INT NOT NULL,
+    actor VARCHAR(512) NOT NULL,
+    inbox VARCHAR(512) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, actor)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Acteurs distants déjà récupérés, avec la clé publique qui vérifie leurs signatures
+CREATE TABLE ap_remote_actors (
+    actor VARCHAR(512) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    inbox VARCHAR(512) NOT NULL,
+    key_id VARCHAR(512) NOT NULL,
+    public_key TEXT NOT NULL,
+    fetched_at DATETIME NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Activités à livrer aux boîtes de réception distantes
+CREATE TABLE ap_deliveries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    inbox VARCHAR(512) NOT NULL,
+    activity MEDIUMTEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NULL,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX ap_deliveries_due (status, next_attempt_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- Demandes de réinitialisation du mot de passe : seule l'empreinte SHA-256 du jeton envoyé
+-- par email est conservée, et chaque jeton ne sert qu'une fois
+CREATE TABLE password_resets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    INDEX password_resets_user (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
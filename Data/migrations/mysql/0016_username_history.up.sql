@@ -0,0 +1,7 @@
+-- Anciens noms d'utilisateur, pour rediriger les liens vers le profil après un changement de nom
+CREATE TABLE username_history (
+    old_username VARCHAR(255) NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL,
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX username_history_user (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
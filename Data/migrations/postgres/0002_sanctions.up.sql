@@ -0,0 +1,5 @@
+ALTER TABLE utilisateurs
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user',
+    ADD COLUMN banned BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN suspended_until TIMESTAMP,
+    ADD COLUMN shadowbanned BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+ALTER TABLE posts
+    ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN last_activity_at TIMESTAMP;
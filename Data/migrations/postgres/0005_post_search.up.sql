@@ -0,0 +1,4 @@
+-- Recherche plein texte : le vecteur est recalculé par PostgreSQL à chaque écriture
+ALTER TABLE posts ADD COLUMN search tsvector
+    GENERATED ALWAYS AS (to_tsvector('french', title || ' ' || content)) STORED;
+CREATE INDEX posts_search ON posts USING GIN (search);
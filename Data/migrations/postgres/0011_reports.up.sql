@@ -0,0 +1,10 @@
+-- Signalements d'un sujet, ou d'un de ses commentaires lorsque comment_id est renseigné
+CREATE TABLE reports (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX reports_post ON reports (post_id);
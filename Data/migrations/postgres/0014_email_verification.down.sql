@@ -0,0 +1 @@
+ALTER TABLE utilisateurs DROP COLUMN email_verified;
@@ -0,0 +1,11 @@
+-- Demandes de réinitialisation du mot de passe : seule l'empreinte SHA-256 du jeton envoyé
+-- par email est conservée, et chaque jeton ne sert qu'une fois
+CREATE TABLE password_resets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+CREATE INDEX password_resets_user ON password_resets (user_id);
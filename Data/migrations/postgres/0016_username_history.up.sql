@@ -0,0 +1,7 @@
+-- Anciens noms d'utilisateur, pour rediriger les liens vers le profil après un changement de nom
+CREATE TABLE username_history (
+    old_username TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX username_history_user ON username_history (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE utilisateurs DROP COLUMN shadowbanned;
+ALTER TABLE utilisateurs DROP COLUMN suspended_until;
+ALTER TABLE utilisateurs DROP COLUMN banned;
+ALTER TABLE utilisateurs DROP COLUMN role;
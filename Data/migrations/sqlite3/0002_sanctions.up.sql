@@ -0,0 +1,4 @@
+ALTER TABLE utilisateurs ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE utilisateurs ADD COLUMN banned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE utilisateurs ADD COLUMN suspended_until TIMESTAMP;
+ALTER TABLE utilisateurs ADD COLUMN shadowbanned INTEGER NOT NULL DEFAULT 0;
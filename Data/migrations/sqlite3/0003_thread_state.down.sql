@@ -0,0 +1,4 @@
+ALTER TABLE posts DROP COLUMN last_activity_at;
+ALTER TABLE posts DROP COLUMN archived;
+ALTER TABLE posts DROP COLUMN locked;
+ALTER TABLE posts DROP COLUMN pinned;
@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN locked INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN last_activity_at TIMESTAMP;
@@ -0,0 +1,3 @@
+-- SQLite n'a pas d'index plein texte sans FTS5, absent du pilote par défaut :
+-- la recherche y parcourt les titres et contenus par LIKE
+SELECT 1;
@@ -0,0 +1,9 @@
+-- Sujets et commentaires créés par un import, sous leur ID d'origine : réimporter la même
+-- archive ne les duplique pas
+CREATE TABLE imported_rows (
+    source TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    original_id INTEGER NOT NULL,
+    local_id INTEGER NOT NULL,
+    PRIMARY KEY (source, kind, original_id)
+);
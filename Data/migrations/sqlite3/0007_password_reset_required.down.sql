@@ -0,0 +1 @@
+ALTER TABLE utilisateurs DROP COLUMN must_reset_password;
@@ -0,0 +1,9 @@
+-- Un vote par utilisateur et par sujet : 1 pour, -1 contre
+CREATE TABLE votes (
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    value INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+CREATE INDEX votes_post ON votes (post_id);
@@ -0,0 +1,8 @@
+DROP TABLE ap_deliveries;
+DROP TABLE ap_remote_actors;
+DROP TABLE ap_followers;
+DROP TABLE ap_keys;
+DROP INDEX comments_ap_id;
+ALTER TABLE comments DROP COLUMN ap_id;
+DROP INDEX utilisateurs_remote_actor;
+ALTER TABLE utilisateurs DROP COLUMN remote_actor;
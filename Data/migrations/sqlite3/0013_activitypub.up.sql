@@ -0,0 +1,46 @@
+-- Fédération ActivityPub : comptes et commentaires venus d'autres serveurs
+ALTER TABLE utilisateurs ADD COLUMN remote_actor TEXT;
+CREATE UNIQUE INDEX utilisateurs_remote_actor ON utilisateurs (remote_actor);
+ALTER TABLE comments ADD COLUMN ap_id TEXT;
+CREATE UNIQUE INDEX comments_ap_id ON comments (ap_id);
+
+-- Paires de clés RSA des acteurs locaux, qui signent les requêtes sortantes
+CREATE TABLE ap_keys (
+    user_id INTEGER PRIMARY KEY,
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Acteurs distants abonnés aux acteurs locaux
+CREATE TABLE ap_followers (
+    user_id INTEGER NOT NULL,
+    actor TEXT NOT NULL,
+    inbox TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, actor)
+);
+
+-- Acteurs distants déjà récupérés, avec la clé publique qui vérifie leurs signatures
+CREATE TABLE ap_remote_actors (
+    actor TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    inbox TEXT NOT NULL,
+    key_id TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    fetched_at TIMESTAMP NOT NULL
+);
+
+-- Activités à livrer aux boîtes de réception distantes
+CREATE TABLE ap_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    inbox TEXT NOT NULL,
+    activity TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX ap_deliveries_due ON ap_deliveries (status, next_attempt_at);
@@ -0,0 +1,4 @@
+-- Adresse email confirmée par le lien envoyé à l'inscription ; les comptes existants
+-- sont antérieurs à la confirmation et la gardent acquise
+ALTER TABLE utilisateurs ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+UPDATE utilisateurs SET email_verified = TRUE;
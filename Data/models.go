@@ -0,0 +1,216 @@
+package Data
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type User struct {
+	ID             int
+	Email          string
+	Username       string
+	Password       string
+	Profile        string
+	ProfilePicture string
+	Role           string
+	Banned         bool
+	SuspendedUntil sql.NullTime
+	Shadowbanned   bool
+	// Compte importé sans mot de passe utilisable, à réinitialiser avant toute connexion
+	MustResetPassword bool
+	// Acteur ActivityPub d'un autre serveur que ce compte représente, vide pour un compte local
+	RemoteActor string
+	// Adresse confirmée par le lien envoyé à l'inscription : sans elle, le compte ne peut pas publier
+	EmailVerified bool
+}
+
+// IsSuspended indique si l'utilisateur est sous le coup d'une suspension temporaire
+func (u *User) IsSuspended() bool {
+	return u.SuspendedUntil.Valid && time.Now().Before(u.SuspendedUntil.Time)
+}
+
+// IsRemote indique si le compte représente l'acteur d'un autre serveur
+func (u *User) IsRemote() bool {
+	return u.RemoteActor != ""
+}
+
+// IsModerator indique si l'utilisateur peut appliquer des sanctions
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+type Comment struct {
+	ID       int
+	PostID   int
+	UserID   int
+	Username string
+	Content  string
+	// Inconnue pour les commentaires antérieurs à la migration 0010
+	Created sql.NullTime
+}
+
+// APIToken est un jeton d'accès personnel à l'API. Seule l'empreinte du secret est conservée.
+type APIToken struct {
+	ID        int
+	UserID    int
+	Name      string
+	Hash      string
+	Scopes    []string
+	Created   time.Time
+	ExpiresAt time.Time
+	LastUsed  sql.NullTime
+	Revoked   sql.NullTime
+}
+
+// PasswordReset est une demande de réinitialisation du mot de passe, envoyée par email.
+// Seule l'empreinte du jeton est conservée.
+type PasswordReset struct {
+	ID        int
+	UserID    int
+	Hash      string
+	Created   time.Time
+	ExpiresAt time.Time
+	Used      sql.NullTime
+}
+
+// Valid indique si le jeton peut encore servir à la date now
+func (r *PasswordReset) Valid(now time.Time) bool {
+	return !r.Used.Valid && now.Before(r.ExpiresAt)
+}
+
+// Active indique si le jeton peut encore servir à la date now
+func (t *APIToken) Active(now time.Time) bool {
+	return !t.Revoked.Valid && now.Before(t.ExpiresAt)
+}
+
+// HasScope indique si le jeton a reçu la portée scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook reçoit en POST les événements auxquels il est abonné, signés avec Secret
+type Webhook struct {
+	ID      int
+	URL     string
+	Secret  string
+	Events  []string
+	Active  bool
+	Created time.Time
+}
+
+// Subscribed indique si le webhook est abonné à l'événement
+func (h *Webhook) Subscribed(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// États d'une livraison de webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery est l'envoi d'un événement à un webhook, avec le résultat de sa dernière tentative
+type WebhookDelivery struct {
+	ID          int
+	WebhookID   int
+	Event       string
+	Payload     string
+	Status      string
+	Attempts    int
+	NextAttempt sql.NullTime
+	StatusCode  sql.NullInt64
+	Error       string
+	Created     time.Time
+	Delivered   sql.NullTime
+}
+
+// Report est le signalement d'un sujet par un membre, ou d'un de ses commentaires si
+// CommentID n'est pas nul
+type Report struct {
+	ID        int
+	UserID    int
+	PostID    int
+	CommentID int
+	Reason    string
+	Created   time.Time
+}
+
+// PostFilter restreint les sujets retournés par Posts.Latest ; un champ vide ne filtre rien
+type PostFilter struct {
+	AuthorID int
+	// Début du titre, comme le « [Catégorie] » ajouté par les imports d'autres forums
+	TitlePrefix string
+}
+
+// Follower est un acteur distant abonné à un utilisateur local
+type Follower struct {
+	UserID  int
+	Actor   string
+	Inbox   string
+	Created time.Time
+}
+
+// RemoteActor est un acteur ActivityPub d'un autre serveur, gardé en cache avec sa clé publique
+type RemoteActor struct {
+	Actor     string
+	Username  string
+	Inbox     string
+	KeyID     string
+	PublicKey string
+	Fetched   time.Time
+}
+
+// ActivityDelivery est une activité à livrer à une boîte de réception distante, signée par UserID
+type ActivityDelivery struct {
+	ID          int
+	UserID      int
+	Inbox       string
+	Activity    string
+	Status      string
+	Attempts    int
+	NextAttempt sql.NullTime
+	Error       string
+	Created     time.Time
+}
+
+type Vote struct {
+	UserID  int
+	PostID  int
+	Value   int
+	Created time.Time
+}
+
+type Post struct {
+	ID       int
+	Title    string
+	Content  string
+	Video    string
+	Image    []string
+	UserID   int
+	Username string
+	Pinned   bool
+	Locked   bool
+	Archived bool
+	Created  time.Time
+	// Somme des votes : +1 pour chaque vote pour, -1 pour chaque vote contre
+	Score int
+	// Dernier commentaire, ou rien si le sujet n'en a pas reçu depuis sa création
+	LastActivity sql.NullTime
+	Comments     []Comment
+}
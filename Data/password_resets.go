@@ -0,0 +1,34 @@
+package Data
+
+import (
+	"context"
+	"time"
+)
+
+type sqlPasswordResets struct {
+	conn conn
+}
+
+func (s *sqlPasswordResets) Create(ctx context.Context, r *PasswordReset) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		r.UserID, r.Hash, formatTimestamp(r.ExpiresAt))
+}
+
+func (s *sqlPasswordResets) ByHash(ctx context.Context, hash string) (*PasswordReset, error) {
+	var r PasswordReset
+	err := s.conn.queryRow(ctx, "SELECT id, user_id, token_hash, created_at, expires_at, used_at FROM password_resets WHERE token_hash = ?", hash).
+		Scan(&r.ID, &r.UserID, &r.Hash, &r.Created, &r.ExpiresAt, &r.Used)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &r, nil
+}
+
+func (s *sqlPasswordResets) Use(ctx context.Context, id int, at time.Time) error {
+	return s.conn.execOne(ctx, "UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL", formatTimestamp(at), id)
+}
+
+func (s *sqlPasswordResets) Discard(ctx context.Context, userID int, at time.Time) error {
+	_, err := s.conn.exec(ctx, "UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", formatTimestamp(at), userID)
+	return err
+}
@@ -0,0 +1,191 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type sqlPosts struct {
+	conn        conn
+	attachments *sqlAttachments
+}
+
+// Les images sont des lignes de posts sans auteur : la jointure sur utilisateurs les écarte
+const postColumns = "p.id, p.title, p.content, p.video, p.user_id, u.username, p.pinned, p.locked, p.archived, p.created_at, p.last_activity_at, " +
+	"COALESCE((SELECT SUM(v.value) FROM votes v WHERE v.post_id = p.id), 0)"
+
+// Format des dates écrites par CURRENT_TIMESTAMP, en UTC. Les dates passées en paramètre le
+// reprennent pour rester comparables aux dates en base, que SQLite compare comme du texte.
+const timestampLayout = "2006-01-02 15:04:05"
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+func nullTimestamp(t sql.NullTime) interface{} {
+	if !t.Valid {
+		return nil
+	}
+	return formatTimestamp(t.Time)
+}
+
+func scanPost(row scanner) (*Post, error) {
+	var p Post
+	var video sql.NullString
+	err := row.Scan(&p.ID, &p.Title, &p.Content, &video, &p.UserID, &p.Username, &p.Pinned, &p.Locked, &p.Archived, &p.Created, &p.LastActivity, &p.Score)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	p.Video = video.String
+	return &p, nil
+}
+
+func (s *sqlPosts) List(ctx context.Context, viewerID, limit int) ([]Post, error) {
+	query := "SELECT " + postColumns + " FROM posts p JOIN utilisateurs u ON p.user_id = u.id WHERE " + visibleAuthor + " ORDER BY p.pinned DESC, p.created_at DESC"
+	args := []interface{}{viewerID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	return s.list(ctx, query, args...)
+}
+
+// Search s'appuie sur l'index plein texte de chaque moteur : tsvector sous PostgreSQL,
+// FULLTEXT sous MySQL. SQLite, sans index, se contente d'un LIKE trié par date.
+func (s *sqlPosts) Search(ctx context.Context, text string, viewerID, limit int) ([]Post, error) {
+	from := " FROM posts p JOIN utilisateurs u ON p.user_id = u.id WHERE " + visibleAuthor
+	var query string
+	var args []interface{}
+	switch s.conn.driver {
+	case Postgres:
+		query = "SELECT " + postColumns + from + " AND p.search @@ websearch_to_tsquery('french', ?) ORDER BY ts_rank(p.search, websearch_to_tsquery('french', ?)) DESC, p.created_at DESC"
+		args = []interface{}{viewerID, text, text}
+	case MySQL:
+		query = "SELECT " + postColumns + from + " AND MATCH (p.title, p.content) AGAINST (?) ORDER BY MATCH (p.title, p.content) AGAINST (?) DESC, p.created_at DESC"
+		args = []interface{}{viewerID, text, text}
+	default:
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+		query = "SELECT " + postColumns + from + ` AND (p.title LIKE ? ESCAPE '\' OR p.content LIKE ? ESCAPE '\') ORDER BY p.created_at DESC`
+		args = []interface{}{viewerID, pattern, pattern}
+	}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	return s.list(ctx, query, args...)
+}
+
+// list exécute une requête sur postColumns et complète les sujets avec leurs images
+func (s *sqlPosts) list(ctx context.Context, query string, args ...interface{}) ([]Post, error) {
+	rows, err := s.conn.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	var ids []int
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *p)
+		ids = append(ids, p.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	images, err := s.attachments.ForPosts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Image = images[posts[i].ID]
+	}
+	return posts, nil
+}
+
+func (s *sqlPosts) Get(ctx context.Context, id, viewerID int) (*Post, error) {
+	row := s.conn.queryRow(ctx, "SELECT "+postColumns+" FROM posts p JOIN utilisateurs u ON p.user_id = u.id WHERE p.id = ? AND "+visibleAuthor, id, viewerID)
+	p, err := scanPost(row)
+	if err != nil {
+		return nil, err
+	}
+	if p.Image, err = s.attachments.ForPost(ctx, p.ID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *sqlPosts) State(ctx context.Context, id int) (locked, archived bool, err error) {
+	err = s.conn.queryRow(ctx, "SELECT locked, archived FROM posts WHERE id = ? AND user_id IS NOT NULL", id).Scan(&locked, &archived)
+	return locked, archived, notFound(err)
+}
+
+func (s *sqlPosts) Page(ctx context.Context, viewerID, beforeID, limit int) ([]Post, error) {
+	query := "SELECT " + postColumns + " FROM posts p JOIN utilisateurs u ON p.user_id = u.id WHERE " + visibleAuthor
+	args := []interface{}{viewerID}
+	if beforeID > 0 {
+		query += " AND p.id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY p.id DESC LIMIT ?"
+	return s.list(ctx, query, append(args, limit)...)
+}
+
+func (s *sqlPosts) Latest(ctx context.Context, filter PostFilter, limit int) ([]Post, error) {
+	query := "SELECT " + postColumns + " FROM posts p JOIN utilisateurs u ON p.user_id = u.id WHERE u.shadowbanned = FALSE"
+	var args []interface{}
+	if filter.AuthorID > 0 {
+		query += " AND p.user_id = ?"
+		args = append(args, filter.AuthorID)
+	}
+	if filter.TitlePrefix != "" {
+		// SUBSTR compte en caractères sur les trois moteurs, et évite d'échapper un motif LIKE
+		query += " AND SUBSTR(p.title, 1, ?) = ?"
+		args = append(args, utf8.RuneCountInString(filter.TitlePrefix), filter.TitlePrefix)
+	}
+	query += " ORDER BY p.created_at DESC, p.id DESC LIMIT ?"
+	return s.list(ctx, query, append(args, limit)...)
+}
+
+func (s *sqlPosts) Create(ctx context.Context, p *Post) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO posts (title, content, video, user_id) VALUES (?, ?, ?, ?)", p.Title, p.Content, p.Video, p.UserID)
+}
+
+func (s *sqlPosts) Update(ctx context.Context, id int, title, content string) error {
+	return s.conn.execOne(ctx, "UPDATE posts SET title = ?, content = ? WHERE id = ? AND user_id IS NOT NULL", title, content, id)
+}
+
+func (s *sqlPosts) Touch(ctx context.Context, id int) error {
+	return s.conn.execOne(ctx, "UPDATE posts SET last_activity_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+}
+
+func (s *sqlPosts) SetPinned(ctx context.Context, id int, pinned bool) error {
+	return s.conn.execOne(ctx, "UPDATE posts SET pinned = ? WHERE id = ? AND user_id IS NOT NULL", pinned, id)
+}
+
+func (s *sqlPosts) SetLocked(ctx context.Context, id int, locked bool) error {
+	return s.conn.execOne(ctx, "UPDATE posts SET locked = ? WHERE id = ? AND user_id IS NOT NULL", locked, id)
+}
+
+func (s *sqlPosts) SetArchived(ctx context.Context, id int, archived bool) error {
+	if !archived {
+		// Repart d'une activité fraîche pour ne pas être réarchivé au prochain passage
+		return s.conn.execOne(ctx, "UPDATE posts SET archived = FALSE, last_activity_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id IS NOT NULL", id)
+	}
+	return s.conn.execOne(ctx, "UPDATE posts SET archived = TRUE WHERE id = ? AND user_id IS NOT NULL", id)
+}
+
+func (s *sqlPosts) ArchiveInactive(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.conn.exec(ctx, "UPDATE posts SET archived = TRUE WHERE user_id IS NOT NULL AND pinned = FALSE AND archived = FALSE AND COALESCE(last_activity_at, created_at) < ?", formatTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
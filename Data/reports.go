@@ -0,0 +1,15 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlReports struct {
+	conn conn
+}
+
+func (s *sqlReports) Create(ctx context.Context, r *Report) (int, error) {
+	commentID := sql.NullInt64{Int64: int64(r.CommentID), Valid: r.CommentID != 0}
+	return s.conn.insert(ctx, "INSERT INTO reports (user_id, post_id, comment_id, reason) VALUES (?, ?, ?, ?)", r.UserID, r.PostID, commentID, r.Reason)
+}
@@ -2,48 +2,103 @@ package Data
 
 import (
 	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func InitDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "./Data/Data.db")
+// Moteurs de base de données pris en charge, sous le nom de leur pilote database/sql
+const (
+	SQLite   = "sqlite3"
+	MySQL    = "mysql"
+	Postgres = "postgres"
+)
+
+// Open ouvre la base sans toucher au schéma. source est le chemin du fichier pour SQLite,
+// un DSN user:pass@tcp(hôte:3306)/base pour MySQL et MariaDB, et une URL
+// postgres://user:pass@hôte/base ou une chaîne "host=… dbname=…" pour PostgreSQL.
+func Open(driver, source string) (*sql.DB, error) {
+	switch driver {
+	case SQLite:
+		if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+			return nil, err
+		}
+		return sql.Open(SQLite, source)
+	case MySQL:
+		dsn, err := mysqlDSN(source)
+		if err != nil {
+			return nil, err
+		}
+		return sql.Open(MySQL, dsn)
+	case Postgres:
+		return sql.Open(Postgres, postgresDSN(source))
+	}
+	return nil, fmt.Errorf("pilote de base de données inconnu : %q", driver)
+}
+
+// mysqlDSN complète le DSN avec les options dont dépendent les dépôts et les migrations :
+// dates lues en time.Time, en UTC comme avec SQLite, et fichiers de migration à plusieurs requêtes.
+func mysqlDSN(source string) (string, error) {
+	c, err := mysql.ParseDSN(source)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	c.ParseTime = true
+	c.Loc = time.UTC
+	c.MultiStatements = true
+	// Une mise à jour sans changement compte quand même la ligne, comme sous SQLite
+	c.ClientFoundRows = true
+	if c.Params == nil {
+		c.Params = map[string]string{}
+	}
+	c.Params["time_zone"] = "'+00:00'"
+	return c.FormatDSN(), nil
+}
+
+// postgresDSN fixe le fuseau de la session à UTC : CURRENT_TIMESTAMP y écrit alors les
+// mêmes dates que sous SQLite
+func postgresDSN(source string) string {
+	if strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://") {
+		u, err := url.Parse(source)
+		if err != nil {
+			// lib/pq signalera l'URL invalide à la connexion
+			return source
+		}
+		q := u.Query()
+		q.Set("timezone", "UTC")
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return source + " timezone=UTC"
+}
+
+// driverName retourne le moteur d'une base ouverte par Open
+func driverName(db *sql.DB) string {
+	switch db.Driver().(type) {
+	case *mysql.MySQLDriver:
+		return MySQL
+	case *pq.Driver:
+		return Postgres
 	}
+	return SQLite
+}
 
-	// Créez la table utilisateurs si elle n'existe pas
-	createTable := `
-    CREATE TABLE IF NOT EXISTS utilisateurs (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        email TEXT NOT NULL,
-        username TEXT NOT NULL,
-        password TEXT NOT NULL
-    );
-
-    CREATE TABLE IF NOT EXISTS posts (
-        id INTEGER PRIMARY KEY,
-        title TEXT NOT NULL,
-        content TEXT NOT NULL,
-        video   BLOB,
-        image   BLOB,
-        user_id INTEGER,
-        post_id INTEGER,
-        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-    );
-
-    CREATE TABLE IF NOT EXISTS comments (
-        id INTEGER PRIMARY KEY,
-        post_id INTEGER,
-        user_id INTEGER,
-        content TEXT
-    );
-
-
-    `
-	_, err = db.Exec(createTable)
+// InitDB ouvre la base et lui applique toutes les migrations en attente
+func InitDB(driver, source string) (*sql.DB, error) {
+	db, err := Open(driver, source)
 	if err != nil {
 		return nil, err
 	}
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return db, nil
 }
@@ -0,0 +1,221 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNotFound est retournée quand la ligne demandée n'existe pas ou n'est pas visible
+var ErrNotFound = errors.New("introuvable")
+
+// Les dépôts prennent l'ID du lecteur quand le résultat dépend de sa visibilité :
+// les contenus d'un auteur shadowbanné ne sont visibles que de lui-même.
+
+type Users interface {
+	ByID(ctx context.Context, id int) (*User, error)
+	ByEmail(ctx context.Context, email string) (*User, error)
+	ByUsername(ctx context.Context, username string) (*User, error)
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	Create(ctx context.Context, u *User) (int, error)
+	// Sanctioned liste les comptes bannis, shadowbannés ou suspendus à la date now
+	Sanctioned(ctx context.Context, now time.Time) ([]User, error)
+	Suspend(ctx context.Context, id int, until time.Time) error
+	Unsuspend(ctx context.Context, id int) error
+	SetBanned(ctx context.Context, id int, banned bool) error
+	SetShadowbanned(ctx context.Context, id int, shadowbanned bool) error
+	// VerifyEmail confirme l'adresse du compte si c'est toujours email, ou retourne ErrNotFound
+	VerifyEmail(ctx context.Context, id int, email string) error
+	// ResetPassword remplace le mot de passe et lève l'obligation de le changer ; le lien
+	// reçu par email confirme aussi l'adresse
+	ResetPassword(ctx context.Context, id int, password string) error
+	SetPassword(ctx context.Context, id int, password string) error
+	// ChangeEmail remplace l'adresse du compte, qui reste à confirmer
+	ChangeEmail(ctx context.Context, id int, email string) error
+	// Rename change le nom d'utilisateur en gardant l'ancien, qui mène encore au compte
+	Rename(ctx context.Context, id int, oldUsername, username string) error
+	// ByFormerUsername retourne le compte qui a porté ce nom en dernier
+	ByFormerUsername(ctx context.Context, username string) (*User, error)
+}
+
+type Posts interface {
+	// List retourne les sujets, épinglés d'abord, avec leurs images ; limit 0 les retourne tous
+	List(ctx context.Context, viewerID, limit int) ([]Post, error)
+	// Search retourne les sujets correspondant à la recherche, les plus pertinents d'abord
+	Search(ctx context.Context, query string, viewerID, limit int) ([]Post, error)
+	// Get retourne un sujet avec ses images, sans ses commentaires
+	Get(ctx context.Context, id, viewerID int) (*Post, error)
+	// State retourne l'état d'un sujet sans tenir compte de la visibilité de son auteur
+	State(ctx context.Context, id int) (locked, archived bool, err error)
+	// Page retourne au plus limit sujets d'ID inférieur à beforeID, du plus récent au plus
+	// ancien ; beforeID 0 part du plus récent. L'ID du dernier sert de curseur à la page suivante.
+	Page(ctx context.Context, viewerID, beforeID, limit int) ([]Post, error)
+	// Latest retourne les limit derniers sujets visibles de tous qui passent le filtre, du plus
+	// récent au plus ancien, sans faire passer les sujets épinglés en tête
+	Latest(ctx context.Context, filter PostFilter, limit int) ([]Post, error)
+	Create(ctx context.Context, p *Post) (int, error)
+	Update(ctx context.Context, id int, title, content string) error
+	// Touch note une nouvelle activité sur le sujet
+	Touch(ctx context.Context, id int) error
+	SetPinned(ctx context.Context, id int, pinned bool) error
+	SetLocked(ctx context.Context, id int, locked bool) error
+	SetArchived(ctx context.Context, id int, archived bool) error
+	// ArchiveInactive archive les sujets non épinglés sans activité depuis before
+	ArchiveInactive(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Comments interface {
+	ForPost(ctx context.Context, postID, viewerID int) ([]Comment, error)
+	// Page retourne au plus limit commentaires du sujet d'ID supérieur à afterID, dans l'ordre
+	Page(ctx context.Context, postID, viewerID, afterID, limit int) ([]Comment, error)
+	// Latest retourne les limit derniers commentaires du sujet visibles de tous, du plus récent au plus ancien
+	Latest(ctx context.Context, postID, limit int) ([]Comment, error)
+	Get(ctx context.Context, id, viewerID int) (*Comment, error)
+	// Create enregistre le commentaire daté de maintenant et renseigne c.Created
+	Create(ctx context.Context, c *Comment) (int, error)
+	Update(ctx context.Context, id int, content string) error
+}
+
+// Votes enregistre au plus un vote par utilisateur et par sujet, pour (1) ou contre (-1)
+type Votes interface {
+	// Of retourne le vote de l'utilisateur sur le sujet, 0 s'il n'a pas voté
+	Of(ctx context.Context, userID, postID int) (int, error)
+	Set(ctx context.Context, userID, postID, value int) error
+	Remove(ctx context.Context, userID, postID int) error
+}
+
+// Attachments gère les images d'un sujet. Elles sont rangées dans posts, sur des lignes
+// sans auteur qui pointent vers leur sujet par post_id.
+type Attachments interface {
+	ForPost(ctx context.Context, postID int) ([]string, error)
+	ForPosts(ctx context.Context, postIDs []int) (map[int][]string, error)
+	Add(ctx context.Context, post *Post, path string) error
+}
+
+// Tokens gère les jetons d'accès personnels, retrouvés par l'empreinte de leur secret
+type Tokens interface {
+	// ForUser liste les jetons de l'utilisateur, révoqués et expirés compris, les plus récents d'abord
+	ForUser(ctx context.Context, userID int) ([]APIToken, error)
+	// ByHash retourne le jeton dont l'empreinte est hash, même révoqué ou expiré
+	ByHash(ctx context.Context, hash string) (*APIToken, error)
+	Create(ctx context.Context, t *APIToken) (int, error)
+	// Touch note l'utilisation du jeton à la date at
+	Touch(ctx context.Context, id int, at time.Time) error
+	// Revoke révoque un jeton actif de l'utilisateur, ErrNotFound s'il n'en a pas d'ID id
+	Revoke(ctx context.Context, id, userID int, at time.Time) error
+	// RevokeAll révoque tous les jetons actifs de l'utilisateur
+	RevokeAll(ctx context.Context, userID int, at time.Time) error
+}
+
+// PasswordResets gère les demandes de réinitialisation du mot de passe, retrouvées par
+// l'empreinte de leur jeton
+type PasswordResets interface {
+	Create(ctx context.Context, r *PasswordReset) (int, error)
+	// ByHash retourne la demande dont l'empreinte est hash, même utilisée ou expirée
+	ByHash(ctx context.Context, hash string) (*PasswordReset, error)
+	// Use marque la demande utilisée, ou retourne ErrNotFound si elle l'a déjà été
+	Use(ctx context.Context, id int, at time.Time) error
+	// Discard marque utilisées toutes les demandes en cours de l'utilisateur
+	Discard(ctx context.Context, userID int, at time.Time) error
+}
+
+// Webhooks gère les webhooks et le journal de leurs livraisons
+type Webhooks interface {
+	List(ctx context.Context) ([]Webhook, error)
+	Get(ctx context.Context, id int) (*Webhook, error)
+	Create(ctx context.Context, h *Webhook) (int, error)
+	SetActive(ctx context.Context, id int, active bool) error
+	// Delete supprime le webhook et son journal
+	Delete(ctx context.Context, id int) error
+	// Enqueue programme la livraison immédiate d'un événement, ou d'une copie d'une livraison passée
+	Enqueue(ctx context.Context, webhookID int, event, payload string) (int, error)
+	// Due retourne au plus limit livraisons en attente dont la tentative est due à la date now
+	Due(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	// Record enregistre le résultat d'une tentative : état, compteur, prochaine tentative et réponse
+	Record(ctx context.Context, d *WebhookDelivery) error
+	// Deliveries retourne les limit dernières livraisons du webhook, les plus récentes d'abord
+	Deliveries(ctx context.Context, webhookID, limit int) ([]WebhookDelivery, error)
+	Delivery(ctx context.Context, id int) (*WebhookDelivery, error)
+}
+
+// Reports enregistre les signalements ; les modérateurs en sont avertis par webhook
+type Reports interface {
+	Create(ctx context.Context, r *Report) (int, error)
+}
+
+// Federation garde l'état ActivityPub : clés des acteurs locaux, abonnés, acteurs distants
+// connus, comptes et commentaires qui les représentent, et activités à livrer
+type Federation interface {
+	// Key retourne les clés PEM de l'acteur local, ou ErrNotFound s'il n'en a pas encore
+	Key(ctx context.Context, userID int) (private, public string, err error)
+	// SaveKey enregistre les clés de l'acteur ; si une autre requête l'a devancé, les siennes sont gardées
+	SaveKey(ctx context.Context, userID int, private, public string) error
+	Followers(ctx context.Context, userID int) ([]Follower, error)
+	CountFollowers(ctx context.Context, userID int) (int, error)
+	// AddFollower abonne l'acteur, ou met à jour sa boîte de réception s'il l'est déjà
+	AddFollower(ctx context.Context, f *Follower) error
+	RemoveFollower(ctx context.Context, userID int, actor string) error
+	RemoteActor(ctx context.Context, actor string) (*RemoteActor, error)
+	// SaveRemoteActor ajoute ou rafraîchit un acteur distant
+	SaveRemoteActor(ctx context.Context, a *RemoteActor) error
+	// RemoteAccount retourne le compte local qui représente l'acteur distant
+	RemoteAccount(ctx context.Context, actor string) (*User, error)
+	// CreateRemoteAccount crée ce compte, sans email ni mot de passe : on ne peut pas s'y connecter
+	CreateRemoteAccount(ctx context.Context, actor, username string) (int, error)
+	// ObjectPost retourne le sujet du commentaire reçu sous cet identifiant d'objet distant,
+	// ou ErrNotFound s'il n'a jamais été reçu
+	ObjectPost(ctx context.Context, objectID string) (int, error)
+	// AddComment enregistre un commentaire reçu d'un autre serveur, daté de c.Created
+	AddComment(ctx context.Context, c *Comment, objectID string) (int, error)
+	Enqueue(ctx context.Context, userID int, inbox, activity string) error
+	// Due retourne au plus limit livraisons en attente dont la tentative est due à la date now
+	Due(ctx context.Context, now time.Time, limit int) ([]ActivityDelivery, error)
+	// Record enregistre le résultat d'une tentative de livraison
+	Record(ctx context.Context, d *ActivityDelivery) error
+}
+
+// Store regroupe les dépôts adossés à une même base
+type Store struct {
+	Users       Users
+	Posts       Posts
+	Comments    Comments
+	Attachments Attachments
+	Votes       Votes
+	Tokens      Tokens
+	Resets      PasswordResets
+	Webhooks    Webhooks
+	Reports     Reports
+	Federation  Federation
+}
+
+// NewStore retourne les dépôts SQL de la base db
+func NewStore(db *sql.DB) *Store {
+	c := newConn(db)
+	attachments := &sqlAttachments{conn: c}
+	return &Store{
+		Users:       &sqlUsers{conn: c},
+		Posts:       &sqlPosts{conn: c, attachments: attachments},
+		Comments:    &sqlComments{conn: c},
+		Attachments: attachments,
+		Votes:       &sqlVotes{conn: c},
+		Tokens:      &sqlTokens{conn: c},
+		Resets:      &sqlPasswordResets{conn: c},
+		Webhooks:    &sqlWebhooks{conn: c},
+		Reports:     &sqlReports{conn: c},
+		Federation:  &sqlFederation{conn: c},
+	}
+}
+
+// visibleAuthor restreint une requête aux auteurs non shadowbannés, sauf pour l'auteur lui-même.
+// La requête doit joindre utilisateurs sous l'alias u et lui passer l'ID du lecteur.
+const visibleAuthor = "(u.shadowbanned = FALSE OR u.id = ?)"
+
+// notFound traduit l'absence de ligne en ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package Data
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type sqlTokens struct {
+	conn conn
+}
+
+// Les portées sont enregistrées séparées par des espaces
+const tokenColumns = "id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at"
+
+func scanToken(row scanner) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Hash, &scopes, &t.Created, &t.ExpiresAt, &t.LastUsed, &t.Revoked)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	t.Scopes = strings.Fields(scopes)
+	return &t, nil
+}
+
+func (s *sqlTokens) ForUser(ctx context.Context, userID int) ([]APIToken, error) {
+	rows, err := s.conn.query(ctx, "SELECT "+tokenColumns+" FROM api_tokens WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlTokens) ByHash(ctx context.Context, hash string) (*APIToken, error) {
+	return scanToken(s.conn.queryRow(ctx, "SELECT "+tokenColumns+" FROM api_tokens WHERE token_hash = ?", hash))
+}
+
+func (s *sqlTokens) Create(ctx context.Context, t *APIToken) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?)",
+		t.UserID, t.Name, t.Hash, strings.Join(t.Scopes, " "), formatTimestamp(t.ExpiresAt))
+}
+
+func (s *sqlTokens) Touch(ctx context.Context, id int, at time.Time) error {
+	return s.conn.execOne(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", formatTimestamp(at), id)
+}
+
+func (s *sqlTokens) Revoke(ctx context.Context, id, userID int, at time.Time) error {
+	return s.conn.execOne(ctx, "UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", formatTimestamp(at), id, userID)
+}
+
+func (s *sqlTokens) RevokeAll(ctx context.Context, userID int, at time.Time) error {
+	_, err := s.conn.exec(ctx, "UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", formatTimestamp(at), userID)
+	return err
+}
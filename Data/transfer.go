@@ -0,0 +1,170 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Fonctions de transfert d'un forum complet, utilisées par l'export et l'import. Contrairement
+// aux dépôts, elles voient tous les contenus, shadowbannés compris, et conservent les dates.
+
+// AllUsers retourne tous les comptes, par ID croissant
+func AllUsers(ctx context.Context, db *sql.DB) ([]User, error) {
+	rows, err := newConn(db).query(ctx, "SELECT "+userColumns+" FROM utilisateurs ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// AllPosts retourne tous les sujets avec leurs images, par ID croissant
+func AllPosts(ctx context.Context, db *sql.DB) ([]Post, error) {
+	c := newConn(db)
+	posts := &sqlPosts{conn: c, attachments: &sqlAttachments{conn: c}}
+	return posts.list(ctx, "SELECT "+postColumns+" FROM posts p JOIN utilisateurs u ON p.user_id = u.id ORDER BY p.id")
+}
+
+// AllComments retourne tous les commentaires, par ID croissant
+func AllComments(ctx context.Context, db *sql.DB) ([]Comment, error) {
+	rows, err := newConn(db).query(ctx, "SELECT c.id, c.post_id, c.user_id, u.username, c.content, c.created_at FROM comments c JOIN utilisateurs u ON c.user_id = u.id ORDER BY c.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Username, &c.Content, &c.Created); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// AllVotes retourne tous les votes, par sujet puis par utilisateur
+func AllVotes(ctx context.Context, db *sql.DB) ([]Vote, error) {
+	rows, err := newConn(db).query(ctx, "SELECT user_id, post_id, value, created_at FROM votes ORDER BY post_id, user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []Vote
+	for rows.Next() {
+		var v Vote
+		if err := rows.Scan(&v.UserID, &v.PostID, &v.Value, &v.Created); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+// Importer insère des contenus en conservant leurs attributs, dans une même transaction
+type Importer struct {
+	conn conn
+}
+
+// Import exécute fn dans une transaction, validée seulement si fn réussit
+func Import(ctx context.Context, db *sql.DB, fn func(im *Importer) error) error {
+	return newConn(db).inTx(ctx, func(tx conn) error {
+		return fn(&Importer{conn: tx})
+	})
+}
+
+// UserByEmail retourne le compte local de cet email ; les comptes distants, sans email, n'y répondent pas
+func (im *Importer) UserByEmail(ctx context.Context, email string) (*User, error) {
+	if email == "" {
+		return nil, ErrNotFound
+	}
+	return scanUser(im.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE email = ?", email))
+}
+
+// UserByRemoteActor retourne le compte qui représente l'acteur distant
+func (im *Importer) UserByRemoteActor(ctx context.Context, actor string) (*User, error) {
+	return scanUser(im.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE remote_actor = ?", actor))
+}
+
+func (im *Importer) UsernameExists(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := im.conn.queryRow(ctx, "SELECT EXISTS (SELECT 1 FROM utilisateurs WHERE username = ?)", username).Scan(&exists)
+	return exists, err
+}
+
+// AddUser crée un compte avec son rôle, ses sanctions et l'obligation de changer de mot de passe
+func (im *Importer) AddUser(ctx context.Context, u *User) (int, error) {
+	var picture sql.NullString
+	if u.ProfilePicture != "" {
+		picture = sql.NullString{String: u.ProfilePicture, Valid: true}
+	}
+	var remoteActor sql.NullString
+	if u.RemoteActor != "" {
+		remoteActor = sql.NullString{String: u.RemoteActor, Valid: true}
+	}
+	return im.conn.insert(ctx, "INSERT INTO utilisateurs (email, username, password, profile_picture, role, banned, suspended_until, shadowbanned, must_reset_password, remote_actor, email_verified) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		u.Email, u.Username, u.Password, picture, u.Role, u.Banned, u.SuspendedUntil, u.Shadowbanned, u.MustResetPassword, remoteActor, u.EmailVerified)
+}
+
+// AddPost crée un sujet avec son état, ses dates et ses images
+func (im *Importer) AddPost(ctx context.Context, p *Post) (int, error) {
+	id, err := im.conn.insert(ctx, "INSERT INTO posts (title, content, video, user_id, pinned, locked, archived, created_at, last_activity_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.Title, p.Content, p.Video, p.UserID, p.Pinned, p.Locked, p.Archived, formatTimestamp(p.Created), nullTimestamp(p.LastActivity))
+	if err != nil {
+		return 0, err
+	}
+	for _, image := range p.Image {
+		if _, err := im.conn.exec(ctx, "INSERT INTO posts (title, content, image, post_id) VALUES (?, ?, ?, ?)", p.Title, p.Content, image, id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// AddComment crée un commentaire avec sa date, si elle est connue
+func (im *Importer) AddComment(ctx context.Context, c *Comment) (int, error) {
+	return im.conn.insert(ctx, "INSERT INTO comments (post_id, user_id, content, created_at) VALUES (?, ?, ?, ?)", c.PostID, c.UserID, c.Content, nullTimestamp(c.Created))
+}
+
+// Genres de lignes suivies par Imported et RecordImport
+const (
+	ImportedPost    = "post"
+	ImportedComment = "comment"
+)
+
+// Imported retourne l'ID local de la ligne de genre kind déjà importée de source sous
+// originalID, ou ErrNotFound si elle ne l'a jamais été
+func (im *Importer) Imported(ctx context.Context, source, kind string, originalID int) (int, error) {
+	var id int
+	err := im.conn.queryRow(ctx, "SELECT local_id FROM imported_rows WHERE source = ? AND kind = ? AND original_id = ?", source, kind, originalID).Scan(&id)
+	return id, notFound(err)
+}
+
+// RecordImport note que la ligne originalID de source a été importée sous l'ID localID
+func (im *Importer) RecordImport(ctx context.Context, source, kind string, originalID, localID int) error {
+	_, err := im.conn.exec(ctx, "INSERT INTO imported_rows (source, kind, original_id, local_id) VALUES (?, ?, ?, ?)", source, kind, originalID, localID)
+	return err
+}
+
+// AddVote enregistre un vote avec sa date et indique s'il a été ajouté : un vote déjà
+// présent pour ce sujet est conservé
+func (im *Importer) AddVote(ctx context.Context, v *Vote) (bool, error) {
+	var exists bool
+	err := im.conn.queryRow(ctx, "SELECT EXISTS (SELECT 1 FROM votes WHERE user_id = ? AND post_id = ?)", v.UserID, v.PostID).Scan(&exists)
+	if err != nil || exists {
+		return false, err
+	}
+	_, err = im.conn.exec(ctx, "INSERT INTO votes (user_id, post_id, value, created_at) VALUES (?, ?, ?, ?)", v.UserID, v.PostID, v.Value, formatTimestamp(v.Created))
+	return err == nil, err
+}
@@ -0,0 +1,133 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlUsers struct {
+	conn conn
+}
+
+const userColumns = "id, email, username, password, profile_picture, role, banned, suspended_until, shadowbanned, must_reset_password, remote_actor, email_verified"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*User, error) {
+	var u User
+	var picture, remoteActor sql.NullString
+	err := row.Scan(&u.ID, &u.Email, &u.Username, &u.Password, &picture, &u.Role, &u.Banned, &u.SuspendedUntil, &u.Shadowbanned, &u.MustResetPassword, &remoteActor, &u.EmailVerified)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	u.ProfilePicture = picture.String
+	u.RemoteActor = remoteActor.String
+	return &u, nil
+}
+
+func (s *sqlUsers) ByID(ctx context.Context, id int) (*User, error) {
+	return scanUser(s.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE id = ?", id))
+}
+
+func (s *sqlUsers) ByEmail(ctx context.Context, email string) (*User, error) {
+	return scanUser(s.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE email = ?", email))
+}
+
+func (s *sqlUsers) ByUsername(ctx context.Context, username string) (*User, error) {
+	return scanUser(s.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE username = ?", username))
+}
+
+func (s *sqlUsers) UsernameExists(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := s.conn.queryRow(ctx, "SELECT EXISTS (SELECT 1 FROM utilisateurs WHERE username = ?)", username).Scan(&exists)
+	return exists, err
+}
+
+func (s *sqlUsers) EmailExists(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := s.conn.queryRow(ctx, "SELECT EXISTS (SELECT 1 FROM utilisateurs WHERE email = ?)", email).Scan(&exists)
+	return exists, err
+}
+
+func (s *sqlUsers) Create(ctx context.Context, u *User) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO utilisateurs (email, username, password) VALUES (?, ?, ?)", u.Email, u.Username, u.Password)
+}
+
+func (s *sqlUsers) Sanctioned(ctx context.Context, now time.Time) ([]User, error) {
+	rows, err := s.conn.query(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE banned = TRUE OR shadowbanned = TRUE OR suspended_until > ? ORDER BY username", now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlUsers) Suspend(ctx context.Context, id int, until time.Time) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET suspended_until = ? WHERE id = ?", until.UTC(), id)
+}
+
+func (s *sqlUsers) Unsuspend(ctx context.Context, id int) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET suspended_until = NULL WHERE id = ?", id)
+}
+
+func (s *sqlUsers) SetBanned(ctx context.Context, id int, banned bool) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET banned = ? WHERE id = ?", banned, id)
+}
+
+func (s *sqlUsers) SetShadowbanned(ctx context.Context, id int, shadowbanned bool) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET shadowbanned = ? WHERE id = ?", shadowbanned, id)
+}
+
+func (s *sqlUsers) ResetPassword(ctx context.Context, id int, password string) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET password = ?, must_reset_password = FALSE, email_verified = TRUE WHERE id = ?", password, id)
+}
+
+func (s *sqlUsers) SetPassword(ctx context.Context, id int, password string) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET password = ? WHERE id = ?", password, id)
+}
+
+func (s *sqlUsers) ChangeEmail(ctx context.Context, id int, email string) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET email = ?, email_verified = FALSE WHERE id = ?", email, id)
+}
+
+// Rename change le nom et garde l'ancien dans l'historique, dans une même transaction : un
+// échec ne laisse pas un nom changé sans sa redirection
+func (s *sqlUsers) Rename(ctx context.Context, id int, oldUsername, username string) error {
+	return s.conn.inTx(ctx, func(tx conn) error {
+		if err := tx.execOne(ctx, "UPDATE utilisateurs SET username = ? WHERE id = ?", username, id); err != nil {
+			return err
+		}
+		// Le nouveau nom n'est plus l'ancien nom de personne
+		if _, err := tx.exec(ctx, "DELETE FROM username_history WHERE old_username = ?", username); err != nil {
+			return err
+		}
+		query := "INSERT INTO username_history (old_username, user_id, changed_at) VALUES (?, ?, ?) "
+		if tx.driver == MySQL {
+			query += "ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), changed_at = VALUES(changed_at)"
+		} else {
+			query += "ON CONFLICT (old_username) DO UPDATE SET user_id = excluded.user_id, changed_at = excluded.changed_at"
+		}
+		_, err := tx.exec(ctx, query, oldUsername, id, formatTimestamp(time.Now()))
+		return err
+	})
+}
+
+func (s *sqlUsers) ByFormerUsername(ctx context.Context, username string) (*User, error) {
+	return scanUser(s.conn.queryRow(ctx, "SELECT "+userColumns+" FROM utilisateurs WHERE id = (SELECT user_id FROM username_history WHERE old_username = ?)", username))
+}
+
+func (s *sqlUsers) VerifyEmail(ctx context.Context, id int, email string) error {
+	return s.conn.execOne(ctx, "UPDATE utilisateurs SET email_verified = TRUE WHERE id = ? AND email = ?", id, email)
+}
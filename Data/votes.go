@@ -0,0 +1,37 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type sqlVotes struct {
+	conn conn
+}
+
+func (s *sqlVotes) Of(ctx context.Context, userID, postID int) (int, error) {
+	var value int
+	err := s.conn.queryRow(ctx, "SELECT value FROM votes WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return value, err
+}
+
+// Set remplace le vote précédent de l'utilisateur, avec la syntaxe d'upsert de chaque moteur
+func (s *sqlVotes) Set(ctx context.Context, userID, postID, value int) error {
+	query := "INSERT INTO votes (user_id, post_id, value) VALUES (?, ?, ?) "
+	if s.conn.driver == MySQL {
+		query += "ON DUPLICATE KEY UPDATE value = VALUES(value), created_at = CURRENT_TIMESTAMP"
+	} else {
+		query += "ON CONFLICT (user_id, post_id) DO UPDATE SET value = excluded.value, created_at = CURRENT_TIMESTAMP"
+	}
+	_, err := s.conn.exec(ctx, query, userID, postID, value)
+	return err
+}
+
+func (s *sqlVotes) Remove(ctx context.Context, userID, postID int) error {
+	_, err := s.conn.exec(ctx, "DELETE FROM votes WHERE user_id = ? AND post_id = ?", userID, postID)
+	return err
+}
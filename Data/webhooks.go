@@ -0,0 +1,121 @@
+package Data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type sqlWebhooks struct {
+	conn conn
+}
+
+const webhookColumns = "id, url, secret, events, active, created_at"
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var h Webhook
+	var events string
+	if err := row.Scan(&h.ID, &h.URL, &h.Secret, &events, &h.Active, &h.Created); err != nil {
+		return nil, notFound(err)
+	}
+	h.Events = strings.Fields(events)
+	return &h, nil
+}
+
+func (s *sqlWebhooks) List(ctx context.Context) ([]Webhook, error) {
+	rows, err := s.conn.query(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *h)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *sqlWebhooks) Get(ctx context.Context, id int) (*Webhook, error) {
+	return scanWebhook(s.conn.queryRow(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+}
+
+func (s *sqlWebhooks) Create(ctx context.Context, h *Webhook) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO webhooks (url, secret, events, active) VALUES (?, ?, ?, ?)", h.URL, h.Secret, strings.Join(h.Events, " "), h.Active)
+}
+
+func (s *sqlWebhooks) SetActive(ctx context.Context, id int, active bool) error {
+	return s.conn.execOne(ctx, "UPDATE webhooks SET active = ? WHERE id = ?", active, id)
+}
+
+func (s *sqlWebhooks) Delete(ctx context.Context, id int) error {
+	if _, err := s.conn.exec(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	return s.conn.execOne(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+}
+
+const deliveryColumns = "d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.status_code, d.error, d.created_at, d.delivered_at"
+
+func scanDelivery(row scanner) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var errText sql.NullString
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttempt, &d.StatusCode, &errText, &d.Created, &d.Delivered)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	d.Error = errText.String
+	return &d, nil
+}
+
+func (s *sqlWebhooks) deliveries(ctx context.Context, query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := s.conn.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *sqlWebhooks) Enqueue(ctx context.Context, webhookID int, event, payload string) (int, error) {
+	return s.conn.insert(ctx, "INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at) VALUES (?, ?, ?, ?, ?)",
+		webhookID, event, payload, DeliveryPending, formatTimestamp(time.Now()))
+}
+
+func (s *sqlWebhooks) Due(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	// Les livraisons d'un webhook désactivé attendent sa réactivation
+	return s.deliveries(ctx, "SELECT "+deliveryColumns+` FROM webhook_deliveries d JOIN webhooks h ON h.id = d.webhook_id
+		WHERE h.active = TRUE AND d.status = ? AND d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ?`,
+		DeliveryPending, formatTimestamp(now), limit)
+}
+
+func (s *sqlWebhooks) Record(ctx context.Context, d *WebhookDelivery) error {
+	var errText sql.NullString
+	if d.Error != "" {
+		errText = sql.NullString{String: d.Error, Valid: true}
+	}
+	return s.conn.execOne(ctx, "UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, status_code = ?, error = ?, delivered_at = ? WHERE id = ?",
+		d.Status, d.Attempts, nullTimestamp(d.NextAttempt), d.StatusCode, errText, nullTimestamp(d.Delivered), d.ID)
+}
+
+func (s *sqlWebhooks) Deliveries(ctx context.Context, webhookID, limit int) ([]WebhookDelivery, error) {
+	return s.deliveries(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries d WHERE d.webhook_id = ? ORDER BY d.id DESC LIMIT ?", webhookID, limit)
+}
+
+func (s *sqlWebhooks) Delivery(ctx context.Context, id int) (*WebhookDelivery, error) {
+	return scanDelivery(s.conn.queryRow(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries d WHERE d.id = ?", id))
+}
@@ -0,0 +1,1038 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+
+	data "forum/Data"
+)
+
+// Avec federation = true, chaque utilisateur est un acteur ActivityPub que l'on peut suivre
+// depuis Mastodon ou tout autre serveur du fédivers :
+//
+//	/.well-known/webfinger?resource=acct:<nom>@<hôte>   découverte de l'acteur
+//	/ap/users/<id>                                      acteur (Person) et sa clé publique
+//	/ap/users/<id>/outbox, /ap/users/<id>/followers     derniers sujets, nombre d'abonnés
+//	/ap/users/<id>/inbox, /ap/inbox                     boîtes de réception, personnelle et partagée
+//	/ap/posts/<id>, /ap/comments/<id>                   sujets (Article) et commentaires (Note)
+//
+// Les identifiants reposent sur l'ID des comptes, qui survit à un changement de nom. Les
+// nouveaux sujets et commentaires sont livrés aux abonnés ; une réponse reçue sous un sujet
+// devient un commentaire, signé par un compte local qui représente son auteur distant.
+const (
+	apPrefix          = "/ap/"
+	apUsersPrefix     = apPrefix + "users/"
+	apPostsPrefix     = apPrefix + "posts/"
+	apCommentsPrefix  = apPrefix + "comments/"
+	apSharedInbox     = apPrefix + "inbox"
+	apContentType     = "application/activity+json; charset=utf-8"
+	activityStreams   = "https://www.w3.org/ns/activitystreams"
+	securityContext   = "https://w3id.org/security/v1"
+	publicAudience    = activityStreams + "#Public"
+	webfingerProfile  = "http://webfinger.net/rel/profile-page"
+	apMaxBodyBytes    = 1 << 20
+	apOutboxSize      = 20
+	apRemoteActorTTL  = 24 * time.Hour
+	apPollInterval    = 5 * time.Second
+	apTimeout         = 10 * time.Second
+	apBatchSize       = 20
+	apRetryDelay      = 30 * time.Second
+	apMaxAttempts     = 8
+	apMaxErrorLength  = 500
+	apMaxUsernameTry  = 100
+	remoteContentSize = 10000
+)
+
+// apClient ne joint que des adresses publiques : les keyId, acteurs et boîtes de réception
+// viennent d'autres serveurs, et ne doivent pas servir à atteindre le réseau interne ni les
+// métadonnées d'un hébergeur (169.254.169.254). L'adresse est vérifiée à la connexion, après
+// résolution du nom et à chaque redirection ; sans proxy, car c'est lui qui serait vérifié.
+var apClient = &http.Client{Timeout: apTimeout, Transport: newAPTransport()}
+
+func newAPTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{Timeout: apTimeout, Control: dialPublicOnly}).DialContext
+	return t
+}
+
+// apAddressAllowed décide des adresses que apClient peut joindre
+var apAddressAllowed = isPublicAddress
+
+var errPrivateAddress = errors.New("adresse non publique refusée")
+
+// dialPublicOnly refuse la connexion à une adresse que apAddressAllowed n'autorise pas
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !apAddressAllowed(addrPort.Addr()) {
+		return fmt.Errorf("%s : %w", address, errPrivateAddress)
+	}
+	return nil
+}
+
+// Plages réservées absentes des méthodes de netip.Addr
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// isPublicAddress indique si l'adresse est joignable sur Internet : ni boucle locale, ni réseau
+// privé, ni lien local, ni multidiffusion, ni plage réservée
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// apActivity est une activité émise par un acteur local
+type apActivity struct {
+	Context   interface{} `json:"@context,omitempty"`
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Actor     string      `json:"actor"`
+	Published string      `json:"published,omitempty"`
+	To        []string    `json:"to,omitempty"`
+	Cc        []string    `json:"cc,omitempty"`
+	Object    interface{} `json:"object"`
+}
+
+// apObject est un sujet (Article) ou un commentaire (Note) local
+type apObject struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	AttributedTo string      `json:"attributedTo"`
+	Name         string      `json:"name,omitempty"`
+	Content      string      `json:"content"`
+	URL          string      `json:"url"`
+	InReplyTo    string      `json:"inReplyTo,omitempty"`
+	Published    string      `json:"published"`
+	To           []string    `json:"to"`
+	Cc           []string    `json:"cc"`
+}
+
+type apActor struct {
+	Context           []string    `json:"@context"`
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Name              string      `json:"name"`
+	URL               string      `json:"url"`
+	Inbox             string      `json:"inbox"`
+	Outbox            string      `json:"outbox"`
+	Followers         string      `json:"followers"`
+	Endpoints         apEndpoints `json:"endpoints"`
+	PublicKey         apPublicKey `json:"publicKey"`
+}
+
+type apEndpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type apPublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type apCollection struct {
+	Context      string        `json:"@context"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+// apIncoming est une activité reçue ; son objet est un identifiant ou un objet complet
+type apIncoming struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// apNote est la réponse reçue d'un autre serveur
+type apNote struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	AttributedTo string `json:"attributedTo"`
+	Content      string `json:"content"`
+	InReplyTo    string `json:"inReplyTo"`
+	Published    string `json:"published"`
+}
+
+// apRemoteDocument est l'acteur distant ou le document de sa clé, tel que le serveur le publie
+type apRemoteDocument struct {
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Inbox             string      `json:"inbox"`
+	Endpoints         apEndpoints `json:"endpoints"`
+	PublicKey         apPublicKey `json:"publicKey"`
+	// Renseignés quand keyId désigne un document de clé séparé de l'acteur
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type webfingerResponse struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases"`
+	Links   []webfingerLink `json:"links"`
+}
+
+type webfingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
+
+func actorURL(userID int) string {
+	return cfg.BaseURL() + apUsersPrefix + strconv.Itoa(userID)
+}
+
+func postObjectURL(postID int) string {
+	return cfg.BaseURL() + apPostsPrefix + strconv.Itoa(postID)
+}
+
+func commentObjectURL(commentID int) string {
+	return cfg.BaseURL() + apCommentsPrefix + strconv.Itoa(commentID)
+}
+
+// publicHost retourne l'hôte de public_url, qui forme les adresses acct:nom@hôte
+func publicHost() string {
+	u, err := url.Parse(cfg.BaseURL())
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// fediverseHandle retourne l'adresse @nom@hôte sous laquelle suivre l'utilisateur, ou rien
+// si la fédération est désactivée ou que le compte est distant
+func fediverseHandle(u *User) string {
+	if !cfg.Federation || u.IsRemote() {
+		return ""
+	}
+	return "@" + u.Username + "@" + publicHost()
+}
+
+// wantsActivityJSON indique si le client demande le document ActivityPub plutôt que la page HTML
+func wantsActivityJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/activity+json") || strings.Contains(accept, "application/ld+json")
+}
+
+func writeActivityJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", apContentType)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Erreur lors de l'encodage du document ActivityPub:", err)
+	}
+}
+
+// localActor retourne l'utilisateur local visible de tous dont l'ID termine le chemin, ou
+// ErrNotFound : les comptes distants et shadowbannés n'existent pas pour les autres serveurs
+func localActor(ctx context.Context, idParam string) (*User, error) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return nil, data.ErrNotFound
+	}
+	user, err := store.Users.ByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsRemote() || user.Shadowbanned {
+		return nil, data.ErrNotFound
+	}
+	return user, nil
+}
+
+// actorKey retourne les clés de l'acteur local, générées à sa première utilisation
+func actorKey(ctx context.Context, userID int) (private, public string, err error) {
+	private, public, err = store.Federation.Key(ctx, userID)
+	if !errors.Is(err, data.ErrNotFound) {
+		return private, public, err
+	}
+	if private, public, err = newKeyPair(); err != nil {
+		return "", "", err
+	}
+	if err := store.Federation.SaveKey(ctx, userID, private, public); err != nil {
+		return "", "", err
+	}
+	// Une requête concurrente a pu enregistrer ses clés la première : ce sont celles-là qui valent
+	return store.Federation.Key(ctx, userID)
+}
+
+type webfingerHandler struct{}
+
+func (h *webfingerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	var user *User
+	var err error
+	if name, ok := strings.CutPrefix(resource, "acct:"); ok {
+		name = strings.TrimPrefix(name, "@")
+		at := strings.LastIndex(name, "@")
+		if at < 0 || !strings.EqualFold(name[at+1:], publicHost()) {
+			http.NotFound(w, r)
+			return
+		}
+		user, err = store.Users.ByUsername(r.Context(), name[:at])
+		if err == nil && (user.IsRemote() || user.Shadowbanned) {
+			err = data.ErrNotFound
+		}
+	} else if idParam, ok := strings.CutPrefix(resource, cfg.BaseURL()+apUsersPrefix); ok {
+		user, err = localActor(r.Context(), idParam)
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, data.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de l'utilisateur", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération de l'utilisateur:", err)
+		return
+	}
+
+	actor := actorURL(user.ID)
+	profile := cfg.BaseURL() + profileURL(user.Username)
+	w.Header().Set("Content-Type", "application/jrd+json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(webfingerResponse{
+		Subject: "acct:" + user.Username + "@" + publicHost(),
+		Aliases: []string{actor, profile},
+		Links: []webfingerLink{
+			{Rel: "self", Type: "application/activity+json", Href: actor},
+			{Rel: webfingerProfile, Type: "text/html", Href: profile},
+		},
+	})
+}
+
+// apUserHandler sert l'acteur et ses collections, et reçoit les activités qui lui sont adressées
+type apUserHandler struct{}
+
+func (h *apUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	idParam, collection, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apUsersPrefix), "/")
+	if collection == "inbox" {
+		handleInbox(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	user, err := localActor(r.Context(), idParam)
+	if errors.Is(err, data.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de l'utilisateur", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération de l'utilisateur:", err)
+		return
+	}
+
+	switch collection {
+	case "":
+		serveActor(w, r, user)
+	case "outbox":
+		serveOutbox(w, r, user)
+	case "followers":
+		n, err := store.Federation.CountFollowers(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, "Erreur lors de la récupération des abonnés", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération des abonnés:", err)
+			return
+		}
+		// Seul le nombre d'abonnés est public, pas leur liste
+		writeActivityJSON(w, apCollection{Context: activityStreams, ID: actorURL(user.ID) + "/followers", Type: "OrderedCollection", TotalItems: n})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func serveActor(w http.ResponseWriter, r *http.Request, user *User) {
+	if !wantsActivityJSON(r) {
+		http.Redirect(w, r, profileURL(user.Username), http.StatusSeeOther)
+		return
+	}
+	_, public, err := actorKey(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de la clé", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération de la clé ActivityPub:", err)
+		return
+	}
+	actor := actorURL(user.ID)
+	writeActivityJSON(w, apActor{
+		Context:           []string{activityStreams, securityContext},
+		ID:                actor,
+		Type:              "Person",
+		PreferredUsername: user.Username,
+		Name:              user.Username,
+		URL:               cfg.BaseURL() + profileURL(user.Username),
+		Inbox:             actor + "/inbox",
+		Outbox:            actor + "/outbox",
+		Followers:         actor + "/followers",
+		Endpoints:         apEndpoints{SharedInbox: cfg.BaseURL() + apSharedInbox},
+		PublicKey:         apPublicKey{ID: actor + "#main-key", Owner: actor, PublicKeyPem: public},
+	})
+}
+
+func serveOutbox(w http.ResponseWriter, r *http.Request, user *User) {
+	posts, err := store.Posts.Latest(r.Context(), data.PostFilter{AuthorID: user.ID}, apOutboxSize)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération des posts", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération des posts:", err)
+		return
+	}
+	outbox := apCollection{Context: activityStreams, ID: actorURL(user.ID) + "/outbox", Type: "OrderedCollection", TotalItems: len(posts)}
+	for i := range posts {
+		outbox.OrderedItems = append(outbox.OrderedItems, createActivity(newArticle(&posts[i]), false))
+	}
+	writeActivityJSON(w, outbox)
+}
+
+// apObjectHandler sert les sujets et les commentaires locaux, ou redirige un navigateur vers leur page
+type apObjectHandler struct{}
+
+func (h *apObjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	var object *apObject
+	var page string
+	var err error
+	if idParam, ok := strings.CutPrefix(r.URL.Path, apPostsPrefix); ok {
+		var post *Post
+		if post, err = publicPost(r.Context(), idParam); err == nil {
+			object, page = newArticle(post), postURL(post.ID)
+		}
+	} else {
+		var comment *Comment
+		if comment, err = publicComment(r.Context(), strings.TrimPrefix(r.URL.Path, apCommentsPrefix)); err == nil {
+			object, page = newNote(comment), commentURL(comment.PostID, comment.ID)
+		}
+	}
+	if errors.Is(err, data.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de l'objet", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération de l'objet ActivityPub:", err)
+		return
+	}
+	if !wantsActivityJSON(r) {
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+	object.Context = activityStreams
+	writeActivityJSON(w, object)
+}
+
+// publicPost retourne le sujet visible de tous dont l'ID est donné
+func publicPost(ctx context.Context, idParam string) (*Post, error) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return nil, data.ErrNotFound
+	}
+	return store.Posts.Get(ctx, id, 0)
+}
+
+// publicComment retourne le commentaire local visible de tous dont l'ID est donné ; un
+// commentaire reçu d'un autre serveur a déjà son identifiant là-bas
+func publicComment(ctx context.Context, idParam string) (*Comment, error) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return nil, data.ErrNotFound
+	}
+	comment, err := store.Comments.Get(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	author, err := store.Users.ByID(ctx, comment.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if author.IsRemote() {
+		return nil, data.ErrNotFound
+	}
+	if _, err := store.Posts.Get(ctx, comment.PostID, 0); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func newArticle(p *Post) *apObject {
+	actor := actorURL(p.UserID)
+	return &apObject{
+		ID:           postObjectURL(p.ID),
+		Type:         "Article",
+		AttributedTo: actor,
+		Name:         p.Title,
+		Content:      string(renderMarkdown(p.Content)),
+		URL:          cfg.BaseURL() + postURL(p.ID),
+		Published:    p.Created.UTC().Format(time.RFC3339),
+		To:           []string{publicAudience},
+		Cc:           []string{actor + "/followers"},
+	}
+}
+
+func newNote(c *Comment) *apObject {
+	actor := actorURL(c.UserID)
+	published := time.Now()
+	if c.Created.Valid {
+		published = c.Created.Time
+	}
+	return &apObject{
+		ID:           commentObjectURL(c.ID),
+		Type:         "Note",
+		AttributedTo: actor,
+		Content:      string(renderMarkdown(c.Content)),
+		URL:          cfg.BaseURL() + commentURL(c.PostID, c.ID),
+		InReplyTo:    postObjectURL(c.PostID),
+		Published:    published.UTC().Format(time.RFC3339),
+		To:           []string{publicAudience},
+		Cc:           []string{actor + "/followers"},
+	}
+}
+
+// createActivity enveloppe l'objet dans l'activité Create de son auteur
+func createActivity(object *apObject, withContext bool) *apActivity {
+	activity := &apActivity{
+		ID:        object.ID + "/activity",
+		Type:      "Create",
+		Actor:     object.AttributedTo,
+		Published: object.Published,
+		To:        object.To,
+		Cc:        object.Cc,
+		Object:    object,
+	}
+	if withContext {
+		activity.Context = activityStreams
+	}
+	return activity
+}
+
+type apSharedInboxHandler struct{}
+
+func (h *apSharedInboxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handleInbox(w, r)
+}
+
+// handleInbox vérifie la signature de l'activité reçue puis la traite. Les boîtes personnelles
+// et la boîte partagée se comportent de la même façon : l'activité désigne elle-même sa cible.
+func handleInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, apMaxBodyBytes))
+	if err != nil {
+		http.Error(w, "Activité trop volumineuse", http.StatusRequestEntityTooLarge)
+		return
+	}
+	signer, err := verifyRequest(r.Context(), r, body)
+	if err != nil {
+		// Le détail reste dans le journal : il renseignerait l'expéditeur sur le réseau du forum
+		log.Println("Signature ActivityPub refusée:", err)
+		http.Error(w, "Signature refusée", http.StatusUnauthorized)
+		return
+	}
+	var activity apIncoming
+	if err := json.Unmarshal(body, &activity); err != nil {
+		http.Error(w, "Activité illisible", http.StatusBadRequest)
+		return
+	}
+	if activity.Actor != signer.Actor {
+		http.Error(w, "L'activité n'est pas signée par son acteur", http.StatusUnauthorized)
+		return
+	}
+
+	switch activity.Type {
+	case "Follow":
+		err = receiveFollow(r.Context(), signer, &activity, body)
+	case "Undo":
+		err = receiveUndo(r.Context(), signer, &activity)
+	case "Create":
+		err = receiveCreate(r.Context(), signer, &activity)
+	}
+	// Les autres activités (Like, Announce, Delete…) sont acceptées sans effet
+	var refused *inboxError
+	if errors.As(err, &refused) {
+		http.Error(w, refused.message, refused.status)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors du traitement de l'activité", http.StatusInternalServerError)
+		log.Printf("Erreur lors du traitement d'une activité %s de %s: %v\n", activity.Type, signer.Actor, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// inboxError est une activité refusée, à signaler au serveur distant
+type inboxError struct {
+	status  int
+	message string
+}
+
+func (e *inboxError) Error() string {
+	return e.message
+}
+
+// objectID retourne l'identifiant de l'objet d'une activité, qu'il soit donné seul ou en entier
+func objectID(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+	var object struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(raw, &object)
+	return object.ID
+}
+
+// receiveFollow abonne l'acteur distant et lui répond par un Accept signé par l'utilisateur suivi
+func receiveFollow(ctx context.Context, signer *data.RemoteActor, activity *apIncoming, body []byte) error {
+	idParam, ok := strings.CutPrefix(objectID(activity.Object), cfg.BaseURL()+apUsersPrefix)
+	if !ok {
+		return &inboxError{http.StatusNotFound, "Acteur inconnu"}
+	}
+	user, err := localActor(ctx, idParam)
+	if errors.Is(err, data.ErrNotFound) {
+		return &inboxError{http.StatusNotFound, "Acteur inconnu"}
+	}
+	if err != nil {
+		return err
+	}
+	if err := store.Federation.AddFollower(ctx, &data.Follower{UserID: user.ID, Actor: signer.Actor, Inbox: signer.Inbox}); err != nil {
+		return err
+	}
+
+	actor := actorURL(user.ID)
+	accept, err := json.Marshal(apActivity{
+		Context: activityStreams,
+		ID:      actor + "#accepts/" + url.QueryEscape(activity.ID),
+		Type:    "Accept",
+		Actor:   actor,
+		Object:  json.RawMessage(body),
+	})
+	if err != nil {
+		return err
+	}
+	return store.Federation.Enqueue(ctx, user.ID, signer.Inbox, string(accept))
+}
+
+// receiveUndo désabonne l'acteur distant quand il annule son Follow
+func receiveUndo(ctx context.Context, signer *data.RemoteActor, activity *apIncoming) error {
+	var follow apIncoming
+	if json.Unmarshal(activity.Object, &follow) != nil || follow.Type != "Follow" || follow.Actor != signer.Actor {
+		return nil
+	}
+	idParam, ok := strings.CutPrefix(objectID(follow.Object), cfg.BaseURL()+apUsersPrefix)
+	if !ok {
+		return nil
+	}
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return nil
+	}
+	return store.Federation.RemoveFollower(ctx, id, signer.Actor)
+}
+
+// receiveCreate enregistre une réponse à un sujet ou à un commentaire comme un commentaire du sujet
+func receiveCreate(ctx context.Context, signer *data.RemoteActor, activity *apIncoming) error {
+	var note apNote
+	if json.Unmarshal(activity.Object, &note) != nil || note.Type != "Note" || note.ID == "" || note.InReplyTo == "" {
+		return nil
+	}
+	if note.AttributedTo != signer.Actor || !sameHost(note.ID, signer.Actor) {
+		return &inboxError{http.StatusUnauthorized, "La note n'est pas attribuée au signataire"}
+	}
+	postID, err := repliedPost(ctx, note.InReplyTo)
+	if errors.Is(err, data.ErrNotFound) {
+		// Réponse à un contenu d'ailleurs : elle ne concerne pas le forum
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Une même note peut arriver plusieurs fois, par la boîte personnelle et la boîte partagée
+	if _, err := store.Federation.ObjectPost(ctx, note.ID); !errors.Is(err, data.ErrNotFound) {
+		return err
+	}
+	if _, err := store.Posts.Get(ctx, postID, 0); errors.Is(err, data.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	locked, archived, err := store.Posts.State(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if locked || archived {
+		return &inboxError{http.StatusForbidden, "Ce sujet est fermé aux nouveaux commentaires"}
+	}
+
+	account, err := remoteAccount(ctx, signer)
+	if err != nil {
+		return err
+	}
+	if account.Banned || account.IsSuspended() {
+		return &inboxError{http.StatusForbidden, "Ce compte est suspendu sur le forum"}
+	}
+	content := noteText(note.Content)
+	if content == "" {
+		return nil
+	}
+	created := time.Now()
+	if published, err := time.Parse(time.RFC3339, note.Published); err == nil && published.Before(created) {
+		created = published
+	}
+
+	comment := &Comment{PostID: postID, UserID: account.ID, Username: account.Username, Content: content, Created: sqlTime(created)}
+	if comment.ID, err = store.Federation.AddComment(ctx, comment, note.ID); err != nil {
+		return err
+	}
+	if err := store.Posts.Touch(ctx, postID); err != nil {
+		log.Println("Erreur lors de la mise à jour de l'activité du post:", err)
+	}
+	emitCommentCreated(ctx, account, comment)
+	return nil
+}
+
+// repliedPost retourne le sujet local auquel répond l'objet : un sujet, un commentaire, ou une
+// réponse distante déjà reçue
+func repliedPost(ctx context.Context, inReplyTo string) (int, error) {
+	if path, ok := strings.CutPrefix(inReplyTo, cfg.BaseURL()); ok {
+		path, _, _ = strings.Cut(path, "#")
+		for _, prefix := range []string{apPostsPrefix, "/details/"} {
+			if idParam, ok := strings.CutPrefix(path, prefix); ok {
+				id, err := strconv.Atoi(idParam)
+				if err != nil {
+					return 0, data.ErrNotFound
+				}
+				return id, nil
+			}
+		}
+		if idParam, ok := strings.CutPrefix(path, apCommentsPrefix); ok {
+			id, err := strconv.Atoi(idParam)
+			if err != nil {
+				return 0, data.ErrNotFound
+			}
+			comment, err := store.Comments.Get(ctx, id, 0)
+			if err != nil {
+				return 0, err
+			}
+			return comment.PostID, nil
+		}
+		return 0, data.ErrNotFound
+	}
+	return store.Federation.ObjectPost(ctx, inReplyTo)
+}
+
+// remoteAccount retourne le compte local qui représente l'acteur distant, créé à sa première
+// réponse sous le nom nom@hôte, suffixé si ce nom est déjà pris
+func remoteAccount(ctx context.Context, actor *data.RemoteActor) (*User, error) {
+	account, err := store.Federation.RemoteAccount(ctx, actor.Actor)
+	if !errors.Is(err, data.ErrNotFound) {
+		return account, err
+	}
+	base := actor.Username
+	if base == "" {
+		base = "inconnu"
+	}
+	base += "@" + hostOf(actor.Actor)
+	username := base
+	for i := 2; ; i++ {
+		if _, err := store.Users.ByUsername(ctx, username); errors.Is(err, data.ErrNotFound) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if i > apMaxUsernameTry {
+			return nil, fmt.Errorf("aucun nom d'utilisateur libre pour %s", actor.Actor)
+		}
+		username = base + "-" + strconv.Itoa(i)
+	}
+	if _, err := store.Federation.CreateRemoteAccount(ctx, actor.Actor, username); err != nil {
+		return nil, err
+	}
+	return store.Federation.RemoteAccount(ctx, actor.Actor)
+}
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+	plainText  = bluemonday.StrictPolicy()
+)
+
+// noteText convertit le HTML d'une note en texte, rendu ensuite comme tout commentaire
+func noteText(content string) string {
+	text := html.UnescapeString(plainText.Sanitize(lineBreaks.ReplaceAllString(content, "\n")))
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > remoteContentSize {
+		text = string([]rune(text)[:remoteContentSize])
+	}
+	return text
+}
+
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func sameHost(a, b string) bool {
+	host := hostOf(a)
+	return host != "" && host == hostOf(b)
+}
+
+func sqlTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+// fetchRemoteActor retourne l'acteur qui possède la clé keyID, depuis le cache s'il est frais,
+// sinon depuis son serveur ; refresh force ce nouveau téléchargement
+func fetchRemoteActor(ctx context.Context, keyID string, refresh bool) (*data.RemoteActor, error) {
+	actorID, _, _ := strings.Cut(keyID, "#")
+	if !refresh {
+		cached, err := store.Federation.RemoteActor(ctx, actorID)
+		if err == nil && cached.KeyID == keyID && time.Since(cached.Fetched) < apRemoteActorTTL {
+			return cached, nil
+		}
+		if err != nil && !errors.Is(err, data.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	doc, err := fetchDocument(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	// keyId désigne un document de clé séparé : l'acteur est son propriétaire
+	if doc.Inbox == "" && doc.Owner != "" {
+		if !sameHost(doc.Owner, keyID) {
+			return nil, errors.New("clé et acteur sur des serveurs différents")
+		}
+		if doc, err = fetchDocument(ctx, doc.Owner); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Inbox == "" || doc.PublicKey.ID != keyID || doc.PublicKey.PublicKeyPem == "" {
+		return nil, errors.New("l'acteur ne publie pas cette clé")
+	}
+
+	actor := &data.RemoteActor{
+		Actor:     doc.ID,
+		Username:  doc.PreferredUsername,
+		Inbox:     doc.Inbox,
+		KeyID:     doc.PublicKey.ID,
+		PublicKey: doc.PublicKey.PublicKeyPem,
+		Fetched:   time.Now(),
+	}
+	// La boîte partagée reçoit en une fois ce qui est destiné à tous les abonnés d'un serveur
+	if doc.Endpoints.SharedInbox != "" {
+		actor.Inbox = doc.Endpoints.SharedInbox
+	}
+	if err := store.Federation.SaveRemoteActor(ctx, actor); err != nil {
+		return nil, err
+	}
+	return actor, nil
+}
+
+// fetchDocument télécharge un document ActivityPub, qui doit porter l'identifiant demandé
+func fetchDocument(ctx context.Context, id string) (*apRemoteDocument, error) {
+	u, err := url.Parse(id)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("identifiant d'acteur %q invalide", id)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+	req.Header.Set("User-Agent", "forum-activitypub")
+	resp, err := apClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("récupération de %s : %s", id, resp.Status)
+	}
+	var doc apRemoteDocument
+	if err := json.NewDecoder(io.LimitReader(resp.Body, apMaxBodyBytes)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("document %s illisible : %w", id, err)
+	}
+	if doc.ID != id {
+		return nil, fmt.Errorf("le document %s porte l'identifiant %s", id, doc.ID)
+	}
+	return &doc, nil
+}
+
+// federatePost livre le nouveau sujet aux abonnés de son auteur
+func federatePost(ctx context.Context, author *User, postID int) {
+	if !cfg.Federation || author.Shadowbanned || author.IsRemote() {
+		return
+	}
+	post, err := store.Posts.Get(ctx, postID, author.ID)
+	if err != nil {
+		log.Println("Erreur lors de la récupération du post:", err)
+		return
+	}
+	deliverToFollowers(ctx, author.ID, createActivity(newArticle(post), true))
+}
+
+// federateComment livre le nouveau commentaire aux abonnés de son auteur
+func federateComment(ctx context.Context, author *User, comment *Comment) {
+	if !cfg.Federation || author.Shadowbanned || author.IsRemote() {
+		return
+	}
+	deliverToFollowers(ctx, author.ID, createActivity(newNote(comment), true))
+}
+
+// deliverToFollowers programme la livraison de l'activité, une fois par boîte de réception
+func deliverToFollowers(ctx context.Context, userID int, activity *apActivity) {
+	followers, err := store.Federation.Followers(ctx, userID)
+	if err != nil {
+		log.Println("Erreur lors de la récupération des abonnés:", err)
+		return
+	}
+	if len(followers) == 0 {
+		return
+	}
+	payload, err := json.Marshal(activity)
+	if err != nil {
+		log.Println("Erreur lors de l'encodage de l'activité:", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, f := range followers {
+		if seen[f.Inbox] {
+			continue
+		}
+		seen[f.Inbox] = true
+		if err := store.Federation.Enqueue(ctx, userID, f.Inbox, string(payload)); err != nil {
+			log.Println("Erreur lors de la programmation d'une livraison ActivityPub:", err)
+		}
+	}
+}
+
+// deliverActivities livre périodiquement les activités en attente
+func deliverActivities() {
+	ticker := time.NewTicker(apPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deliverDueActivities(context.Background())
+	}
+}
+
+func deliverDueActivities(ctx context.Context) {
+	due, err := store.Federation.Due(ctx, time.Now(), apBatchSize)
+	if err != nil {
+		log.Println("Erreur lors de la récupération des livraisons ActivityPub:", err)
+		return
+	}
+	for i := range due {
+		d := &due[i]
+		d.Attempts++
+		d.Error = ""
+		err := sendActivity(ctx, d)
+		switch {
+		case err == nil:
+			d.Status = data.DeliveryDelivered
+			d.NextAttempt = sql.NullTime{}
+		case d.Attempts >= apMaxAttempts:
+			d.Status = data.DeliveryFailed
+			d.Error = err.Error()
+			d.NextAttempt = sql.NullTime{}
+			log.Printf("Livraison ActivityPub %d vers %s abandonnée après %d tentatives: %v\n", d.ID, d.Inbox, d.Attempts, err)
+		default:
+			d.Error = err.Error()
+			d.NextAttempt = sqlTime(time.Now().Add(retryBackoff(apRetryDelay, d.Attempts)))
+		}
+		if err := store.Federation.Record(ctx, d); err != nil {
+			log.Println("Erreur lors de l'enregistrement d'une livraison ActivityPub:", err)
+		}
+	}
+}
+
+// sendActivity poste l'activité signée par la clé de son acteur ; toute réponse hors 2xx est un échec
+func sendActivity(ctx context.Context, d *data.ActivityDelivery) error {
+	private, _, err := actorKey(ctx, d.UserID)
+	if err != nil {
+		return err
+	}
+	key, err := parsePrivateKey(private)
+	if err != nil {
+		return err
+	}
+	body := []byte(d.Activity)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", apContentType)
+	req.Header.Set("User-Agent", "forum-activitypub")
+	if err := signRequest(req, actorURL(d.UserID)+"#main-key", key, body); err != nil {
+		return err
+	}
+
+	resp, err := apClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, apMaxErrorLength))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	message := resp.Status
+	if s := strings.TrimSpace(string(excerpt)); s != "" {
+		message += " : " + s
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// remoteServer simule un serveur du fédivers : il publie l'acteur bob et sa clé, et garde
+// les activités reçues dans la boîte de bob
+type remoteServer struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	public  string
+	mu      sync.Mutex
+	fetches int
+	inbox   []deliveredActivity
+}
+
+// deliveredActivity est une activité reçue par le serveur simulé, avec de quoi vérifier sa signature
+type deliveredActivity struct {
+	target string
+	host   string
+	header http.Header
+	body   []byte
+}
+
+func newRemoteServer(t *testing.T) *remoteServer {
+	t.Helper()
+	private, public, err := newKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parsePrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &remoteServer{key: key, public: public}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/users/bob":
+			rs.fetches++
+			w.Header().Set("Content-Type", apContentType)
+			json.NewEncoder(w).Encode(apRemoteDocument{
+				ID:                rs.actor(),
+				Type:              "Person",
+				PreferredUsername: "bob",
+				Inbox:             rs.actor() + "/inbox",
+				PublicKey:         apPublicKey{ID: rs.keyID(), Owner: rs.actor(), PublicKeyPem: rs.public},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/users/bob/inbox":
+			body, _ := io.ReadAll(r.Body)
+			rs.inbox = append(rs.inbox, deliveredActivity{target: r.URL.RequestURI(), host: r.Host, header: r.Header.Clone(), body: body})
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func (rs *remoteServer) actor() string { return rs.URL + "/users/bob" }
+func (rs *remoteServer) keyID() string { return rs.actor() + "#main-key" }
+
+func (rs *remoteServer) received() []deliveredActivity {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]deliveredActivity(nil), rs.inbox...)
+}
+
+func (rs *remoteServer) fetched() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.fetches
+}
+
+// useFederation active la fédération sur une base SQLite neuve, servie sous https://forum.example.
+// Le serveur simulé écoute sur la boucle locale : apClient est autorisé à la joindre.
+func useFederation(t *testing.T) *data.Store {
+	t.Helper()
+	openTestDatabase(t)
+	cfg.Federation = true
+	cfg.PublicURL = "https://forum.example"
+	previous := apAddressAllowed
+	apAddressAllowed = func(netip.Addr) bool { return true }
+	t.Cleanup(func() { apAddressAllowed = previous })
+	return store
+}
+
+// inboxRequest construit la requête qui poste activity dans la boîte partagée, signée par bob
+func inboxRequest(t *testing.T, rs *remoteServer, activity interface{}) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, cfg.BaseURL()+apSharedInbox, bytes.NewReader(body))
+	r.Header.Set("Content-Type", apContentType)
+	if err := signRequest(r, rs.keyID(), rs.key, body); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// resign signe de nouveau la requête avec key, en ne couvrant que headers, pour tester une
+// signature valide sur des en-têtes refusés
+func resign(t *testing.T, r *http.Request, keyID string, key *rsa.PrivateKey, headers []string) {
+	t.Helper()
+	signing, err := signingString(r.Method, r.URL.RequestURI(), r.Host, r.Header, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(signing))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+}
+
+func postToInbox(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	(&apSharedInboxHandler{}).ServeHTTP(w, r)
+	return w
+}
+
+func followActivity(rs *remoteServer, userID int) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": activityStreams,
+		"id":       rs.URL + "/follows/1",
+		"type":     "Follow",
+		"actor":    rs.actor(),
+		"object":   actorURL(userID),
+	}
+}
+
+func TestWebfingerAndActor(t *testing.T) {
+	useFederation(t)
+	aliceID := createUser(t, "alice")
+
+	tests := []struct {
+		resource string
+		status   int
+	}{
+		{"acct:alice@forum.example", http.StatusOK},
+		{"acct:@alice@forum.example", http.StatusOK},
+		{actorURL(aliceID), http.StatusOK},
+		{"acct:alice@autre.example", http.StatusNotFound},
+		{"acct:personne@forum.example", http.StatusNotFound},
+		{"mailto:alice@example.com", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			(&webfingerHandler{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+tt.resource, nil))
+			if w.Code != tt.status {
+				t.Fatalf("statut %d, attendu %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var jrd webfingerResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &jrd); err != nil {
+				t.Fatal(err)
+			}
+			if jrd.Subject != "acct:alice@forum.example" || len(jrd.Links) == 0 || jrd.Links[0].Rel != "self" || jrd.Links[0].Href != actorURL(aliceID) {
+				t.Errorf("réponse WebFinger : %+v", jrd)
+			}
+		})
+	}
+
+	actorRequest := func(accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, actorURL(aliceID), nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		(&apUserHandler{}).ServeHTTP(w, r)
+		return w
+	}
+	w := actorRequest("application/activity+json")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != apContentType {
+		t.Fatalf("acteur : statut %d, type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var actor apActor
+	if err := json.Unmarshal(w.Body.Bytes(), &actor); err != nil {
+		t.Fatal(err)
+	}
+	if actor.ID != actorURL(aliceID) || actor.Type != "Person" || actor.PreferredUsername != "alice" ||
+		actor.Inbox != actorURL(aliceID)+"/inbox" || actor.Endpoints.SharedInbox != cfg.BaseURL()+apSharedInbox {
+		t.Errorf("acteur : %+v", actor)
+	}
+	if actor.PublicKey.ID != actorURL(aliceID)+"#main-key" || actor.PublicKey.Owner != actor.ID {
+		t.Errorf("clé de l'acteur : %+v", actor.PublicKey)
+	}
+	if _, err := parsePublicKey(actor.PublicKey.PublicKeyPem); err != nil {
+		t.Errorf("clé publique illisible : %v", err)
+	}
+	// La clé est générée une fois pour toutes
+	var again apActor
+	json.Unmarshal(actorRequest("application/ld+json").Body.Bytes(), &again)
+	if again.PublicKey.PublicKeyPem != actor.PublicKey.PublicKeyPem {
+		t.Error("la clé de l'acteur a changé entre deux requêtes")
+	}
+	// Un navigateur est renvoyé vers le profil
+	assertRedirect(t, actorRequest("text/html"), profileURL("alice"))
+}
+
+func TestInboxFollow(t *testing.T) {
+	s := useFederation(t)
+	rs := newRemoteServer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+
+	w := postToInbox(inboxRequest(t, rs, followActivity(rs, aliceID)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("statut %d, attendu 202 : %s", w.Code, w.Body)
+	}
+	followers, err := s.Federation.Followers(ctx, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followers) != 1 || followers[0].Actor != rs.actor() || followers[0].Inbox != rs.actor()+"/inbox" {
+		t.Fatalf("abonnés : %+v", followers)
+	}
+
+	// L'Accept est livré à bob, signé par la clé d'alice
+	deliverDueActivities(ctx)
+	received := rs.received()
+	if len(received) != 1 {
+		t.Fatalf("%d activités livrées, attendu 1", len(received))
+	}
+	accept := received[0]
+	var activity apIncoming
+	if err := json.Unmarshal(accept.body, &activity); err != nil {
+		t.Fatal(err)
+	}
+	if activity.Type != "Accept" || activity.Actor != actorURL(aliceID) {
+		t.Errorf("activité livrée : %s", accept.body)
+	}
+	if accept.header.Get("Digest") != bodyDigest(accept.body) {
+		t.Error("l'empreinte Digest ne correspond pas au corps livré")
+	}
+	sig, err := parseSignature(accept.header.Get("Signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := signingString(http.MethodPost, accept.target, accept.host, accept.header, sig.Headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, public, err := s.Federation.Key(ctx, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySignature(&data.RemoteActor{KeyID: actorURL(aliceID) + "#main-key", PublicKey: public}, sig, signing); err != nil {
+		t.Errorf("signature de l'Accept : %v", err)
+	}
+
+	// Une cible inconnue est refusée
+	unknown := followActivity(rs, aliceID)
+	unknown["object"] = actorURL(aliceID + 100)
+	if w := postToInbox(inboxRequest(t, rs, unknown)); w.Code != http.StatusNotFound {
+		t.Errorf("Follow d'un acteur inconnu : statut %d, attendu 404", w.Code)
+	}
+}
+
+func TestInboxRejectsBadSignatures(t *testing.T) {
+	s := useFederation(t)
+	rs := newRemoteServer(t)
+	aliceID := createUser(t, "alice")
+	otherKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(r *http.Request)
+	}{
+		{"sans signature", func(r *http.Request) { r.Header.Del("Signature") }},
+		{"mauvaise empreinte", func(r *http.Request) {
+			r.Header.Set("Digest", bodyDigest([]byte("un autre corps")))
+			resign(t, r, rs.keyID(), rs.key, signedHeaders)
+		}},
+		{"date périmée", func(r *http.Request) {
+			r.Header.Set("Date", time.Now().Add(-signatureMaxSkew-time.Hour).UTC().Format(http.TimeFormat))
+			resign(t, r, rs.keyID(), rs.key, signedHeaders)
+		}},
+		{"date future", func(r *http.Request) {
+			r.Header.Set("Date", time.Now().Add(signatureMaxSkew+time.Hour).UTC().Format(http.TimeFormat))
+			resign(t, r, rs.keyID(), rs.key, signedHeaders)
+		}},
+		{"date non signée", func(r *http.Request) {
+			resign(t, r, rs.keyID(), rs.key, []string{"(request-target)", "host", "digest"})
+		}},
+		{"empreinte non signée", func(r *http.Request) {
+			resign(t, r, rs.keyID(), rs.key, []string{"(request-target)", "host", "date"})
+		}},
+		{"autre clé", func(r *http.Request) { resign(t, r, rs.keyID(), otherKey, signedHeaders) }},
+		{"date modifiée après signature", func(r *http.Request) {
+			r.Header.Set("Date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := inboxRequest(t, rs, followActivity(rs, aliceID))
+			tt.tamper(r)
+			w := postToInbox(r)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("statut %d, attendu 401", w.Code)
+			}
+			// La cause du refus n'est pas renvoyée à l'expéditeur
+			if body := strings.TrimSpace(w.Body.String()); body != "Signature refusée" {
+				t.Errorf("réponse %q, attendu %q", body, "Signature refusée")
+			}
+		})
+	}
+	followers, _ := s.Federation.Followers(context.Background(), aliceID)
+	if len(followers) != 0 {
+		t.Errorf("%d abonnés enregistrés malgré les refus", len(followers))
+	}
+
+	// Une activité signée par bob au nom d'un autre acteur est refusée
+	impostor := followActivity(rs, aliceID)
+	impostor["actor"] = rs.URL + "/users/carol"
+	if w := postToInbox(inboxRequest(t, rs, impostor)); w.Code != http.StatusUnauthorized {
+		t.Errorf("activité d'un autre acteur : statut %d, attendu 401", w.Code)
+	}
+}
+
+func TestInboxRemoteReplyBecomesComment(t *testing.T) {
+	s := useFederation(t)
+	rs := newRemoteServer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	postID, err := s.Posts.Create(ctx, &Post{Title: "Sujet fédéré", Content: "Répondez depuis Mastodon", UserID: aliceID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := func(noteID, inReplyTo string) *httptest.ResponseRecorder {
+		return postToInbox(inboxRequest(t, rs, map[string]interface{}{
+			"@context": activityStreams,
+			"id":       noteID + "/activity",
+			"type":     "Create",
+			"actor":    rs.actor(),
+			"object": map[string]interface{}{
+				"id":           noteID,
+				"type":         "Note",
+				"attributedTo": rs.actor(),
+				"content":      `<p>Bonjour <b>forum</b></p><p><script>alert(1)</script>fin</p>`,
+				"inReplyTo":    inReplyTo,
+				"published":    "2024-05-01T10:00:00Z",
+			},
+		}))
+	}
+
+	if w := reply(rs.URL+"/notes/1", postObjectURL(postID)); w.Code != http.StatusAccepted {
+		t.Fatalf("statut %d, attendu 202 : %s", w.Code, w.Body)
+	}
+	// La même note reçue une seconde fois, par une autre boîte, n'est pas dupliquée
+	if w := reply(rs.URL+"/notes/1", postObjectURL(postID)); w.Code != http.StatusAccepted {
+		t.Fatalf("statut %d, attendu 202 : %s", w.Code, w.Body)
+	}
+	// Une réponse à un contenu d'un autre serveur est ignorée
+	if w := reply(rs.URL+"/notes/2", "https://ailleurs.example/notes/9"); w.Code != http.StatusAccepted {
+		t.Fatalf("statut %d, attendu 202 : %s", w.Code, w.Body)
+	}
+
+	comments, err := s.Comments.ForPost(ctx, postID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 {
+		t.Fatalf("%d commentaires, attendu 1 : %+v", len(comments), comments)
+	}
+	c := comments[0]
+	if c.Content != "Bonjour forum\nfin" {
+		t.Errorf("contenu %q", c.Content)
+	}
+	if c.Username != "bob@"+hostOf(rs.URL) {
+		t.Errorf("auteur %q, attendu bob@%s", c.Username, hostOf(rs.URL))
+	}
+	if !c.Created.Valid || !c.Created.Time.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("date %v, attendu celle de la note", c.Created)
+	}
+	account, err := s.Federation.RemoteAccount(ctx, rs.actor())
+	if err != nil || account.ID != c.UserID || account.Email != "" {
+		t.Errorf("compte distant : %+v, %v", account, err)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::":    true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.0.0.1":             false,
+		"172.16.5.4":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"fe80::1":              false,
+		"fd00:ec2::254":        false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"224.0.0.1":            false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:169.254.1.1":   false,
+		"64:ff9b::a9fe:a9fe":   false,
+		"255.255.255.255":      false,
+		"::ffff:93.184.216.34": true,
+	}
+	for raw, want := range tests {
+		if got := isPublicAddress(netip.MustParseAddr(raw)); got != want {
+			t.Errorf("isPublicAddress(%s) = %v, attendu %v", raw, got, want)
+		}
+	}
+}
+
+func TestAPClientRefusesPrivateAddresses(t *testing.T) {
+	useFederation(t)
+	rs := newRemoteServer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	// Le comportement de production : seules les adresses publiques sont joignables
+	apAddressAllowed = isPublicAddress
+
+	// Un keyId sur la boucle locale n'est jamais téléchargé, et le refus reste générique
+	w := postToInbox(inboxRequest(t, rs, followActivity(rs, aliceID)))
+	if w.Code != http.StatusUnauthorized || strings.TrimSpace(w.Body.String()) != "Signature refusée" {
+		t.Errorf("statut %d, réponse %q", w.Code, w.Body)
+	}
+	if n := rs.fetched(); n != 0 {
+		t.Errorf("acteur téléchargé %d fois depuis une adresse privée", n)
+	}
+
+	if _, err := fetchDocument(ctx, rs.actor()); !errors.Is(err, errPrivateAddress) {
+		t.Errorf("fetchDocument : %v, attendu %v", err, errPrivateAddress)
+	}
+	for _, inbox := range []string{rs.actor() + "/inbox", "http://169.254.169.254/latest/meta-data/", "http://[::1]/inbox"} {
+		err := sendActivity(ctx, &data.ActivityDelivery{UserID: aliceID, Inbox: inbox, Activity: "{}"})
+		if !errors.Is(err, errPrivateAddress) {
+			t.Errorf("sendActivity vers %s : %v, attendu %v", inbox, err, errPrivateAddress)
+		}
+	}
+	if n := len(rs.received()); n != 0 {
+		t.Errorf("%d activités livrées à une adresse privée", n)
+	}
+}
@@ -0,0 +1,664 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	data "forum/Data"
+)
+
+// L'API JSON, versionnée sous /api/v1, applique les mêmes règles que les pages HTML : mêmes
+// sessions, même visibilité des contenus shadowbannés, mêmes sanctions et sujets fermés.
+//
+// Une réponse réussie enveloppe la ressource dans {"data": …} ; une liste y ajoute
+// "next_cursor" tant qu'il reste des éléments, à repasser en ?cursor= pour la page suivante.
+// Une erreur répond {"error": {"code": …, "message": …}}.
+const apiPrefix = "/api/v1/"
+
+const (
+	apiDefaultLimit = 20
+	apiMaxLimit     = 100
+)
+
+type apiEnvelope struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiAuthor struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type apiPost struct {
+	ID             int        `json:"id"`
+	Title          string     `json:"title"`
+	Content        string     `json:"content"`
+	Video          string     `json:"video,omitempty"`
+	Images         []string   `json:"images"`
+	Author         apiAuthor  `json:"author"`
+	Pinned         bool       `json:"pinned"`
+	Locked         bool       `json:"locked"`
+	Archived       bool       `json:"archived"`
+	Score          int        `json:"score"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	URL            string     `json:"url"`
+}
+
+type apiComment struct {
+	ID        int        `json:"id"`
+	PostID    int        `json:"post_id"`
+	Author    apiAuthor  `json:"author"`
+	Content   string     `json:"content"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// L'email n'est donné qu'au titulaire du compte
+type apiProfile struct {
+	ID             int    `json:"id"`
+	Username       string `json:"username"`
+	Email          string `json:"email,omitempty"`
+	ProfilePicture string `json:"profile_picture,omitempty"`
+	Role           string `json:"role"`
+	URL            string `json:"url"`
+}
+
+type apiVote struct {
+	PostID int `json:"post_id"`
+	Value  int `json:"value"`
+	Score  int `json:"score"`
+}
+
+// mediaURL retourne l'URL publique d'un fichier enregistré sous uploadURLPrefix
+func mediaURL(stored string) string {
+	if stored == "" {
+		return ""
+	}
+	return "/" + strings.ReplaceAll(stored, `\`, "/")
+}
+
+func newAPIPost(p *Post) apiPost {
+	post := apiPost{
+		ID: p.ID, Title: p.Title, Content: p.Content, Video: mediaURL(p.Video), Images: []string{},
+		Author: apiAuthor{ID: p.UserID, Username: p.Username}, Pinned: p.Pinned, Locked: p.Locked,
+		Archived: p.Archived, Score: p.Score, CreatedAt: p.Created, LastActivityAt: nullTimePtr(p.LastActivity),
+		URL: postURL(p.ID),
+	}
+	for _, image := range p.Image {
+		post.Images = append(post.Images, mediaURL(image))
+	}
+	return post
+}
+
+func newAPIComment(c *Comment) apiComment {
+	return apiComment{ID: c.ID, PostID: c.PostID, Author: apiAuthor{ID: c.UserID, Username: c.Username}, Content: c.Content, CreatedAt: nullTimePtr(c.Created)}
+}
+
+func newAPIProfile(u *User, self bool) apiProfile {
+	profile := apiProfile{ID: u.ID, Username: u.Username, ProfilePicture: mediaURL(u.ProfilePicture), Role: u.Role, URL: profileURL(u.Username)}
+	if self {
+		profile.Email = u.Email
+	}
+	return profile
+}
+
+// isAPIRequest indique si la requête vise l'API, dont les erreurs sont écrites en JSON
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Erreur lors de l'écriture de la réponse JSON:", err)
+	}
+}
+
+func apiError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, struct {
+		Error apiErrorBody `json:"error"`
+	}{apiErrorBody{Code: code, Message: message}})
+}
+
+// apiInternalError journalise l'erreur et répond sans en révéler le détail
+func apiInternalError(w http.ResponseWriter, message string, err error) {
+	log.Println(message+":", err)
+	apiError(w, http.StatusInternalServerError, "internal", message)
+}
+
+func apiMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	apiError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Méthode non autorisée")
+}
+
+// apiUser retourne l'utilisateur authentifié, ou répond 401. Un jeton doit en plus avoir
+// la portée scope ; une session les a toutes.
+func apiUser(w http.ResponseWriter, r *http.Request, scope string) (*User, bool) {
+	user, ok := sessionUser(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		apiError(w, http.StatusUnauthorized, "unauthorized", "Authentification requise")
+		return nil, false
+	}
+	if auth := requestToken(r); auth != nil && !auth.token.HasScope(scope) {
+		insufficientScope(w, scope)
+		return nil, false
+	}
+	return user, true
+}
+
+// decodeJSON lit le corps de la requête dans v, ou répond 400 ou 413
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil {
+		if _, extra := dec.Token(); extra != io.EOF {
+			err = errors.New("données après l'objet JSON")
+		}
+	}
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apiError(w, http.StatusRequestEntityTooLarge, "too_large", "Requête trop volumineuse")
+		return false
+	}
+	apiError(w, http.StatusBadRequest, "invalid_json", "Corps JSON invalide : "+err.Error())
+	return false
+}
+
+// Un curseur désigne l'ID du dernier élément de la page précédente, sous forme opaque
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(string(raw))
+	if err == nil && id <= 0 {
+		err = errors.New("curseur négatif")
+	}
+	return id, err
+}
+
+// pageParams lit ?cursor= et ?limit=, ou répond 400
+func pageParams(w http.ResponseWriter, r *http.Request) (cursor, limit int, ok bool) {
+	query := r.URL.Query()
+	cursor, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid_cursor", "Curseur invalide")
+		return 0, 0, false
+	}
+	limit = apiDefaultLimit
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > apiMaxLimit {
+			apiError(w, http.StatusBadRequest, "invalid_limit", "limit doit être compris entre 1 et "+strconv.Itoa(apiMaxLimit))
+			return 0, 0, false
+		}
+	}
+	return cursor, limit, true
+}
+
+// nextCursor retourne le curseur de la page suivante si la page est pleine
+func nextCursor(n, limit, lastID int) string {
+	if n < limit {
+		return ""
+	}
+	return encodeCursor(lastID)
+}
+
+// apiPathID lit l'ID en tête de rest, le reste du chemin étant retourné
+func apiPathID(rest string) (id int, tail string, ok bool) {
+	head, tail, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(head)
+	return id, tail, err == nil && id > 0
+}
+
+// canEdit applique la règle de modification : l'auteur tant que le sujet est ouvert,
+// les modérateurs toujours
+func canEdit(user *User, authorID int, locked, archived bool) bool {
+	if user.IsModerator() {
+		return true
+	}
+	return user.ID == authorID && !locked && !archived
+}
+
+type apiPostInput struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+// validatePostInput vérifie les champs fournis ; à la création, les deux sont obligatoires
+func validatePostInput(w http.ResponseWriter, in *apiPostInput, create bool) bool {
+	if create && (in.Title == nil || in.Content == nil) {
+		apiError(w, http.StatusUnprocessableEntity, "validation_failed", "title et content sont obligatoires")
+		return false
+	}
+	if in.Title != nil && strings.TrimSpace(*in.Title) == "" {
+		apiError(w, http.StatusUnprocessableEntity, "validation_failed", "Le titre ne peut pas être vide")
+		return false
+	}
+	if in.Content != nil && strings.TrimSpace(*in.Content) == "" {
+		apiError(w, http.StatusUnprocessableEntity, "validation_failed", "Le contenu ne peut pas être vide")
+		return false
+	}
+	return true
+}
+
+type apiCommentInput struct {
+	Content string `json:"content"`
+}
+
+type apiVoteInput struct {
+	Value int `json:"value"`
+}
+
+// apiPostsHandler sert /api/v1/posts : liste paginée, recherche par ?q= et création
+type apiPostsHandler struct{}
+
+func (h *apiPostsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		var posts []Post
+		var err error
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q != "" {
+			posts, err = store.Posts.Search(r.Context(), q, viewerID(r), limit)
+		} else {
+			posts, err = store.Posts.Page(r.Context(), viewerID(r), cursor, limit)
+		}
+		if err != nil {
+			apiInternalError(w, "Erreur lors de la récupération des posts", err)
+			return
+		}
+		list := make([]apiPost, 0, len(posts))
+		for i := range posts {
+			list = append(list, newAPIPost(&posts[i]))
+		}
+		envelope := apiEnvelope{Data: list}
+		// La recherche trie par pertinence : elle n'a qu'une page
+		if q == "" && len(posts) > 0 {
+			envelope.NextCursor = nextCursor(len(posts), limit, posts[len(posts)-1].ID)
+		}
+		writeJSON(w, http.StatusOK, envelope)
+	case http.MethodPost:
+		user, ok := apiUser(w, r, scopePosts)
+		if !ok || !requireVerified(w, r, user) {
+			return
+		}
+		var in apiPostInput
+		if !decodeJSON(w, r, &in) || !validatePostInput(w, &in, true) {
+			return
+		}
+		id, err := store.Posts.Create(r.Context(), &Post{Title: *in.Title, Content: *in.Content, UserID: user.ID})
+		if err != nil {
+			apiInternalError(w, "Erreur lors de la création du post", err)
+			return
+		}
+		post, err := store.Posts.Get(r.Context(), id, user.ID)
+		if err != nil {
+			apiInternalError(w, "Erreur lors de la récupération du post", err)
+			return
+		}
+		emitPostCreated(r.Context(), user, id)
+		federatePost(r.Context(), user, id)
+		w.Header().Set("Location", apiPrefix+"posts/"+strconv.Itoa(id))
+		writeJSON(w, http.StatusCreated, apiEnvelope{Data: newAPIPost(post)})
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// apiPostHandler sert /api/v1/posts/{id} et ses sous-ressources comments et vote
+type apiPostHandler struct{}
+
+func (h *apiPostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := apiPathID(strings.TrimPrefix(r.URL.Path, apiPrefix+"posts/"))
+	if !ok {
+		apiError(w, http.StatusNotFound, "not_found", "Post non trouvé")
+		return
+	}
+	switch sub {
+	case "":
+		h.post(w, r, id)
+	case "comments":
+		h.comments(w, r, id)
+	case "vote":
+		h.vote(w, r, id)
+	default:
+		apiError(w, http.StatusNotFound, "not_found", "Ressource inconnue")
+	}
+}
+
+// visiblePost retourne le sujet tel que le voit l'utilisateur, ou répond 404
+func visiblePost(w http.ResponseWriter, r *http.Request, id, viewer int) (*Post, bool) {
+	post, err := store.Posts.Get(r.Context(), id, viewer)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			apiError(w, http.StatusNotFound, "not_found", "Post non trouvé")
+			return nil, false
+		}
+		apiInternalError(w, "Erreur lors de la récupération du post", err)
+		return nil, false
+	}
+	return post, true
+}
+
+func (h *apiPostHandler) post(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		post, ok := visiblePost(w, r, id, viewerID(r))
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, apiEnvelope{Data: newAPIPost(post)})
+	case http.MethodPatch:
+		user, ok := apiUser(w, r, scopePosts)
+		if !ok {
+			return
+		}
+		post, ok := visiblePost(w, r, id, user.ID)
+		if !ok {
+			return
+		}
+		if !canEdit(user, post.UserID, post.Locked, post.Archived) {
+			apiError(w, http.StatusForbidden, "forbidden", "Vous ne pouvez pas modifier ce post")
+			return
+		}
+		var in apiPostInput
+		if !decodeJSON(w, r, &in) || !validatePostInput(w, &in, false) {
+			return
+		}
+		if in.Title != nil {
+			post.Title = *in.Title
+		}
+		if in.Content != nil {
+			post.Content = *in.Content
+		}
+		if err := store.Posts.Update(r.Context(), id, post.Title, post.Content); err != nil {
+			apiInternalError(w, "Erreur lors de la modification du post", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiEnvelope{Data: newAPIPost(post)})
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPatch)
+	}
+}
+
+func (h *apiPostHandler) comments(w http.ResponseWriter, r *http.Request, postID int) {
+	switch r.Method {
+	case http.MethodGet:
+		viewer := viewerID(r)
+		if _, ok := visiblePost(w, r, postID, viewer); !ok {
+			return
+		}
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		comments, err := store.Comments.Page(r.Context(), postID, viewer, cursor, limit)
+		if err != nil {
+			apiInternalError(w, "Erreur lors de la récupération des commentaires", err)
+			return
+		}
+		list := make([]apiComment, 0, len(comments))
+		for i := range comments {
+			list = append(list, newAPIComment(&comments[i]))
+		}
+		envelope := apiEnvelope{Data: list}
+		if len(comments) > 0 {
+			envelope.NextCursor = nextCursor(len(comments), limit, comments[len(comments)-1].ID)
+		}
+		writeJSON(w, http.StatusOK, envelope)
+	case http.MethodPost:
+		user, ok := apiUser(w, r, scopeComments)
+		if !ok || !requireVerified(w, r, user) {
+			return
+		}
+		locked, archived, err := store.Posts.State(r.Context(), postID)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				apiError(w, http.StatusNotFound, "not_found", "Post non trouvé")
+				return
+			}
+			apiInternalError(w, "Erreur lors de la récupération du post", err)
+			return
+		}
+		if locked || archived {
+			apiError(w, http.StatusForbidden, "thread_closed", "Ce sujet est fermé aux nouveaux commentaires")
+			return
+		}
+		var in apiCommentInput
+		if !decodeJSON(w, r, &in) {
+			return
+		}
+		if strings.TrimSpace(in.Content) == "" {
+			apiError(w, http.StatusUnprocessableEntity, "validation_failed", "Le commentaire ne peut pas être vide")
+			return
+		}
+		comment := &Comment{PostID: postID, UserID: user.ID, Username: user.Username, Content: in.Content}
+		comment.ID, err = store.Comments.Create(r.Context(), comment)
+		if err != nil {
+			apiInternalError(w, "Erreur lors de l'ajout du commentaire", err)
+			return
+		}
+		if err := store.Posts.Touch(r.Context(), postID); err != nil {
+			log.Println("Erreur lors de la mise à jour de l'activité du post:", err)
+		}
+		emitCommentCreated(r.Context(), user, comment)
+		federateComment(r.Context(), user, comment)
+		w.Header().Set("Location", apiPrefix+"comments/"+strconv.Itoa(comment.ID))
+		writeJSON(w, http.StatusCreated, apiEnvelope{Data: newAPIComment(comment)})
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// vote lit, remplace ou retire le vote de l'utilisateur. Un sujet archivé n'accepte plus de vote.
+func (h *apiPostHandler) vote(w http.ResponseWriter, r *http.Request, postID int) {
+	scope := scopeVotes
+	if r.Method == http.MethodGet {
+		scope = scopeRead
+	}
+	user, ok := apiUser(w, r, scope)
+	if !ok {
+		return
+	}
+	post, ok := visiblePost(w, r, postID, user.ID)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodDelete:
+		if post.Archived {
+			apiError(w, http.StatusForbidden, "thread_closed", "Ce sujet est archivé")
+			return
+		}
+		var err error
+		if r.Method == http.MethodPut {
+			var in apiVoteInput
+			if !decodeJSON(w, r, &in) {
+				return
+			}
+			if in.Value != 1 && in.Value != -1 {
+				apiError(w, http.StatusUnprocessableEntity, "validation_failed", "value doit valoir 1 ou -1")
+				return
+			}
+			err = store.Votes.Set(ctx, user.ID, postID, in.Value)
+		} else {
+			err = store.Votes.Remove(ctx, user.ID, postID)
+		}
+		if err != nil {
+			apiInternalError(w, "Erreur lors de l'enregistrement du vote", err)
+			return
+		}
+		if post, ok = visiblePost(w, r, postID, user.ID); !ok {
+			return
+		}
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		return
+	}
+	value, err := store.Votes.Of(ctx, user.ID, postID)
+	if err != nil {
+		apiInternalError(w, "Erreur lors de la récupération du vote", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiEnvelope{Data: apiVote{PostID: postID, Value: value, Score: post.Score}})
+}
+
+// apiCommentHandler sert /api/v1/comments/{id}
+type apiCommentHandler struct{}
+
+func (h *apiCommentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := apiPathID(strings.TrimPrefix(r.URL.Path, apiPrefix+"comments/"))
+	if !ok || sub != "" {
+		apiError(w, http.StatusNotFound, "not_found", "Commentaire non trouvé")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		comment, ok := visibleComment(w, r, id, viewerID(r))
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, apiEnvelope{Data: newAPIComment(comment)})
+	case http.MethodPatch:
+		user, ok := apiUser(w, r, scopeComments)
+		if !ok {
+			return
+		}
+		comment, ok := visibleComment(w, r, id, user.ID)
+		if !ok {
+			return
+		}
+		locked, archived, err := store.Posts.State(r.Context(), comment.PostID)
+		if err != nil && !errors.Is(err, data.ErrNotFound) {
+			apiInternalError(w, "Erreur lors de la récupération du post", err)
+			return
+		}
+		if !canEdit(user, comment.UserID, locked, archived) {
+			apiError(w, http.StatusForbidden, "forbidden", "Vous ne pouvez pas modifier ce commentaire")
+			return
+		}
+		var in apiCommentInput
+		if !decodeJSON(w, r, &in) {
+			return
+		}
+		if strings.TrimSpace(in.Content) == "" {
+			apiError(w, http.StatusUnprocessableEntity, "validation_failed", "Le commentaire ne peut pas être vide")
+			return
+		}
+		if err := store.Comments.Update(r.Context(), id, in.Content); err != nil {
+			apiInternalError(w, "Erreur lors de la modification du commentaire", err)
+			return
+		}
+		comment.Content = in.Content
+		writeJSON(w, http.StatusOK, apiEnvelope{Data: newAPIComment(comment)})
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPatch)
+	}
+}
+
+func visibleComment(w http.ResponseWriter, r *http.Request, id, viewer int) (*Comment, bool) {
+	comment, err := store.Comments.Get(r.Context(), id, viewer)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			apiError(w, http.StatusNotFound, "not_found", "Commentaire non trouvé")
+			return nil, false
+		}
+		apiInternalError(w, "Erreur lors de la récupération du commentaire", err)
+		return nil, false
+	}
+	return comment, true
+}
+
+// apiUserHandler sert /api/v1/users/{username}, le profil public d'un utilisateur
+type apiUserHandler struct{}
+
+func (h *apiUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	username := strings.TrimPrefix(r.URL.Path, apiPrefix+"users/")
+	user, err := store.Users.ByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			apiError(w, http.StatusNotFound, "not_found", "Utilisateur non trouvé")
+			return
+		}
+		apiInternalError(w, "Erreur lors de la récupération de l'utilisateur", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiEnvelope{Data: newAPIProfile(user, viewerID(r) == user.ID)})
+}
+
+// apiMeHandler sert /api/v1/me, le profil de l'utilisateur authentifié
+type apiMeHandler struct{}
+
+func (h *apiMeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	user, ok := apiUser(w, r, scopeRead)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, apiEnvelope{Data: newAPIProfile(user, true)})
+}
+
+// Description OpenAPI 3 de l'API, à tenir à jour avec ses gestionnaires
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// apiSpecHandler sert /api/openapi.json
+type apiSpecHandler struct{}
+
+func (h *apiSpecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openAPISpec)
+}
+
+// apiNotFoundHandler répond aux chemins inconnus de l'API
+type apiNotFoundHandler struct{}
+
+func (h *apiNotFoundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apiError(w, http.StatusNotFound, "not_found", "Ressource inconnue")
+}
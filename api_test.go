@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openAPIDoc est openapi.json décodé, avec de quoi retrouver l'opération d'une requête et
+// valider une réponse contre son schéma. Seul le sous-ensemble de JSON Schema employé par le
+// document est pris en charge ; un mot-clé inconnu fait échouer le test plutôt que de passer.
+type openAPIDoc struct {
+	root   map[string]interface{}
+	prefix string
+}
+
+func loadOpenAPI(t *testing.T) *openAPIDoc {
+	t.Helper()
+	var root map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &root); err != nil {
+		t.Fatal(err)
+	}
+	servers := root["servers"].([]interface{})
+	return &openAPIDoc{root: root, prefix: servers[0].(map[string]interface{})["url"].(string)}
+}
+
+// resolve suit un $ref local, éventuellement en chaîne
+func (d *openAPIDoc) resolve(node map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var cur interface{} = d.root
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			cur = cur.(map[string]interface{})[part]
+		}
+		node = cur.(map[string]interface{})
+	}
+}
+
+// operations retourne les operationId du document, triés
+func (d *openAPIDoc) operations() []string {
+	var ids []string
+	for _, item := range d.root["paths"].(map[string]interface{}) {
+		for _, op := range item.(map[string]interface{}) {
+			if op, ok := op.(map[string]interface{}); ok {
+				if id, ok := op["operationId"].(string); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// operation retrouve l'opération documentée pour la méthode et le chemin
+func (d *openAPIDoc) operation(method, path string) (map[string]interface{}, bool) {
+	path = strings.TrimPrefix(path, d.prefix)
+	for template, item := range d.root["paths"].(map[string]interface{}) {
+		pattern := "^" + regexp.MustCompile(`\\\{[^}]+\\\}`).ReplaceAllString(regexp.QuoteMeta(template), "[^/]+") + "$"
+		if regexp.MustCompile(pattern).MatchString(path) {
+			op, ok := item.(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+			return op, ok
+		}
+	}
+	return nil, false
+}
+
+// validate vérifie value contre schema et retourne les écarts, préfixés de leur chemin
+func (d *openAPIDoc) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	schema = d.resolve(schema)
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, at+" : "+fmt.Sprintf(format, args...))
+	}
+	for key := range schema {
+		switch key {
+		case "type", "properties", "required", "items", "enum", "format", "minimum", "maximum",
+			"minLength", "additionalProperties", "description", "default":
+		default:
+			fail("mot-clé %q non pris en charge par le test", key)
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || e == value
+		}
+		if !found {
+			fail("%v hors de %v", value, enum)
+		}
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("objet attendu, reçu %T", value)
+			return errs
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				fail("propriété %q manquante", name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := props[name].(map[string]interface{})
+			if !ok {
+				// Une réponse ne doit pas exposer de champ non documenté
+				fail("propriété %q non documentée", name)
+				continue
+			}
+			errs = append(errs, d.validate(prop, v, at+"."+name)...)
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			fail("tableau attendu, reçu %T", value)
+			return errs
+		}
+		for i, v := range arr {
+			errs = append(errs, d.validate(schema["items"].(map[string]interface{}), v, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("chaîne attendue, reçu %T", value)
+			return errs
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				fail("date %q invalide", s)
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			fail("entier attendu, reçu %v", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("booléen attendu, reçu %T", value)
+		}
+	default:
+		fail("type %v non pris en charge par le test", schema["type"])
+	}
+	return errs
+}
+
+// checkResponse vérifie que le statut est documenté pour l'opération et que le corps et les
+// en-têtes respectent la réponse décrite
+func (d *openAPIDoc) checkResponse(t *testing.T, op map[string]interface{}, resp *http.Response, body []byte) {
+	t.Helper()
+	responses := op["responses"].(map[string]interface{})
+	documented, ok := responses[fmt.Sprint(resp.StatusCode)].(map[string]interface{})
+	if !ok {
+		t.Errorf("statut %d non documenté pour %s : %s", resp.StatusCode, op["operationId"], body)
+		return
+	}
+	documented = d.resolve(documented)
+	if headers, ok := documented["headers"].(map[string]interface{}); ok {
+		for name := range headers {
+			if resp.Header.Get(name) == "" {
+				t.Errorf("en-tête %s manquant", name)
+			}
+		}
+	}
+	content, ok := documented["content"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type %q, attendu application/json", ct)
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Errorf("corps JSON invalide : %v : %s", err, body)
+		return
+	}
+	schema := content["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	for _, e := range d.validate(schema, value, "corps") {
+		t.Error(e)
+	}
+}
+
+// checkRequest valide un corps de requête contre le schéma de l'opération, pour que le test
+// n'envoie que des requêtes conformes lorsqu'il attend un succès
+func (d *openAPIDoc) checkRequest(t *testing.T, op map[string]interface{}, body interface{}) {
+	t.Helper()
+	requestBody, ok := op["requestBody"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	raw, _ := json.Marshal(body)
+	var value interface{}
+	json.Unmarshal(raw, &value)
+	schema := requestBody["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	for _, e := range d.validate(schema, value, "requête") {
+		t.Error(e)
+	}
+}
+
+// apiTestUser crée un compte et retourne son ID et un jeton de toutes les portées
+func apiTestUser(t *testing.T, username string) (int, string) {
+	t.Helper()
+	id := createUser(t, username)
+	verifyUser(t, id)
+	return id, createToken(t, id, []string{scopeRead, scopePosts, scopeComments, scopeVotes}, time.Now().Add(time.Hour))
+}
+
+func TestAPIConformsToOpenAPI(t *testing.T) {
+	openTestDatabase(t)
+	_, alice := apiTestUser(t, "alice")
+	_, bob := apiTestUser(t, "bob")
+	srv := newAPIServer(t)
+	doc := loadOpenAPI(t)
+
+	// Les appels s'enchaînent : le sujet 1 et le commentaire 1 sont créés par les premiers
+	calls := []struct {
+		method, path, token string
+		body                interface{}
+		status              int
+	}{
+		{"POST", "/posts", alice, map[string]string{"title": "Premier sujet", "content": "Du **Markdown**"}, 201},
+		{"POST", "/posts", "", map[string]string{"title": "Anonyme", "content": "Refusé"}, 401},
+		{"POST", "/posts", alice, map[string]string{"title": "", "content": "Sans titre"}, 422},
+		{"POST", "/posts", alice, "pas un objet", 400},
+		{"GET", "/posts", "", nil, 200},
+		{"GET", "/posts?limit=1&q=sujet", alice, nil, 200},
+		{"GET", "/posts?limit=abc", "", nil, 400},
+		{"GET", "/posts/1", "", nil, 200},
+		{"GET", "/posts/99", "", nil, 404},
+		{"PATCH", "/posts/1", alice, map[string]string{"title": "Premier sujet, modifié"}, 200},
+		{"PATCH", "/posts/1", bob, map[string]string{"title": "Pas le mien"}, 403},
+		{"POST", "/posts/1/comments", bob, map[string]string{"content": "Une réponse"}, 201},
+		{"POST", "/posts/99/comments", bob, map[string]string{"content": "Perdue"}, 404},
+		{"GET", "/posts/1/comments", "", nil, 200},
+		{"GET", "/posts/99/comments", "", nil, 404},
+		{"GET", "/comments/1", "", nil, 200},
+		{"GET", "/comments/99", "", nil, 404},
+		{"PATCH", "/comments/1", bob, map[string]string{"content": "Une réponse corrigée"}, 200},
+		{"PATCH", "/comments/1", alice, map[string]string{"content": "Pas la mienne"}, 403},
+		{"GET", "/posts/1/vote", bob, nil, 200},
+		{"GET", "/posts/1/vote", "", nil, 401},
+		{"PUT", "/posts/1/vote", bob, map[string]int{"value": 1}, 200},
+		{"PUT", "/posts/1/vote", bob, map[string]int{"value": 2}, 422},
+		{"DELETE", "/posts/1/vote", bob, nil, 200},
+		{"GET", "/users/alice", "", nil, 200},
+		{"GET", "/users/personne", "", nil, 404},
+		{"GET", "/me", alice, nil, 200},
+		{"GET", "/me", "", nil, 401},
+	}
+
+	exercised := map[string]bool{}
+	for _, c := range calls {
+		t.Run(c.method+" "+c.path+" "+fmt.Sprint(c.status), func(t *testing.T) {
+			path := doc.prefix + c.path
+			op, ok := doc.operation(c.method, strings.SplitN(path, "?", 2)[0])
+			if !ok {
+				t.Fatalf("opération non documentée")
+			}
+			exercised[op["operationId"].(string)] = true
+
+			var body io.Reader
+			if c.body != nil {
+				if c.status < 300 {
+					doc.checkRequest(t, op, c.body)
+				}
+				raw, _ := json.Marshal(c.body)
+				body = bytes.NewReader(raw)
+			}
+			req, _ := http.NewRequest(c.method, srv.URL+path, body)
+			if c.body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if c.token != "" {
+				req.Header.Set("Authorization", "Bearer "+c.token)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			raw, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != c.status {
+				t.Fatalf("statut %d, attendu %d : %s", resp.StatusCode, c.status, raw)
+			}
+			doc.checkResponse(t, op, resp, raw)
+		})
+	}
+
+	for _, id := range doc.operations() {
+		if !exercised[id] {
+			t.Errorf("opération %s documentée mais jamais appelée", id)
+		}
+	}
+}
+
+func TestAPIServesOpenAPIDocument(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&apiSpecHandler{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), openAPISpec) {
+		t.Fatalf("statut %d, document servi différent de openapi.json", w.Code)
+	}
+	if ops := loadOpenAPI(t).operations(); len(ops) != 13 {
+		t.Errorf("%d opérations documentées : %v", len(ops), ops)
+	}
+}
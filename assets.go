@@ -0,0 +1,88 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+)
+
+// Les gabarits, feuilles de style, scripts et images de l'interface sont compilés dans le
+// binaire. Seules les images réellement utilisées par l'interface sont embarquées.
+//
+//go:embed src static
+//go:embed images/GC64WCgWAAAR8Au.png images/telecharge_19-removebg-preview(1).png
+var embeddedAssets embed.FS
+
+// overlayFS cherche chaque fichier dans ses couches successives : un thème sur disque
+// peut ainsi remplacer n'importe quel fichier embarqué en reprenant son chemin.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir fusionne le contenu du répertoire dans toutes les couches, la première l'emportant
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	var entries []fs.DirEntry
+	found := false
+	for _, layer := range o {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// loadAssets retourne les fichiers de l'interface, surchargés par ceux du thème s'il y en a un.
+// En mode développement, src, static et images sont lus dans le répertoire courant avant le
+// binaire : une modification des fichiers du dépôt est visible sans recompiler.
+func loadAssets(themeDir string, dev bool) fs.FS {
+	var layers overlayFS
+	if themeDir != "" {
+		layers = append(layers, os.DirFS(themeDir))
+	}
+	if dev {
+		layers = append(layers, os.DirFS("."))
+	}
+	if len(layers) == 0 {
+		return embeddedAssets
+	}
+	return append(layers, embeddedAssets)
+}
+
+// subAssets retourne le sous-répertoire dir des fichiers de l'interface
+func subAssets(assets fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(assets, dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return sub
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	data "forum/Data"
+	"forum/config"
+)
+
+// Une sauvegarde est une archive tar.gz contenant la base sous backupDatabaseEntry et les
+// fichiers envoyés sous uploadURLPrefix/, comme dans les chemins enregistrés en base.
+const backupDatabaseEntry = "forum.db"
+
+// Préfixe des sauvegardes programmées, les seules supprimées par la rotation
+const scheduledBackupPrefix = "forum-auto-"
+
+func backupFileName(prefix string, t time.Time) string {
+	return prefix + t.Format("20060102-150405") + ".tar.gz"
+}
+
+// createBackup écrit dans dest une copie cohérente de la base et des fichiers envoyés
+func createBackup(ctx context.Context, db *sql.DB, uploadDir, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	snapshot := dest + ".db.tmp"
+	os.Remove(snapshot)
+	defer os.Remove(snapshot)
+	if err := data.BackupSQLite(ctx, db, snapshot); err != nil {
+		return err
+	}
+
+	tmp := dest + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := writeBackupArchive(f, snapshot, uploadDir); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func writeBackupArchive(w io.Writer, snapshot, uploadDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := addArchiveFile(tw, snapshot, backupDatabaseEntry); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(uploadDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == uploadDir {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(uploadDir, p)
+		if err != nil {
+			return err
+		}
+		return addArchiveFile(tw, p, path.Join(uploadURLPrefix, filepath.ToSlash(rel)))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addArchiveFile(tw *tar.Writer, file, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// restoreBackup remplace la base et complète le répertoire des fichiers envoyés à partir
+// d'une archive. L'ancienne base est gardée à côté, suffixée par .avant-restauration.
+func restoreBackup(archive, dbPath, uploadDir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s n'est pas une sauvegarde : %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	// La base est la première entrée : rien n'est extrait d'une archive qui n'en contient pas
+	header, err := tr.Next()
+	if err != nil || header.Name != backupDatabaseEntry {
+		return fmt.Errorf("%s n'est pas une sauvegarde : %s manquant", archive, backupDatabaseEntry)
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return err
+	}
+	restored := dbPath + ".restauration"
+	if err := extractFile(tr, restored); err != nil {
+		return err
+	}
+	defer os.Remove(restored)
+	if err := checkRestoredDatabase(restored); err != nil {
+		return err
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rel, ok := strings.CutPrefix(header.Name, uploadURLPrefix+"/")
+		if !ok || !filepath.IsLocal(rel) || header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("entrée inattendue dans la sauvegarde : %s", header.Name)
+		}
+		if err := extractFile(tr, filepath.Join(uploadDir, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := os.Rename(dbPath, dbPath+".avant-restauration"); err != nil {
+			return err
+		}
+	}
+	return os.Rename(restored, dbPath)
+}
+
+func extractFile(r io.Reader, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// checkRestoredDatabase refuse une base extraite corrompue avant qu'elle ne remplace l'actuelle
+func checkRestoredDatabase(file string) error {
+	db, err := data.Open(data.SQLite, file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	problems, err := data.IntegrityCheck(context.Background(), db)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("la base sauvegardée est corrompue : %s", strings.Join(problems, " ; "))
+	}
+	return nil
+}
+
+// scheduleBackups sauvegarde la base à intervalle régulier et ne garde que les keep dernières
+func scheduleBackups(db *sql.DB, c *config.Config) {
+	ticker := time.NewTicker(time.Duration(c.BackupIntervalHours) * time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		dest := filepath.Join(c.BackupDir, backupFileName(scheduledBackupPrefix, time.Now()))
+		if err := createBackup(context.Background(), db, c.UploadDir, dest); err != nil {
+			log.Println("Erreur lors de la sauvegarde programmée:", err)
+			continue
+		}
+		log.Println("Sauvegarde écrite dans", dest)
+		if err := rotateBackups(c.BackupDir, c.BackupKeep); err != nil {
+			log.Println("Erreur lors de la rotation des sauvegardes:", err)
+		}
+	}
+}
+
+// rotateBackups supprime les sauvegardes programmées les plus anciennes au-delà de keep
+func rotateBackups(dir string, keep int) error {
+	backups, err := filepath.Glob(filepath.Join(dir, scheduledBackupPrefix+"*.tar.gz"))
+	if err != nil {
+		return err
+	}
+	// L'horodatage du nom se trie dans l'ordre chronologique
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// checkMedia compare les fichiers envoyés aux chemins enregistrés en base
+func checkMedia(paths []string, uploadDir string) (missing, orphaned []string, err error) {
+	referenced := map[string]bool{}
+	for _, p := range paths {
+		rel := strings.TrimPrefix(p, uploadURLPrefix+"/")
+		referenced[rel] = true
+		if _, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(rel))); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, p)
+		}
+	}
+
+	err = filepath.WalkDir(uploadDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == uploadDir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(uploadDir, p)
+		if err != nil {
+			return err
+		}
+		if !referenced[filepath.ToSlash(rel)] {
+			orphaned = append(orphaned, p)
+		}
+		return nil
+	})
+	return missing, orphaned, err
+}
+
+func runBackup(args []string) {
+	var dest string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		dest, args = args[0], args[1:]
+	}
+	c := loadConfig("backup", args)
+	if c.DatabaseDriver != data.SQLite {
+		log.Fatal(data.ErrSQLiteOnly)
+	}
+	if dest == "" {
+		dest = filepath.Join(c.BackupDir, backupFileName("forum-", time.Now()))
+	}
+
+	db, err := data.Open(c.DatabaseDriver, c.DatabaseSource())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := createBackup(context.Background(), db, c.UploadDir, dest); err != nil {
+		log.Fatal("Sauvegarde impossible : ", err)
+	}
+	fmt.Println("Sauvegarde écrite dans", dest)
+}
+
+func runRestore(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, "Utilisation : forum restore <sauvegarde.tar.gz> [options]\n")
+		os.Exit(2)
+	}
+	archive := args[0]
+	c := loadConfig("restore", args[1:])
+	if c.DatabaseDriver != data.SQLite {
+		log.Fatal(data.ErrSQLiteOnly)
+	}
+	if err := restoreBackup(archive, c.DatabasePath, c.UploadDir); err != nil {
+		log.Fatal("Restauration impossible : ", err)
+	}
+	fmt.Printf("Base %s et fichiers de %s restaurés depuis %s\n", c.DatabasePath, c.UploadDir, archive)
+}
+
+func runCheck(args []string) {
+	c := loadConfig("check", args)
+	db, err := data.Open(c.DatabaseDriver, c.DatabaseSource())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	healthy := true
+	report := func(title string, problems []string) {
+		if len(problems) == 0 {
+			fmt.Printf("%s : ok\n", title)
+			return
+		}
+		healthy = false
+		fmt.Printf("%s : %d problème(s)\n", title, len(problems))
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+	}
+
+	problems, err := data.IntegrityCheck(ctx, db)
+	switch {
+	case errors.Is(err, data.ErrSQLiteOnly):
+		fmt.Println("Intégrité de la base : non vérifiée hors SQLite")
+	case err != nil:
+		log.Fatal(err)
+	default:
+		report("Intégrité de la base", problems)
+	}
+
+	orphans, err := data.Orphans(ctx, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var lines []string
+	for _, o := range orphans {
+		lines = append(lines, o.String())
+	}
+	report("Lignes orphelines", lines)
+
+	paths, err := data.MediaPaths(ctx, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	missing, orphaned, err := checkMedia(paths, c.UploadDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report("Fichiers manquants", missing)
+	report("Fichiers orphelins", orphaned)
+
+	if !healthy {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// Date des sauvegardes créées par les tests
+var backupDate = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// writeUpload crée un fichier envoyé sous uploadDir
+func writeUpload(t *testing.T, uploadDir, name, content string) {
+	t.Helper()
+	file := filepath.Join(uploadDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	db := openTestDatabase(t)
+	aliceID := createUser(t, "alice")
+	createPost(t, aliceID, "Sauvegardé")
+	uploadDir := t.TempDir()
+	writeUpload(t, uploadDir, "photo.png", "image")
+	writeUpload(t, uploadDir, "2024/video.mp4", "vidéo")
+
+	archive := filepath.Join(t.TempDir(), "sauvegardes", backupFileName("forum-", backupDate))
+	if err := createBackup(context.Background(), db, uploadDir, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// La restauration remplace une base existante et garde l'ancienne à côté
+	target := t.TempDir()
+	dbPath := filepath.Join(target, "forum.db")
+	if err := os.WriteFile(dbPath, []byte("ancienne base"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restoredUploads := filepath.Join(target, "img_video")
+	if err := restoreBackup(archive, dbPath, restoredUploads); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err := os.ReadFile(dbPath + ".avant-restauration"); err != nil || string(previous) != "ancienne base" {
+		t.Errorf("ancienne base non conservée : %q, %v", previous, err)
+	}
+
+	restored, err := data.Open(data.SQLite, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var title string
+	if err := restored.QueryRow("SELECT title FROM posts WHERE user_id = ?", aliceID).Scan(&title); err != nil || title != "Sauvegardé" {
+		t.Errorf("sujet restauré : %q, %v", title, err)
+	}
+	for name, want := range map[string]string{"photo.png": "image", "2024/video.mp4": "vidéo"} {
+		if got, err := os.ReadFile(filepath.Join(restoredUploads, filepath.FromSlash(name))); err != nil || string(got) != want {
+			t.Errorf("%s restauré : %q, %v", name, got, err)
+		}
+	}
+}
+
+// writeArchive écrit une archive tar.gz avec les entrées données, dans l'ordre
+func writeArchive(t *testing.T, entries [][2]string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "archive.tar.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0644, Size: int64(len(e[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestRestoreRejectsInvalidArchives(t *testing.T) {
+	db := openTestDatabase(t)
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := data.BackupSQLite(context.Background(), db, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][][2]string{
+		"sans base":          {{uploadURLPrefix + "/photo.png", "image"}},
+		"base corrompue":     {{backupDatabaseEntry, "pas une base SQLite"}},
+		"chemin hors upload": {{backupDatabaseEntry, string(valid)}, {"../../etc/passwd", "x"}},
+		"remontée":           {{backupDatabaseEntry, string(valid)}, {uploadURLPrefix + "/../../évadé", "x"}},
+	}
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			target := t.TempDir()
+			dbPath := filepath.Join(target, "forum.db")
+			if err := os.WriteFile(dbPath, []byte("base actuelle"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := restoreBackup(writeArchive(t, entries), dbPath, filepath.Join(target, "img_video")); err == nil {
+				t.Fatal("archive acceptée")
+			}
+			if current, _ := os.ReadFile(dbPath); string(current) != "base actuelle" {
+				t.Error("la base actuelle a été remplacée")
+			}
+		})
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	var names []string
+	for i := 0; i < 5; i++ {
+		name := backupFileName(scheduledBackupPrefix, backupDate.AddDate(0, 0, i))
+		names = append(names, name)
+		writeUpload(t, dir, name, "sauvegarde")
+	}
+	// Les sauvegardes manuelles ne sont jamais supprimées
+	manual := backupFileName("forum-", backupDate)
+	writeUpload(t, dir, manual, "sauvegarde")
+
+	if err := rotateBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, e := range entries {
+		kept = append(kept, e.Name())
+	}
+	if want := []string{manual, names[3], names[4]}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("sauvegardes gardées %v, attendu %v", kept, want)
+	}
+}
+
+func TestCheckMedia(t *testing.T) {
+	uploadDir := t.TempDir()
+	writeUpload(t, uploadDir, "utilise.png", "image")
+	writeUpload(t, uploadDir, "oublie.png", "image")
+
+	missing, orphaned, err := checkMedia([]string{uploadURLPrefix + "/utilise.png", uploadURLPrefix + "/disparu.mp4"}, uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(missing, []string{uploadURLPrefix + "/disparu.mp4"}) {
+		t.Errorf("fichiers manquants %v", missing)
+	}
+	if len(orphaned) != 1 || !strings.HasSuffix(orphaned[0], "oublie.png") {
+		t.Errorf("fichiers orphelins %v", orphaned)
+	}
+}
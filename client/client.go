@@ -0,0 +1,283 @@
+// Package client appelle l'API JSON du forum (/api/v1) avec des modèles typés.
+//
+//	c := client.New("https://forum.example", os.Getenv("FORUM_TOKEN"))
+//	page, err := c.Posts(ctx, client.PageOptions{Limit: 50})
+//
+// Le jeton est un jeton d'accès personnel créé depuis /profil ; ses portées limitent les
+// appels permis. Une erreur de l'API est retournée sous forme de *Error.
+//
+// Le paquet est écrit à la main, pas généré : il suit openapi.json, à mettre à jour ensemble.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Author struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type Post struct {
+	ID             int        `json:"id"`
+	Title          string     `json:"title"`
+	Content        string     `json:"content"`
+	Video          string     `json:"video,omitempty"`
+	Images         []string   `json:"images"`
+	Author         Author     `json:"author"`
+	Pinned         bool       `json:"pinned"`
+	Locked         bool       `json:"locked"`
+	Archived       bool       `json:"archived"`
+	Score          int        `json:"score"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	URL            string     `json:"url"`
+}
+
+type Comment struct {
+	ID      int    `json:"id"`
+	PostID  int    `json:"post_id"`
+	Author  Author `json:"author"`
+	Content string `json:"content"`
+	// Absente pour les commentaires les plus anciens
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// User est un profil ; Email n'est renseigné que pour le titulaire du jeton
+type User struct {
+	ID             int    `json:"id"`
+	Username       string `json:"username"`
+	Email          string `json:"email,omitempty"`
+	ProfilePicture string `json:"profile_picture,omitempty"`
+	Role           string `json:"role"`
+	URL            string `json:"url"`
+}
+
+// Vote est le vote de l'utilisateur sur un sujet (1, -1, ou 0 sans vote) et le score du sujet
+type Vote struct {
+	PostID int `json:"post_id"`
+	Value  int `json:"value"`
+	Score  int `json:"score"`
+}
+
+// PostUpdate modifie les champs non nuls d'un sujet
+type PostUpdate struct {
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
+// PageOptions choisit une page d'une liste : Cursor reprend le NextCursor de la page
+// précédente, Limit vaut 20 par défaut et 100 au plus
+type PageOptions struct {
+	Cursor string
+	Limit  int
+}
+
+type PostPage struct {
+	Posts []Post
+	// Curseur de la page suivante, vide sur la dernière page
+	NextCursor string
+}
+
+type CommentPage struct {
+	Comments   []Comment
+	NextCursor string
+}
+
+// Error est une erreur retournée par l'API
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("forum : %d %s : %s", e.StatusCode, e.Code, e.Message)
+}
+
+type Client struct {
+	// URL du forum, sans /api/v1
+	BaseURL string
+	// Jeton d'accès personnel ; vide, seuls les appels anonymes aboutissent
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New retourne un client pour le forum baseURL, authentifié par token
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token, HTTPClient: http.DefaultClient}
+}
+
+// Posts liste les sujets, du plus récent au plus ancien
+func (c *Client) Posts(ctx context.Context, opts PageOptions) (*PostPage, error) {
+	var page PostPage
+	cursor, err := c.do(ctx, http.MethodGet, "/posts"+opts.query(nil), nil, &page.Posts)
+	page.NextCursor = cursor
+	return &page, err
+}
+
+// Search retourne au plus limit sujets correspondant à la recherche, les plus pertinents d'abord
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]Post, error) {
+	var posts []Post
+	_, err := c.do(ctx, http.MethodGet, "/posts"+PageOptions{Limit: limit}.query(url.Values{"q": {query}}), nil, &posts)
+	return posts, err
+}
+
+func (c *Client) Post(ctx context.Context, id int) (*Post, error) {
+	var post Post
+	_, err := c.do(ctx, http.MethodGet, "/posts/"+strconv.Itoa(id), nil, &post)
+	return &post, err
+}
+
+func (c *Client) CreatePost(ctx context.Context, title, content string) (*Post, error) {
+	var post Post
+	_, err := c.do(ctx, http.MethodPost, "/posts", map[string]string{"title": title, "content": content}, &post)
+	return &post, err
+}
+
+func (c *Client) UpdatePost(ctx context.Context, id int, update PostUpdate) (*Post, error) {
+	var post Post
+	_, err := c.do(ctx, http.MethodPatch, "/posts/"+strconv.Itoa(id), update, &post)
+	return &post, err
+}
+
+// Comments liste les commentaires d'un sujet, dans l'ordre
+func (c *Client) Comments(ctx context.Context, postID int, opts PageOptions) (*CommentPage, error) {
+	var page CommentPage
+	cursor, err := c.do(ctx, http.MethodGet, "/posts/"+strconv.Itoa(postID)+"/comments"+opts.query(nil), nil, &page.Comments)
+	page.NextCursor = cursor
+	return &page, err
+}
+
+func (c *Client) Comment(ctx context.Context, id int) (*Comment, error) {
+	var comment Comment
+	_, err := c.do(ctx, http.MethodGet, "/comments/"+strconv.Itoa(id), nil, &comment)
+	return &comment, err
+}
+
+func (c *Client) CreateComment(ctx context.Context, postID int, content string) (*Comment, error) {
+	var comment Comment
+	_, err := c.do(ctx, http.MethodPost, "/posts/"+strconv.Itoa(postID)+"/comments", map[string]string{"content": content}, &comment)
+	return &comment, err
+}
+
+func (c *Client) UpdateComment(ctx context.Context, id int, content string) (*Comment, error) {
+	var comment Comment
+	_, err := c.do(ctx, http.MethodPatch, "/comments/"+strconv.Itoa(id), map[string]string{"content": content}, &comment)
+	return &comment, err
+}
+
+// MyVote retourne le vote du titulaire du jeton sur le sujet
+func (c *Client) MyVote(ctx context.Context, postID int) (*Vote, error) {
+	var vote Vote
+	_, err := c.do(ctx, http.MethodGet, "/posts/"+strconv.Itoa(postID)+"/vote", nil, &vote)
+	return &vote, err
+}
+
+// SetVote vote pour (1) ou contre (-1) le sujet, en remplaçant le vote précédent
+func (c *Client) SetVote(ctx context.Context, postID, value int) (*Vote, error) {
+	var vote Vote
+	_, err := c.do(ctx, http.MethodPut, "/posts/"+strconv.Itoa(postID)+"/vote", map[string]int{"value": value}, &vote)
+	return &vote, err
+}
+
+func (c *Client) RemoveVote(ctx context.Context, postID int) (*Vote, error) {
+	var vote Vote
+	_, err := c.do(ctx, http.MethodDelete, "/posts/"+strconv.Itoa(postID)+"/vote", nil, &vote)
+	return &vote, err
+}
+
+func (c *Client) User(ctx context.Context, username string) (*User, error) {
+	var user User
+	_, err := c.do(ctx, http.MethodGet, "/users/"+url.PathEscape(username), nil, &user)
+	return &user, err
+}
+
+// Me retourne le profil du titulaire du jeton
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	_, err := c.do(ctx, http.MethodGet, "/me", nil, &user)
+	return &user, err
+}
+
+func (o PageOptions) query(values url.Values) string {
+	if values == nil {
+		values = url.Values{}
+	}
+	if o.Cursor != "" {
+		values.Set("cursor", o.Cursor)
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// do envoie la requête et décode le champ data de la réponse dans out, en retournant
+// le curseur de la page suivante s'il y en a un
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (string, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api/v1"+path, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var envelope struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		apiErr := &Error{StatusCode: resp.StatusCode, Code: "http_error", Message: resp.Status}
+		if json.NewDecoder(resp.Body).Decode(&envelope) == nil && envelope.Error.Code != "" {
+			apiErr.Code, apiErr.Message = envelope.Error.Code, envelope.Error.Message
+		}
+		return "", apiErr
+	}
+
+	envelope := struct {
+		Data       interface{} `json:"data"`
+		NextCursor string      `json:"next_cursor"`
+	}{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return "", fmt.Errorf("forum : réponse illisible : %w", err)
+	}
+	return envelope.NextCursor, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	data "forum/Data"
+	"forum/config"
+)
+
+const usage = `Utilisation : forum [commande] [options]
+
+Commandes :
+  serve          démarre le serveur (commande par défaut)
+  config print   affiche la configuration effective, secrets masqués
+  migrate        applique ou annule les migrations du schéma
+  backup [f]     sauvegarde la base SQLite et les fichiers envoyés
+  restore <f>    restaure une sauvegarde, serveur arrêté
+  check          vérifie l'intégrité de la base et des fichiers envoyés
+  export [f]     exporte tout le forum dans une archive portable
+  import <f>     importe une archive produite par export, un dump phpBB ou
+                 une sauvegarde Discourse ("forum import" pour le détail)
+
+Lancez "forum serve -h" pour la liste des options.
+`
+
+func main() {
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(loadConfig("serve", args))
+	case "config":
+		runConfig(args)
+	case "migrate":
+		runMigrate(args)
+	case "backup":
+		runBackup(args)
+	case "restore":
+		runRestore(args)
+	case "check":
+		runCheck(args)
+	case "export":
+		runExport(args)
+	case "import":
+		runImport(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Commande inconnue %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// loadConfig charge la configuration ou arrête le programme si elle est invalide
+func loadConfig(name string, args []string) *config.Config {
+	c, rest, err := config.Load(name, args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal("Configuration invalide : ", err)
+	}
+	if len(rest) > 0 {
+		log.Fatalf("Arguments inattendus : %s", strings.Join(rest, " "))
+	}
+	return c
+}
+
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(os.Stderr, "Utilisation : forum config print [options]\n")
+		os.Exit(2)
+	}
+	c := loadConfig("config print", args[1:])
+	if err := c.Print(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+const migrateUsage = `Utilisation : forum migrate [action] [options]
+
+Actions :
+  up          applique toutes les migrations en attente (action par défaut)
+  down [n]    annule les n dernières migrations (1 par défaut)
+  to <n>      amène le schéma à la version n
+  status      liste les migrations et leur état
+`
+
+func runMigrate(args []string) {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	var operand string
+	if (action == "down" || action == "to") && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		operand, args = args[0], args[1:]
+	}
+	c := loadConfig("migrate "+action, args)
+
+	db, err := data.Open(c.DatabaseDriver, c.DatabaseSource())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch action {
+	case "up":
+		err = data.Migrate(db)
+	case "down":
+		n := 1
+		if operand != "" {
+			if n, err = strconv.Atoi(operand); err != nil || n < 1 {
+				log.Fatalf("Nombre de migrations invalide : %q", operand)
+			}
+		}
+		err = data.Rollback(db, n)
+	case "to":
+		target, convErr := strconv.Atoi(operand)
+		if convErr != nil || target < 0 {
+			log.Fatalf("Version invalide : %q", operand)
+		}
+		err = data.MigrateTo(db, target)
+	case "status":
+		printMigrationStatus(db)
+		return
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	version, err := data.SchemaVersion(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Schéma en version %d\n", version)
+}
+
+func printMigrationStatus(db *sql.DB) {
+	statuses, err := data.Status(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, s := range statuses {
+		state := "en attente"
+		if s.AppliedAt.Valid {
+			state = "appliquée le " + s.AppliedAt.Time.Local().Format("02/01/2006 à 15:04")
+		}
+		fmt.Printf("%04d  %-20s %s\n", s.Version, s.Name, state)
+	}
+}
+
+// openDatabase ouvre la base du serveur. Sans migration automatique, le serveur refuse de
+// démarrer sur un schéma en retard plutôt que d'échouer à la première requête.
+func openDatabase(c *config.Config) (*sql.DB, error) {
+	if c.AutoMigrate {
+		return data.InitDB(c.DatabaseDriver, c.DatabaseSource())
+	}
+	db, err := data.Open(c.DatabaseDriver, c.DatabaseSource())
+	if err != nil {
+		return nil, err
+	}
+	current, err := data.SchemaVersion(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	latest, err := data.LatestVersion(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if current < latest {
+		db.Close()
+		return nil, fmt.Errorf("le schéma est en version %d au lieu de %d : lancez \"forum migrate\"", current, latest)
+	}
+	return db, nil
+}
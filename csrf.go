@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	csrfMu     sync.Mutex
+	csrfTokens = map[string]string{} // map of session IDs to their CSRF token
+)
+
+// newCSRFToken génère un jeton aléatoire de 32 octets encodé en base64
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Erreur lors de la génération d'un jeton CSRF:", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionCSRFToken retourne le jeton de la session, en le créant au besoin
+func sessionCSRFToken(sessionID string) string {
+	csrfMu.Lock()
+	defer csrfMu.Unlock()
+
+	token, ok := csrfTokens[sessionID]
+	if !ok {
+		token = newCSRFToken()
+		csrfTokens[sessionID] = token
+	}
+	return token
+}
+
+// deleteCSRFToken oublie le jeton d'une session terminée
+func deleteCSRFToken(sessionID string) {
+	csrfMu.Lock()
+	defer csrfMu.Unlock()
+
+	delete(csrfTokens, sessionID)
+}
+
+// csrfToken retourne le jeton à insérer dans les formulaires de la page. Un visiteur
+// connecté utilise celui de sa session ; un visiteur anonyme reçoit un cookie csrf_token
+// dont la valeur doit être renvoyée avec le formulaire.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if sessionCookie, err := r.Cookie("session_id"); err == nil {
+		if _, ok := sessionEmail(sessionCookie.Value); ok {
+			return sessionCSRFToken(sessionCookie.Value)
+		}
+	}
+	if cookie, err := r.Cookie("csrf_token"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	token := newCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     "csrf_token",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// hasSession indique si la requête porte le cookie d'une session ouverte
+func hasSession(r *http.Request) bool {
+	sessionCookie, err := r.Cookie("session_id")
+	if err != nil {
+		return false
+	}
+	_, ok := sessions[sessionCookie.Value]
+	return ok
+}
+
+// expectedCSRFToken retourne le jeton attendu pour la requête, ou "" s'il n'y en a aucun
+func expectedCSRFToken(r *http.Request) string {
+	if sessionCookie, err := r.Cookie("session_id"); err == nil {
+		if _, ok := sessionEmail(sessionCookie.Value); ok {
+			return sessionCSRFToken(sessionCookie.Value)
+		}
+	}
+	if cookie, err := r.Cookie("csrf_token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// verifyCSRF rejette toute requête modifiant l'état qui ne renvoie pas le jeton CSRF
+// attendu, dans le champ csrf_token du formulaire ou l'en-tête X-CSRF-Token.
+func verifyCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Sans session, une requête à l'API ne porte aucun identifiant à détourner : un jeton
+		// Bearer n'est jamais envoyé d'office par le navigateur, et une requête anonyme est
+		// refusée plus loin si elle exige une authentification
+		if isAPIRequest(r) && (requestToken(r) != nil || !hasSession(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Les boîtes ActivityPub ne reçoivent que des serveurs, authentifiés par signature HTTP
+		if strings.HasPrefix(r.URL.Path, apPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		submitted := r.Header.Get("X-CSRF-Token")
+		if submitted == "" {
+			submitted = r.FormValue("csrf_token")
+		}
+		expected := expectedCSRFToken(r)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) != 1 {
+			if isAPIRequest(r) {
+				apiError(w, http.StatusForbidden, "csrf_invalid", "Jeton CSRF invalide ou manquant : envoyez-le dans l'en-tête X-CSRF-Token")
+				return
+			}
+			http.Error(w, "Jeton CSRF invalide ou manquant", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
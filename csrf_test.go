@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVerifyCSRF(t *testing.T) {
+	var reached bool
+	handler := verifyCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	newSession("session-alice", "alice@example.com")
+	newSession("session-bob", "bob@example.com")
+	t.Cleanup(func() {
+		endSession("session-alice")
+		endSession("session-bob")
+	})
+	aliceToken := sessionCSRFToken("session-alice")
+	bobToken := sessionCSRFToken("session-bob")
+
+	tests := []struct {
+		name    string
+		method  string
+		session string
+		cookie  string // cookie csrf_token d'un visiteur anonyme
+		form    string
+		header  string
+		allowed bool
+	}{
+		{"lecture", http.MethodGet, "", "", "", "", true},
+		{"formulaire sans jeton", http.MethodPost, "session-alice", "", "", "", false},
+		{"jeton de la session", http.MethodPost, "session-alice", "", aliceToken, "", true},
+		{"jeton en en-tête", http.MethodPost, "session-alice", "", "", aliceToken, true},
+		{"jeton d'une autre session", http.MethodPost, "session-alice", "", bobToken, "", false},
+		{"jeton du cookie pour une session", http.MethodPost, "session-alice", aliceToken, "autre", "", false},
+		{"visiteur avec son cookie", http.MethodPost, "", "anonyme", "anonyme", "", true},
+		{"visiteur sans cookie", http.MethodPost, "", "", "anonyme", "", false},
+		{"visiteur au cookie vide", http.MethodPost, "", "", "", "", false},
+		{"visiteur au mauvais jeton", http.MethodPost, "", "anonyme", "autre", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			r := postForm("/newpost", url.Values{"csrf_token": {tt.form}})
+			r.Method = tt.method
+			if tt.session != "" {
+				r.AddCookie(&http.Cookie{Name: "session_id", Value: tt.session})
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if reached != tt.allowed {
+				t.Errorf("requête acceptée : %v, attendu %v (statut %d)", reached, tt.allowed, w.Code)
+			}
+			if !tt.allowed && w.Code != http.StatusForbidden {
+				t.Errorf("statut %d, attendu 403", w.Code)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenInForms(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	// Un visiteur anonyme reçoit le jeton dans un cookie et dans le formulaire
+	w := httptest.NewRecorder()
+	(&loginHandler{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	token, ok := responseCookie(w, "csrf_token")
+	if !ok || token == "" {
+		t.Fatal("pas de cookie csrf_token pour le visiteur")
+	}
+	if !strings.Contains(w.Body.String(), `name="csrf_token" value="`+token+`"`) {
+		t.Errorf("jeton %q absent du formulaire de connexion", token)
+	}
+
+	// Un visiteur connecté utilise le jeton de sa session, oublié à la déconnexion
+	r := withSession(t, httptest.NewRequest(http.MethodGet, "/newpost", nil), "alice@example.com")
+	w = httptest.NewRecorder()
+	(&newPostHandler{}).ServeHTTP(w, r)
+	sessionToken := sessionCSRFToken("session-alice@example.com")
+	if !strings.Contains(w.Body.String(), `value="`+sessionToken+`"`) {
+		t.Errorf("jeton de session absent du formulaire de publication")
+	}
+	if _, ok := responseCookie(w, "csrf_token"); ok {
+		t.Error("cookie csrf_token posé pour un visiteur connecté")
+	}
+	endSession("session-alice@example.com")
+	if sessionCSRFToken("session-alice@example.com") == sessionToken {
+		t.Error("le jeton de la session a survécu à la déconnexion")
+	}
+	deleteCSRFToken("session-alice@example.com")
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	data "forum/Data"
+
+	"github.com/google/uuid"
+)
+
+// Une exportation est une archive tar.gz portable d'un moteur à l'autre :
+//
+//	manifest.json    format, version, identifiant et nombre d'éléments exportés
+//	users.jsonl      un compte par ligne, sans mot de passe
+//	posts.jsonl      un sujet par ligne, avec ses images
+//	comments.jsonl   un commentaire par ligne
+//	votes.jsonl      un vote par ligne, depuis la version 2
+//	media/<nom>      les vidéos et images référencées par les sujets
+//
+// Les IDs sont ceux de l'instance d'origine : l'import en attribue de nouveaux, et retient
+// ceux qu'il a déjà importés de la même archive pour ne pas les dupliquer. Un vote déjà
+// présent pour le même compte et le même sujet est conservé. La liste des catégories du
+// manifeste est réservée et toujours vide : le forum n'a pas de catégories.
+const (
+	exportFormat  = "forum-export"
+	exportVersion = 2
+	exportMedia   = "media"
+)
+
+type exportManifest struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// Identifiant unique de l'archive
+	ID         string    `json:"id"`
+	ExportedAt time.Time `json:"exported_at"`
+	Categories []string  `json:"categories"`
+	Users      int       `json:"users"`
+	Posts      int       `json:"posts"`
+	Comments   int       `json:"comments"`
+	Votes      int       `json:"votes"`
+	Media      int       `json:"media"`
+}
+
+type exportedUser struct {
+	ID             int        `json:"id"`
+	Email          string     `json:"email"`
+	Username       string     `json:"username"`
+	Role           string     `json:"role"`
+	Banned         bool       `json:"banned,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	Shadowbanned   bool       `json:"shadowbanned,omitempty"`
+	ProfilePicture string     `json:"profile_picture,omitempty"`
+	// Acteur ActivityPub représenté par un compte venu d'un autre serveur
+	RemoteActor string `json:"remote_actor,omitempty"`
+	// Absent des archives antérieures à la confirmation des adresses, qui valaient confirmées
+	EmailVerified *bool `json:"email_verified,omitempty"`
+}
+
+type exportedPost struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"user_id"`
+	Title          string     `json:"title"`
+	Content        string     `json:"content"`
+	Video          string     `json:"video,omitempty"`
+	Images         []string   `json:"images,omitempty"`
+	Pinned         bool       `json:"pinned,omitempty"`
+	Locked         bool       `json:"locked,omitempty"`
+	Archived       bool       `json:"archived,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+}
+
+type exportedComment struct {
+	ID        int        `json:"id"`
+	PostID    int        `json:"post_id"`
+	UserID    int        `json:"user_id"`
+	Content   string     `json:"content"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+type exportedVote struct {
+	UserID    int       `json:"user_id"`
+	PostID    int       `json:"post_id"`
+	Value     int       `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func ptrNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// mediaName retourne le nom dans l'archive d'un fichier enregistré sous uploadURLPrefix/nom
+func mediaName(stored string) string {
+	return strings.TrimPrefix(stored, uploadURLPrefix+"/")
+}
+
+// exportForum écrit toute la base et les fichiers référencés dans l'archive dest
+func exportForum(ctx context.Context, db *sql.DB, uploadDir, dest string) (exportManifest, error) {
+	manifest := exportManifest{Format: exportFormat, Version: exportVersion, ID: uuid.New().String(), ExportedAt: time.Now().UTC(), Categories: []string{}}
+
+	users, err := data.AllUsers(ctx, db)
+	if err != nil {
+		return manifest, err
+	}
+	posts, err := data.AllPosts(ctx, db)
+	if err != nil {
+		return manifest, err
+	}
+	comments, err := data.AllComments(ctx, db)
+	if err != nil {
+		return manifest, err
+	}
+	votes, err := data.AllVotes(ctx, db)
+	if err != nil {
+		return manifest, err
+	}
+
+	var usersJSON, postsJSON, commentsJSON, votesJSON bytes.Buffer
+	enc := json.NewEncoder(&usersJSON)
+	for _, u := range users {
+		enc.Encode(exportedUser{
+			ID: u.ID, Email: u.Email, Username: u.Username, Role: u.Role, Banned: u.Banned,
+			SuspendedUntil: nullTimePtr(u.SuspendedUntil), Shadowbanned: u.Shadowbanned, ProfilePicture: u.ProfilePicture,
+			RemoteActor: u.RemoteActor, EmailVerified: &u.EmailVerified,
+		})
+	}
+	media := map[string]bool{}
+	enc = json.NewEncoder(&postsJSON)
+	for _, p := range posts {
+		record := exportedPost{
+			ID: p.ID, UserID: p.UserID, Title: p.Title, Content: p.Content, Pinned: p.Pinned, Locked: p.Locked,
+			Archived: p.Archived, CreatedAt: p.Created, LastActivityAt: nullTimePtr(p.LastActivity),
+		}
+		if p.Video != "" {
+			record.Video = mediaName(p.Video)
+			media[record.Video] = true
+		}
+		for _, image := range p.Image {
+			record.Images = append(record.Images, mediaName(image))
+			media[mediaName(image)] = true
+		}
+		enc.Encode(record)
+	}
+	enc = json.NewEncoder(&commentsJSON)
+	for _, c := range comments {
+		enc.Encode(exportedComment{ID: c.ID, PostID: c.PostID, UserID: c.UserID, Content: c.Content, CreatedAt: nullTimePtr(c.Created)})
+	}
+	enc = json.NewEncoder(&votesJSON)
+	for _, v := range votes {
+		enc.Encode(exportedVote{UserID: v.UserID, PostID: v.PostID, Value: v.Value, CreatedAt: v.Created})
+	}
+	manifest.Users, manifest.Posts, manifest.Comments, manifest.Votes = len(users), len(posts), len(comments), len(votes)
+
+	tmp := dest + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return manifest, err
+	}
+	defer os.Remove(tmp)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	// Les fichiers absents du disque sont signalés sans bloquer l'export
+	var files []string
+	for name := range media {
+		if !filepath.IsLocal(name) {
+			log.Printf("Fichier %s ignoré : chemin hors du répertoire des envois\n", name)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(name))); err != nil {
+			log.Printf("Fichier %s ignoré : %v\n", name, err)
+			continue
+		}
+		files = append(files, name)
+	}
+	manifest.Media = len(files)
+
+	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
+	entries := []struct {
+		name    string
+		content []byte
+	}{
+		{"manifest.json", manifestJSON},
+		{"users.jsonl", usersJSON.Bytes()},
+		{"posts.jsonl", postsJSON.Bytes()},
+		{"comments.jsonl", commentsJSON.Bytes()},
+		{"votes.jsonl", votesJSON.Bytes()},
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), ModTime: manifest.ExportedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			f.Close()
+			return manifest, err
+		}
+		if _, err := tw.Write(e.content); err != nil {
+			f.Close()
+			return manifest, err
+		}
+	}
+	for _, name := range files {
+		if err := addArchiveFile(tw, filepath.Join(uploadDir, filepath.FromSlash(name)), path.Join(exportMedia, name)); err != nil {
+			f.Close()
+			return manifest, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return manifest, err
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return manifest, err
+	}
+	if err := f.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, os.Rename(tmp, dest)
+}
+
+// importReport résume ce que l'import a créé, fusionné ou ignoré
+type importReport struct {
+	UsersCreated, UsersMerged, UsersRenamed int
+	Posts, Comments, Votes, Skipped         int
+	// Sujets et commentaires déjà importés de la même archive
+	Duplicates          int
+	Media, MediaRenamed int
+}
+
+// importForum reconstruit le contenu d'une archive d'export dans la base. Un compte dont
+// l'email existe déjà est fusionné avec le compte existant ; un nom d'utilisateur déjà pris
+// reçoit un suffixe. Les sujets et commentaires reçoivent de nouveaux IDs ; ceux qu'un import
+// précédent de la même archive a déjà créés sont ignorés. Les comptes créés n'ont pas de mot
+// de passe et doivent le réinitialiser avant de se connecter.
+func importForum(ctx context.Context, db *sql.DB, uploadDir, archive string) (importReport, error) {
+	var report importReport
+	f, err := os.Open(archive)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return report, fmt.Errorf("%s n'est pas une exportation : %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest exportManifest
+	var users []exportedUser
+	var posts []exportedPost
+	var comments []exportedComment
+	var votes []exportedVote
+	media := map[string]string{} // nom dans l'archive -> fichier extrait
+	var written []string
+	cleanup := func() {
+		for _, file := range written {
+			os.Remove(file)
+		}
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cleanup()
+			return report, err
+		}
+		switch header.Name {
+		case "manifest.json":
+			err = json.NewDecoder(tr).Decode(&manifest)
+			if err == nil && (manifest.Format != exportFormat || manifest.Version > exportVersion) {
+				err = fmt.Errorf("format %q version %d non pris en charge", manifest.Format, manifest.Version)
+			}
+		case "users.jsonl":
+			err = decodeLines(tr, &users)
+		case "posts.jsonl":
+			err = decodeLines(tr, &posts)
+		case "comments.jsonl":
+			err = decodeLines(tr, &comments)
+		case "votes.jsonl":
+			err = decodeLines(tr, &votes)
+		default:
+			name, ok := strings.CutPrefix(header.Name, exportMedia+"/")
+			if !ok || !filepath.IsLocal(name) || header.Typeflag != tar.TypeReg {
+				err = fmt.Errorf("entrée inattendue : %s", header.Name)
+				break
+			}
+			var stored string
+			var created bool
+			stored, created, err = extractMedia(tr, uploadDir, name)
+			if created {
+				written = append(written, filepath.Join(uploadDir, filepath.FromSlash(stored)))
+				report.Media++
+			}
+			if stored != name {
+				report.MediaRenamed++
+			}
+			media[name] = path.Join(uploadURLPrefix, stored)
+		}
+		if err != nil {
+			cleanup()
+			return report, fmt.Errorf("%s : %w", header.Name, err)
+		}
+	}
+	if manifest.Format == "" {
+		cleanup()
+		return report, fmt.Errorf("%s n'est pas une exportation : manifest.json manquant", archive)
+	}
+
+	// Une archive sans identifiant, écrite à la main, est reconnue à sa date d'export
+	source := manifest.ID
+	if source == "" {
+		source = exportFormat + ":" + manifest.ExportedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	storedMedia := func(name string) string {
+		if stored, ok := media[name]; ok {
+			return stored
+		}
+		return path.Join(uploadURLPrefix, name)
+	}
+
+	err = data.Import(ctx, db, func(im *data.Importer) error {
+		userIDs := map[int]int{}
+		for _, u := range users {
+			var existing *data.User
+			var err error
+			if u.RemoteActor != "" {
+				existing, err = im.UserByRemoteActor(ctx, u.RemoteActor)
+			} else {
+				existing, err = im.UserByEmail(ctx, u.Email)
+			}
+			if err == nil {
+				userIDs[u.ID] = existing.ID
+				report.UsersMerged++
+				continue
+			}
+			if !errors.Is(err, data.ErrNotFound) {
+				return err
+			}
+			username, err := freeUsername(ctx, im, u.Username)
+			if err != nil {
+				return err
+			}
+			if username != u.Username {
+				report.UsersRenamed++
+			}
+			role := u.Role
+			if role == "" {
+				role = "user"
+			}
+			id, err := im.AddUser(ctx, &data.User{
+				Email: u.Email, Username: username, Role: role, Banned: u.Banned,
+				SuspendedUntil: ptrNullTime(u.SuspendedUntil), Shadowbanned: u.Shadowbanned, ProfilePicture: u.ProfilePicture,
+				MustResetPassword: u.RemoteActor == "", RemoteActor: u.RemoteActor,
+				EmailVerified: u.EmailVerified == nil || *u.EmailVerified,
+			})
+			if err != nil {
+				return fmt.Errorf("compte %s : %w", u.Email, err)
+			}
+			userIDs[u.ID] = id
+			report.UsersCreated++
+		}
+
+		postIDs := map[int]int{}
+		for _, p := range posts {
+			userID, ok := userIDs[p.UserID]
+			if !ok {
+				report.Skipped++
+				continue
+			}
+			if id, err := im.Imported(ctx, source, data.ImportedPost, p.ID); err == nil {
+				postIDs[p.ID] = id
+				report.Duplicates++
+				continue
+			} else if !errors.Is(err, data.ErrNotFound) {
+				return err
+			}
+			post := &data.Post{
+				Title: p.Title, Content: p.Content, UserID: userID, Pinned: p.Pinned, Locked: p.Locked,
+				Archived: p.Archived, Created: p.CreatedAt, LastActivity: ptrNullTime(p.LastActivityAt),
+			}
+			if p.Video != "" {
+				post.Video = storedMedia(p.Video)
+			}
+			for _, image := range p.Images {
+				post.Image = append(post.Image, storedMedia(image))
+			}
+			id, err := im.AddPost(ctx, post)
+			if err != nil {
+				return fmt.Errorf("sujet %d : %w", p.ID, err)
+			}
+			if err := im.RecordImport(ctx, source, data.ImportedPost, p.ID, id); err != nil {
+				return err
+			}
+			postIDs[p.ID] = id
+			report.Posts++
+		}
+
+		for _, c := range comments {
+			postID, postOK := postIDs[c.PostID]
+			userID, userOK := userIDs[c.UserID]
+			if !postOK || !userOK {
+				report.Skipped++
+				continue
+			}
+			if _, err := im.Imported(ctx, source, data.ImportedComment, c.ID); err == nil {
+				report.Duplicates++
+				continue
+			} else if !errors.Is(err, data.ErrNotFound) {
+				return err
+			}
+			id, err := im.AddComment(ctx, &data.Comment{PostID: postID, UserID: userID, Content: c.Content, Created: ptrNullTime(c.CreatedAt)})
+			if err != nil {
+				return fmt.Errorf("commentaire %d : %w", c.ID, err)
+			}
+			if err := im.RecordImport(ctx, source, data.ImportedComment, c.ID, id); err != nil {
+				return err
+			}
+			report.Comments++
+		}
+
+		for _, v := range votes {
+			postID, postOK := postIDs[v.PostID]
+			userID, userOK := userIDs[v.UserID]
+			if !postOK || !userOK {
+				report.Skipped++
+				continue
+			}
+			added, err := im.AddVote(ctx, &data.Vote{UserID: userID, PostID: postID, Value: v.Value, Created: v.CreatedAt})
+			if err != nil {
+				return fmt.Errorf("vote de %d sur %d : %w", v.UserID, v.PostID, err)
+			}
+			if added {
+				report.Votes++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return report, err
+	}
+	return report, nil
+}
+
+func decodeLines[T any](r io.Reader, records *[]T) error {
+	dec := json.NewDecoder(r)
+	for {
+		var record T
+		if err := dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		*records = append(*records, record)
+	}
+}
+
+// freeUsername retourne username, suffixé au besoin pour ne pas reprendre un nom existant
+func freeUsername(ctx context.Context, im *data.Importer, username string) (string, error) {
+	candidate := username
+	for n := 2; ; n++ {
+		exists, err := im.UsernameExists(ctx, candidate)
+		if err != nil || !exists {
+			return candidate, err
+		}
+		candidate = username + "_" + strconv.Itoa(n)
+	}
+}
+
+// extractMedia copie un fichier de l'archive dans le répertoire des envois. Un fichier
+// identique déjà présent est réutilisé ; un fichier différent du même nom en fait choisir un autre.
+func extractMedia(r io.Reader, uploadDir, name string) (stored string, created bool, err error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256(content)
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	stored = name
+	for n := 2; ; n++ {
+		dest := filepath.Join(uploadDir, filepath.FromSlash(stored))
+		existing, err := os.ReadFile(dest)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return "", false, err
+			}
+			return stored, true, os.WriteFile(dest, content, 0644)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if sha256.Sum256(existing) == sum {
+			return stored, false, nil
+		}
+		stored = base + "-" + strconv.Itoa(n) + ext
+	}
+}
+
+func runExport(args []string) {
+	var dest string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		dest, args = args[0], args[1:]
+	}
+	c := loadConfig("export", args)
+	if dest == "" {
+		dest = backupFileName("forum-export-", time.Now())
+	}
+
+	db, err := data.Open(c.DatabaseDriver, c.DatabaseSource())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	manifest, err := exportForum(context.Background(), db, c.UploadDir, dest)
+	if err != nil {
+		log.Fatal("Export impossible : ", err)
+	}
+	fmt.Printf("%d comptes, %d sujets, %d commentaires, %d votes et %d fichiers exportés dans %s\n",
+		manifest.Users, manifest.Posts, manifest.Comments, manifest.Votes, manifest.Media, dest)
+}
+
+const importUsage = `Utilisation :
+  forum import <export.tar.gz> [options]                  archive produite par forum export
+  forum import phpbb <dump.sql> [répertoire files] [options]   dump MySQL de phpBB 3
+  forum import discourse <sauvegarde.json> [répertoire public] [options]
+`
+
+func runImport(args []string) {
+	source := "export"
+	if len(args) > 0 && (args[0] == "phpbb" || args[0] == "discourse") {
+		source, args = args[0], args[1:]
+	}
+	var operands []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") && len(operands) < 2 {
+		operands, args = append(operands, args[0]), args[1:]
+	}
+	if len(operands) == 0 || (source == "export" && len(operands) > 1) {
+		fmt.Fprint(os.Stderr, importUsage)
+		os.Exit(2)
+	}
+	archive := operands[0]
+	var filesDir string
+	if len(operands) > 1 {
+		filesDir = operands[1]
+	}
+	c := loadConfig("import "+source, args)
+
+	db, err := openDatabase(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := os.MkdirAll(c.UploadDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	var report importReport
+	switch source {
+	case "export":
+		report, err = importForum(context.Background(), db, c.UploadDir, archive)
+	case "phpbb", "discourse":
+		var forum *foreignForum
+		if source == "phpbb" {
+			forum, err = readPHPBB(archive, filesDir)
+		} else {
+			forum, err = readDiscourse(archive, filesDir)
+		}
+		if err != nil {
+			log.Fatalf("Lecture de %s impossible : %v", archive, err)
+		}
+		report, err = importForeign(context.Background(), db, c.UploadDir, forum)
+	}
+	if err != nil {
+		log.Fatal("Import impossible : ", err)
+	}
+	printImportReport(report)
+}
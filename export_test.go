@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	data "forum/Data"
+)
+
+// countRows retourne le nombre de lignes de la table
+func countRows(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// seedForum remplit la base de deux comptes, trois sujets, deux commentaires et un vote
+func seedForum(t *testing.T, db *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+	s := data.NewStore(db)
+	alice, err := s.Users.Create(ctx, &User{Email: "alice@example.com", Username: "alice", Password: "secret1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.Users.Create(ctx, &User{Email: "bob@example.com", Username: "bob", Password: "secret1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var posts []int
+	for _, title := range []string{"Premier", "Deuxième", "Troisième"} {
+		id, err := s.Posts.Create(ctx, &Post{Title: title, Content: "Contenu " + title, UserID: alice})
+		if err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, id)
+	}
+	for _, content := range []string{"Réponse", "Autre réponse"} {
+		if _, err := s.Comments.Create(ctx, &Comment{PostID: posts[0], UserID: bob, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Votes.Set(ctx, bob, posts[0], 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readManifest lit le manifeste d'une archive d'export
+func readManifest(t *testing.T, archive string) exportManifest {
+	t.Helper()
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			t.Fatal("manifest.json absent de l'archive")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == "manifest.json" {
+			var raw map[string]json.RawMessage
+			content, _ := io.ReadAll(tr)
+			if err := json.Unmarshal(content, &raw); err != nil {
+				t.Fatal(err)
+			}
+			if string(raw["categories"]) != "[]" {
+				t.Errorf("categories = %s, attendu []", raw["categories"])
+			}
+			var manifest exportManifest
+			json.Unmarshal(content, &manifest)
+			return manifest
+		}
+	}
+}
+
+// rewriteManifest réécrit l'archive avec le manifeste modifié par edit
+func rewriteManifest(t *testing.T, archive string, edit func(m *exportManifest)) {
+	t.Helper()
+	in, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(archive + ".new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		if header.Name == "manifest.json" {
+			var manifest exportManifest
+			json.Unmarshal(content, &manifest)
+			edit(&manifest)
+			content, _ = json.Marshal(manifest)
+			header.Size = int64(len(content))
+		}
+		tw.WriteHeader(header)
+		tw.Write(content)
+	}
+	tw.Close()
+	gzw.Close()
+	out.Close()
+	in.Close()
+	if err := os.Rename(archive+".new", archive); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportTwiceDoesNotDuplicate(t *testing.T) {
+	ctx := context.Background()
+	source := openTestDatabase(t)
+	seedForum(t, source)
+	archive := filepath.Join(t.TempDir(), "export.tar.gz")
+	if _, err := exportForum(ctx, source, t.TempDir(), archive); err != nil {
+		t.Fatal(err)
+	}
+	manifest := readManifest(t, archive)
+	if manifest.Version != exportVersion || manifest.ID == "" {
+		t.Errorf("manifeste : version %d, identifiant %q", manifest.Version, manifest.ID)
+	}
+
+	// Une archive de version 2, sans identifiant, est reconnue à sa date d'export
+	legacy := filepath.Join(t.TempDir(), "legacy.tar.gz")
+	if _, err := exportForum(ctx, source, t.TempDir(), legacy); err != nil {
+		t.Fatal(err)
+	}
+	rewriteManifest(t, legacy, func(m *exportManifest) { m.Version, m.ID, m.Categories = 2, "", nil })
+
+	for _, archive := range []string{archive, legacy} {
+		t.Run(filepath.Base(archive), func(t *testing.T) {
+			dest := openTestDatabase(t)
+			uploadDir := t.TempDir()
+
+			first, err := importForum(ctx, dest, uploadDir, archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.UsersCreated != 2 || first.Posts != 3 || first.Comments != 2 || first.Votes != 1 || first.Duplicates != 0 {
+				t.Errorf("premier import : %+v", first)
+			}
+
+			second, err := importForum(ctx, dest, uploadDir, archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second.UsersMerged != 2 || second.Posts != 0 || second.Comments != 0 || second.Votes != 0 || second.Duplicates != 5 {
+				t.Errorf("second import : %+v", second)
+			}
+
+			counts := []struct {
+				query string
+				want  int
+			}{
+				{"SELECT COUNT(*) FROM utilisateurs", 2},
+				{"SELECT COUNT(*) FROM posts WHERE user_id IS NOT NULL", 3},
+				{"SELECT COUNT(*) FROM comments", 2},
+				{"SELECT COUNT(*) FROM votes", 1},
+			}
+			for _, c := range counts {
+				if got := countRows(t, dest, c.query); got != c.want {
+					t.Errorf("%s = %d, attendu %d", c.query, got, c.want)
+				}
+			}
+		})
+	}
+
+	// Une autre archive du même forum est une autre source : ses sujets sont importés
+	t.Run("autre archive", func(t *testing.T) {
+		dest := openTestDatabase(t)
+		for _, a := range []string{archive, legacy} {
+			if _, err := importForum(ctx, dest, t.TempDir(), a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := countRows(t, dest, "SELECT COUNT(*) FROM posts WHERE user_id IS NOT NULL"); got != 6 {
+			t.Errorf("%d sujets, attendu 6", got)
+		}
+	})
+}
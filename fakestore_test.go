@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	data "forum/Data"
+	"forum/config"
+)
+
+// fakeStore garde en mémoire les comptes, sujets et commentaires des tests de handlers.
+// Chaque dépôt embarque son interface : une méthode que le fake n'implémente pas panique,
+// ce qui signale au test un appel inattendu à la base.
+type fakeStore struct {
+	mu       sync.Mutex
+	users    []User
+	posts    []Post
+	comments []Comment
+	touched  map[int]int // nombre de Touch par sujet
+}
+
+// useFakeStore remplace la base par un fakeStore vide, avec la configuration par défaut,
+// le temps du test
+func useFakeStore(t *testing.T) *fakeStore {
+	t.Helper()
+	f := &fakeStore{touched: map[int]int{}}
+	previousStore, previousCfg := store, cfg
+	store = &data.Store{
+		Users:       fakeUsers{f: f},
+		Posts:       fakePosts{f: f},
+		Comments:    fakeComments{f: f},
+		Attachments: fakeAttachments{f: f},
+		Webhooks:    fakeWebhooks{},
+	}
+	cfg = config.Default()
+	cfg.UploadDir = t.TempDir()
+	t.Cleanup(func() { store, cfg = previousStore, previousCfg })
+	return f
+}
+
+// addUser enregistre un compte et retourne son ID
+func (f *fakeStore) addUser(u User) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u.ID = len(f.users) + 1
+	f.users = append(f.users, u)
+	return u.ID
+}
+
+// addPost enregistre un sujet et retourne son ID
+func (f *fakeStore) addPost(p Post) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.insertPost(p)
+}
+
+func (f *fakeStore) insertPost(p Post) int {
+	p.ID = len(f.posts) + 1
+	if p.Created.IsZero() {
+		p.Created = time.Now()
+	}
+	f.posts = append(f.posts, p)
+	return p.ID
+}
+
+func (f *fakeStore) user(id int) *User {
+	for i := range f.users {
+		if f.users[i].ID == id {
+			return &f.users[i]
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) post(id int) *Post {
+	for i := range f.posts {
+		if f.posts[i].ID == id {
+			return &f.posts[i]
+		}
+	}
+	return nil
+}
+
+// visible applique la règle des dépôts SQL : un auteur shadowbanné n'est visible que de lui-même
+func (f *fakeStore) visible(authorID, viewerID int) bool {
+	author := f.user(authorID)
+	return author == nil || !author.Shadowbanned || authorID == viewerID
+}
+
+type fakeUsers struct {
+	data.Users
+	f *fakeStore
+}
+
+func (r fakeUsers) find(match func(*User) bool) (*User, error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	for i := range r.f.users {
+		if match(&r.f.users[i]) {
+			u := r.f.users[i]
+			return &u, nil
+		}
+	}
+	return nil, data.ErrNotFound
+}
+
+func (r fakeUsers) ByID(ctx context.Context, id int) (*User, error) {
+	return r.find(func(u *User) bool { return u.ID == id })
+}
+
+func (r fakeUsers) ByEmail(ctx context.Context, email string) (*User, error) {
+	return r.find(func(u *User) bool { return u.Email == email })
+}
+
+func (r fakeUsers) ByUsername(ctx context.Context, username string) (*User, error) {
+	return r.find(func(u *User) bool { return u.Username == username })
+}
+
+func (r fakeUsers) UsernameExists(ctx context.Context, username string) (bool, error) {
+	_, err := r.ByUsername(ctx, username)
+	return err == nil, nil
+}
+
+func (r fakeUsers) EmailExists(ctx context.Context, email string) (bool, error) {
+	_, err := r.ByEmail(ctx, email)
+	return err == nil, nil
+}
+
+func (r fakeUsers) Create(ctx context.Context, u *User) (int, error) {
+	return r.f.addUser(*u), nil
+}
+
+type fakePosts struct {
+	data.Posts
+	f *fakeStore
+}
+
+func (r fakePosts) List(ctx context.Context, viewerID, limit int) ([]Post, error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	var posts []Post
+	for _, p := range r.f.posts {
+		if r.f.visible(p.UserID, viewerID) {
+			posts = append(posts, p)
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Pinned && !posts[j].Pinned })
+	if limit > 0 && len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+func (r fakePosts) Get(ctx context.Context, id, viewerID int) (*Post, error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	p := r.f.post(id)
+	if p == nil || !r.f.visible(p.UserID, viewerID) {
+		return nil, data.ErrNotFound
+	}
+	post := *p
+	if author := r.f.user(p.UserID); author != nil {
+		post.Username = author.Username
+	}
+	return &post, nil
+}
+
+func (r fakePosts) State(ctx context.Context, id int) (locked, archived bool, err error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	p := r.f.post(id)
+	if p == nil {
+		return false, false, data.ErrNotFound
+	}
+	return p.Locked, p.Archived, nil
+}
+
+func (r fakePosts) Create(ctx context.Context, p *Post) (int, error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	return r.f.insertPost(*p), nil
+}
+
+func (r fakePosts) Touch(ctx context.Context, id int) error {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	if r.f.post(id) == nil {
+		return data.ErrNotFound
+	}
+	r.f.touched[id]++
+	return nil
+}
+
+type fakeComments struct {
+	data.Comments
+	f *fakeStore
+}
+
+func (r fakeComments) ForPost(ctx context.Context, postID, viewerID int) ([]Comment, error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	var comments []Comment
+	for _, c := range r.f.comments {
+		if c.PostID == postID && r.f.visible(c.UserID, viewerID) {
+			comments = append(comments, c)
+		}
+	}
+	return comments, nil
+}
+
+func (r fakeComments) Create(ctx context.Context, c *Comment) (int, error) {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	c.ID = len(r.f.comments) + 1
+	c.Created.Time, c.Created.Valid = time.Now(), true
+	r.f.comments = append(r.f.comments, *c)
+	return c.ID, nil
+}
+
+type fakeAttachments struct {
+	data.Attachments
+	f *fakeStore
+}
+
+func (r fakeAttachments) Add(ctx context.Context, post *Post, path string) error {
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	p := r.f.post(post.ID)
+	if p == nil {
+		return data.ErrNotFound
+	}
+	p.Image = append(p.Image, path)
+	return nil
+}
+
+// fakeWebhooks n'a aucun webhook : les événements émis ne sont livrés nulle part
+type fakeWebhooks struct {
+	data.Webhooks
+}
+
+func (fakeWebhooks) List(ctx context.Context) ([]data.Webhook, error) {
+	return nil, nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	data "forum/Data"
+)
+
+// Les flux suivent le forum depuis un lecteur RSS ou Atom, l'extension choisissant le format :
+//
+//	/feed.atom, /feed.rss                 derniers sujets
+//	/feed/category/<nom>.atom             derniers sujets de la catégorie, d'après le préfixe « [nom] » des titres importés
+//	/feed/user/<nom d'utilisateur>.atom   derniers sujets de l'utilisateur
+//	/feed/thread/<id>.atom                derniers commentaires du sujet
+//
+// Seuls les contenus visibles de tous y figurent. ETag et Last-Modified permettent aux
+// lecteurs de ne retélécharger un flux que s'il a changé.
+const (
+	atomExtension = ".atom"
+	rssExtension  = ".rss"
+	feedPrefix    = "/feed/"
+)
+
+// feed est un flux indépendant de son format
+type feed struct {
+	Title string
+	// Page HTML correspondant au flux
+	Link    string
+	Self    string
+	Updated time.Time
+	Entries []feedEntry
+}
+
+type feedEntry struct {
+	Title     string
+	Link      string
+	Author    string
+	Published time.Time
+	// Contenu HTML de l'entrée
+	Content string
+}
+
+type feedHandler struct{}
+
+func (h *feedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.NotFound(w, r)
+		return
+	}
+	path := r.URL.Path
+	var format string
+	switch {
+	case strings.HasSuffix(path, atomExtension):
+		format, path = atomExtension, strings.TrimSuffix(path, atomExtension)
+	case strings.HasSuffix(path, rssExtension):
+		format, path = rssExtension, strings.TrimSuffix(path, rssExtension)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var f *feed
+	var err error
+	kind, name, _ := strings.Cut(strings.TrimPrefix(path, feedPrefix), "/")
+	switch {
+	case path == "/feed":
+		f, err = siteFeed(r)
+	case kind == "category" && name != "":
+		f, err = categoryFeed(r, name)
+	case kind == "user" && name != "":
+		f, err = userFeed(r, name)
+	case kind == "thread" && name != "":
+		f, err = threadFeed(r, name)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, data.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la génération du flux", http.StatusInternalServerError)
+		log.Println("Erreur lors de la génération du flux:", err)
+		return
+	}
+	f.Self = absoluteURL(r, r.URL.Path)
+
+	var body []byte
+	if format == atomExtension {
+		body, err = f.atom()
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	} else {
+		body, err = f.rss()
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la génération du flux", http.StatusInternalServerError)
+		log.Println("Erreur lors de l'encodage du flux:", err)
+		return
+	}
+
+	// ServeContent répond 304 quand If-None-Match ou If-Modified-Since correspondent
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(body))
+}
+
+func siteFeed(r *http.Request) (*feed, error) {
+	posts, err := store.Posts.Latest(r.Context(), data.PostFilter{}, cfg.FeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return postsFeed(r, "Forum : derniers sujets", "/posts", posts), nil
+}
+
+func categoryFeed(r *http.Request, name string) (*feed, error) {
+	posts, err := store.Posts.Latest(r.Context(), data.PostFilter{TitlePrefix: "[" + name + "] "}, cfg.FeedSize)
+	if err != nil {
+		return nil, err
+	}
+	// Une catégorie n'existe que par les titres qui la portent : sans sujet, elle est inconnue
+	if len(posts) == 0 {
+		return nil, data.ErrNotFound
+	}
+	return postsFeed(r, "Forum : "+name, "/posts?q="+url.QueryEscape(name), posts), nil
+}
+
+func userFeed(r *http.Request, username string) (*feed, error) {
+	user, err := store.Users.ByUsername(r.Context(), username)
+	if err != nil {
+		return nil, err
+	}
+	// Le flux d'un compte shadowbanné n'existe pour personne
+	if user.Shadowbanned {
+		return nil, data.ErrNotFound
+	}
+	posts, err := store.Posts.Latest(r.Context(), data.PostFilter{AuthorID: user.ID}, cfg.FeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return postsFeed(r, "Forum : sujets de "+user.Username, profileURL(user.Username), posts), nil
+}
+
+func threadFeed(r *http.Request, idParam string) (*feed, error) {
+	postID, err := strconv.Atoi(idParam)
+	if err != nil {
+		return nil, data.ErrNotFound
+	}
+	post, err := store.Posts.Get(r.Context(), postID, 0)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := store.Comments.Latest(r.Context(), postID, cfg.FeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &feed{Title: "Forum : commentaires de « " + post.Title + " »", Link: absoluteURL(r, postURL(post.ID)), Updated: post.Created}
+	for _, c := range comments {
+		// Les commentaires antérieurs à leur datation prennent la date du sujet
+		published := post.Created
+		if c.Created.Valid {
+			published = c.Created.Time
+		}
+		if published.After(f.Updated) {
+			f.Updated = published
+		}
+		f.Entries = append(f.Entries, feedEntry{
+			Title:     "Commentaire de " + c.Username,
+			Link:      absoluteURL(r, commentURL(post.ID, c.ID)),
+			Author:    c.Username,
+			Published: published,
+			Content:   string(renderMarkdown(c.Content)),
+		})
+	}
+	return f, nil
+}
+
+func postsFeed(r *http.Request, title, link string, posts []Post) *feed {
+	f := &feed{Title: title, Link: absoluteURL(r, link)}
+	for _, p := range posts {
+		if p.Created.After(f.Updated) {
+			f.Updated = p.Created
+		}
+		content := string(renderMarkdown(p.Content))
+		for _, image := range p.Image {
+			content += `<p><img src="` + html.EscapeString(absoluteURL(r, mediaURL(image))) + `" alt=""></p>`
+		}
+		if p.Video != "" {
+			content += `<p><a href="` + html.EscapeString(absoluteURL(r, mediaURL(p.Video))) + `">Vidéo</a></p>`
+		}
+		f.Entries = append(f.Entries, feedEntry{
+			Title:     p.Title,
+			Link:      absoluteURL(r, postURL(p.ID)),
+			Author:    p.Username,
+			Published: p.Created,
+			Content:   content,
+		})
+	}
+	return f
+}
+
+// commentURL retourne l'adresse d'un commentaire, ancrée dans la page de son sujet
+func commentURL(postID, commentID int) string {
+	return postURL(postID) + "#comment-" + strconv.Itoa(commentID)
+}
+
+// absoluteURL préfixe le chemin par public_url, ou à défaut par l'hôte de la requête
+func absoluteURL(r *http.Request, path string) string {
+	base := cfg.BaseURL()
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + path
+}
+
+// userFeedURL retourne le flux Atom des sujets d'un utilisateur
+func userFeedURL(username string) string {
+	return feedPrefix + "user/" + url.PathEscape(username) + atomExtension
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Author    atomPerson `xml:"author"`
+	Link      atomLink   `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (f *feed) atom() ([]byte, error) {
+	out := atomFeed{
+		Title:   f.Title,
+		ID:      f.Self,
+		Updated: atomDate(f.Updated),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+	}
+	for _, e := range f.Entries {
+		out.Entries = append(out.Entries, atomEntry{
+			Title:     e.Title,
+			ID:        e.Link,
+			Updated:   atomDate(e.Published),
+			Published: atomDate(e.Published),
+			Author:    atomPerson{Name: e.Author},
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: e.Link},
+			Content:   atomText{Type: "html", Body: e.Content},
+		})
+	}
+	return encodeFeed(out)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+	// RSS réserve author aux adresses email : le nom passe par Dublin Core
+	Creator     string  `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (f *feed) rss() ([]byte, error) {
+	out := rssFeed{Version: "2.0", Channel: rssChannel{Title: f.Title, Link: f.Link, Description: f.Title, Language: "fr"}}
+	if !f.Updated.IsZero() {
+		out.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, e := range f.Entries {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			Creator:     e.Author,
+			Description: e.Content,
+			GUID:        rssGUID{IsPermaLink: true, Value: e.Link},
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return encodeFeed(out)
+}
+
+// atomDate formate une date RFC 3339 ; un flux vide date de l'époque Unix
+func atomDate(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func encodeFeed(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// getFeed sert le flux au chemin donné, avec les en-têtes de requête conditionnelle
+func getFeed(path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	(&feedHandler{}).ServeHTTP(w, r)
+	return w
+}
+
+func TestFeeds(t *testing.T) {
+	openTestDatabase(t)
+	useConfig(t).PublicURL = "https://forum.example"
+	aliceID := createUser(t, "alice")
+	ombreID := createUser(t, "ombre")
+	questionID := createPost(t, aliceID, "[Aide] Question")
+	createPost(t, aliceID, "Bonjour")
+	hiddenID := createPost(t, ombreID, "Sujet caché")
+	if err := store.Users.SetShadowbanned(context.Background(), ombreID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Comments.Create(context.Background(), &Comment{PostID: questionID, UserID: aliceID, Content: "Une **réponse**"}); err != nil {
+		t.Fatal(err)
+	}
+	thread := "/feed/thread/" + strconv.Itoa(questionID)
+
+	tests := []struct {
+		path        string
+		contentType string
+		want        []string
+		absent      []string
+	}{
+		{"/feed.atom", "application/atom+xml", []string{"<title>Bonjour</title>", "<title>[Aide] Question</title>", "https://forum.example" + postURL(questionID)}, []string{"Sujet caché"}},
+		{"/feed.rss", "application/rss+xml", []string{`<rss version="2.0"`, "<title>Bonjour</title>", `<creator xmlns="http://purl.org/dc/elements/1.1/">alice</creator>`}, []string{"Sujet caché"}},
+		{"/feed/category/Aide.atom", "application/atom+xml", []string{"[Aide] Question"}, []string{"Bonjour"}},
+		{"/feed/user/alice.rss", "application/rss+xml", []string{"Bonjour", "[Aide] Question"}, nil},
+		{thread + ".atom", "application/atom+xml", []string{"Commentaire de alice", "&lt;strong&gt;réponse&lt;/strong&gt;", "#comment-"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := getFeed(tt.path, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("statut %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("Content-Type %q, attendu %s", ct, tt.contentType)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("%q absent du flux :\n%s", s, w.Body.String())
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("%q présent dans le flux", s)
+				}
+			}
+		})
+	}
+
+	notFound := []string{
+		"/feed.json",
+		"/feed/category/Inconnue.atom",
+		"/feed/user/personne.atom",
+		"/feed/user/ombre.atom",
+		"/feed/thread/abc.atom",
+		"/feed/thread/" + strconv.Itoa(hiddenID) + ".rss",
+		"/feed/autre/x.atom",
+	}
+	for _, path := range notFound {
+		if w := getFeed(path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s : statut %d, attendu 404", path, w.Code)
+		}
+	}
+}
+
+func TestFeedConditionalRequests(t *testing.T) {
+	openTestDatabase(t)
+	useConfig(t)
+	aliceID := createUser(t, "alice")
+	createPost(t, aliceID, "Premier")
+
+	first := getFeed("/feed.atom", nil)
+	etag, modified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || modified == "" {
+		t.Fatalf("statut %d, ETag %q, Last-Modified %q", first.Code, etag, modified)
+	}
+
+	for name, header := range map[string]http.Header{
+		"If-None-Match":     {"If-None-Match": {etag}},
+		"If-Modified-Since": {"If-Modified-Since": {modified}},
+	} {
+		if w := getFeed("/feed.atom", header); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s : statut %d avec %d octets, attendu 304 sans corps", name, w.Code, w.Body.Len())
+		}
+	}
+
+	// Un nouveau sujet change le flux et son ETag
+	createPost(t, aliceID, "Second")
+	w := getFeed("/feed.atom", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("après un nouveau sujet : statut %d, ETag %q inchangé", w.Code, w.Header().Get("ETag"))
+	}
+}
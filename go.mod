@@ -4,9 +4,18 @@ go 1.21.0
 
 require github.com/go-sql-driver/mysql v1.8.1
 
-require filippo.io/edwards25519 v1.1.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+)
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.9.0
 	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/pelletier/go-toml/v2 v2.2.2
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/net v0.26.0
 )
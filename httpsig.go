@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	data "forum/Data"
+)
+
+// Les serveurs ActivityPub s'authentifient par signature HTTP (draft-cavage-http-signatures),
+// en rsa-sha256 comme Mastodon : la signature couvre la ligne de requête, l'hôte, la date et
+// l'empreinte du corps, et keyId désigne la clé publique de l'acteur signataire.
+const (
+	// Écart toléré entre l'en-tête Date et l'horloge locale
+	signatureMaxSkew = 12 * time.Hour
+	rsaKeyBits       = 2048
+)
+
+// Entêtes signés sur chaque requête sortante, et exigés sur chaque requête entrante
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+type httpSignature struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Signature []byte
+}
+
+// bodyDigest retourne la valeur de l'en-tête Digest pour le corps
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signRequest date et signe la requête, dont body est le corps
+func signRequest(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", bodyDigest(body))
+	signing, err := signingString(req.Method, req.URL.RequestURI(), req.URL.Host, req.Header, signedHeaders)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(signing))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(signedHeaders, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// signingString assemble les lignes « nom: valeur » des entêtes signés, dans leur ordre
+func signingString(method, target, host string, header http.Header, names []string) (string, error) {
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		var value string
+		switch name {
+		case "(request-target)":
+			value = strings.ToLower(method) + " " + target
+		case "host":
+			value = host
+		default:
+			values := header.Values(name)
+			if len(values) == 0 {
+				return "", fmt.Errorf("en-tête signé %s absent", name)
+			}
+			value = strings.Join(values, ", ")
+		}
+		lines = append(lines, name+": "+value)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseSignature lit l'en-tête Signature : keyId="…",algorithm="…",headers="…",signature="…"
+func parseSignature(header string) (*httpSignature, error) {
+	params := map[string]string{}
+	for header != "" {
+		name, rest, ok := strings.Cut(header, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return nil, errors.New("en-tête Signature mal formé")
+		}
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return nil, errors.New("en-tête Signature mal formé")
+		}
+		params[strings.TrimSpace(name)] = rest[1 : end+1]
+		header = strings.TrimPrefix(strings.TrimSpace(rest[end+2:]), ",")
+	}
+
+	sig := &httpSignature{KeyID: params["keyId"], Algorithm: params["algorithm"], Headers: strings.Fields(params["headers"])}
+	if sig.KeyID == "" || params["signature"] == "" {
+		return nil, errors.New("keyId ou signature manquant")
+	}
+	// hs2019 laisse la clé choisir l'algorithme : les acteurs n'ont que des clés RSA
+	if sig.Algorithm != "" && sig.Algorithm != "rsa-sha256" && sig.Algorithm != "hs2019" {
+		return nil, fmt.Errorf("algorithme %s non pris en charge", sig.Algorithm)
+	}
+	if len(sig.Headers) == 0 {
+		sig.Headers = []string{"date"}
+	}
+	var err error
+	if sig.Signature, err = base64.StdEncoding.DecodeString(params["signature"]); err != nil {
+		return nil, errors.New("signature illisible")
+	}
+	return sig, nil
+}
+
+// verifyRequest vérifie la signature d'une requête entrante dont body est le corps, et
+// retourne l'acteur distant qui l'a signée
+func verifyRequest(ctx context.Context, r *http.Request, body []byte) (*data.RemoteActor, error) {
+	sig, err := parseSignature(r.Header.Get("Signature"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range signedHeaders {
+		if !containsString(sig.Headers, name) {
+			return nil, fmt.Errorf("la signature doit couvrir %s", name)
+		}
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return nil, errors.New("en-tête Date illisible")
+	}
+	if skew := time.Since(date); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return nil, errors.New("en-tête Date trop éloigné de l'heure du serveur")
+	}
+	if !containsString(strings.Split(r.Header.Get("Digest"), ","), bodyDigest(body)) {
+		return nil, errors.New("l'empreinte Digest ne correspond pas au corps")
+	}
+	signing, err := signingString(r.Method, r.URL.RequestURI(), r.Host, r.Header, sig.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, err := fetchRemoteActor(ctx, sig.KeyID, false)
+	if err != nil {
+		return nil, err
+	}
+	if verifySignature(actor, sig, signing) != nil {
+		// L'acteur a pu changer de clé depuis sa mise en cache
+		if actor, err = fetchRemoteActor(ctx, sig.KeyID, true); err != nil {
+			return nil, err
+		}
+		if err := verifySignature(actor, sig, signing); err != nil {
+			return nil, err
+		}
+	}
+	return actor, nil
+}
+
+func verifySignature(actor *data.RemoteActor, sig *httpSignature, signing string) error {
+	if actor.KeyID != sig.KeyID {
+		return errors.New("clé inconnue de l'acteur")
+	}
+	key, err := parsePublicKey(actor.PublicKey)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(signing))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig.Signature); err != nil {
+		return errors.New("signature invalide")
+	}
+	return nil
+}
+
+// parsePublicKey lit une clé publique RSA PEM, au format PKIX ou PKCS #1
+func parsePublicKey(pemText string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemText))
+	if block == nil {
+		return nil, errors.New("clé publique illisible")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("seules les clés RSA sont prises en charge")
+	}
+	return rsaKey, nil
+}
+
+// newKeyPair génère la paire de clés PEM d'un acteur local
+func newKeyPair() (private, public string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return "", "", err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	private = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	public = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	return private, public, nil
+}
+
+func parsePrivateKey(pemText string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemText))
+	if block == nil {
+		return nil, errors.New("clé privée illisible")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("clé privée non RSA")
+	}
+	return rsaKey, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == s {
+			return true
+		}
+	}
+	return false
+}
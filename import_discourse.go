@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sauvegarde JSON de Discourse, au format des tables exportées par l'API d'administration :
+//
+//	{
+//	  "users":      [{"id", "username", "email"}],
+//	  "categories": [{"id", "name"}],
+//	  "topics":     [{"id", "title", "category_id", "user_id", "created_at", "pinned_at", "closed", "archived"}],
+//	  "posts":      [{"id", "topic_id", "user_id", "post_number", "raw", "created_at"}],
+//	  "uploads":    [{"post_id", "original_filename", "url"}]
+//	}
+//
+// Le message numéro 1 d'un sujet en est le contenu, les suivants en sont les réponses. Le
+// texte est déjà en Markdown. Les liens upload:// du texte ne sont pas réécrits : les fichiers
+// sont rattachés à leur message comme images du sujet ou liens en fin de texte.
+type discourseBackup struct {
+	Users []struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	} `json:"users"`
+	Categories []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"categories"`
+	Topics []struct {
+		ID         int        `json:"id"`
+		Title      string     `json:"title"`
+		CategoryID int        `json:"category_id"`
+		UserID     int        `json:"user_id"`
+		CreatedAt  time.Time  `json:"created_at"`
+		PinnedAt   *time.Time `json:"pinned_at"`
+		Closed     bool       `json:"closed"`
+		Archived   bool       `json:"archived"`
+	} `json:"topics"`
+	Posts []struct {
+		ID         int       `json:"id"`
+		TopicID    int       `json:"topic_id"`
+		UserID     int       `json:"user_id"`
+		PostNumber int       `json:"post_number"`
+		Raw        string    `json:"raw"`
+		CreatedAt  time.Time `json:"created_at"`
+	} `json:"posts"`
+	Uploads []struct {
+		PostID           int    `json:"post_id"`
+		OriginalFilename string `json:"original_filename"`
+		URL              string `json:"url"`
+	} `json:"uploads"`
+}
+
+// Identifiants réservés par Discourse à ses comptes système (system, discobot…)
+func discourseSystemUser(id int) bool {
+	return id <= 0
+}
+
+// readDiscourse lit une sauvegarde JSON de Discourse. uploadsDir est le répertoire public/
+// de Discourse, où chaque fichier se trouve sous son url ; vide, les fichiers sont ignorés.
+func readDiscourse(backupPath, uploadsDir string) (*foreignForum, error) {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var backup discourseBackup
+	if err := json.NewDecoder(f).Decode(&backup); err != nil {
+		return nil, err
+	}
+	id := strconv.Itoa
+
+	forum := &foreignForum{}
+	for _, u := range backup.Users {
+		if discourseSystemUser(u.ID) {
+			continue
+		}
+		forum.Users = append(forum.Users, foreignUser{ID: id(u.ID), Username: u.Username, Email: u.Email})
+	}
+
+	categories := map[int]string{}
+	for _, c := range backup.Categories {
+		categories[c.ID] = c.Name
+	}
+
+	files := map[int][]foreignFile{}
+	for _, u := range backup.Uploads {
+		if uploadsDir == "" || strings.Contains(u.URL, "://") {
+			continue
+		}
+		name := u.OriginalFilename
+		if name == "" {
+			name = path.Base(u.URL)
+		}
+		files[u.PostID] = append(files[u.PostID], foreignFile{
+			Name: name,
+			Path: filepath.Join(uploadsDir, filepath.FromSlash(path.Clean("/"+u.URL))),
+		})
+	}
+
+	topicIndex := map[int]int{}
+	for _, t := range backup.Topics {
+		topicIndex[t.ID] = len(forum.Topics)
+		forum.Topics = append(forum.Topics, foreignTopic{
+			ID:       id(t.ID),
+			UserID:   id(t.UserID),
+			Category: categories[t.CategoryID],
+			Title:    t.Title,
+			Created:  t.CreatedAt,
+			Pinned:   t.PinnedAt != nil,
+			Locked:   t.Closed,
+			Archived: t.Archived,
+		})
+	}
+
+	for _, p := range backup.Posts {
+		if p.PostNumber == 1 {
+			if i, ok := topicIndex[p.TopicID]; ok {
+				forum.Topics[i].Content = p.Raw
+				forum.Topics[i].Files = files[p.ID]
+			}
+			continue
+		}
+		forum.Replies = append(forum.Replies, foreignReply{
+			TopicID: id(p.TopicID),
+			UserID:  id(p.UserID),
+			Content: p.Raw,
+			Created: p.CreatedAt,
+			Files:   files[p.ID],
+		})
+	}
+	return forum, nil
+}
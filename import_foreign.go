@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	data "forum/Data"
+)
+
+// Contenu d'un forum tiers (phpBB, Discourse), ramené aux notions de ce forum. Les
+// catégories n'existent pas ici : elles préfixent le titre de leurs sujets.
+
+type foreignUser struct {
+	ID       string
+	Username string
+	Email    string
+}
+
+type foreignTopic struct {
+	ID       string
+	UserID   string
+	Category string
+	Title    string
+	Content  string
+	Created  time.Time
+	Pinned   bool
+	Locked   bool
+	Archived bool
+	Files    []foreignFile
+}
+
+type foreignReply struct {
+	TopicID string
+	UserID  string
+	Content string
+	Created time.Time
+	Files   []foreignFile
+}
+
+// foreignFile est une pièce jointe, lue sur disque dans les fichiers de l'ancien forum
+type foreignFile struct {
+	Name string
+	Path string
+}
+
+type foreignForum struct {
+	Users   []foreignUser
+	Topics  []foreignTopic
+	Replies []foreignReply
+}
+
+// Extensions que le forum sait afficher dans un sujet ; les autres pièces jointes deviennent des liens
+var (
+	imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+	videoExtensions = map[string]bool{".mp4": true, ".avi": true, ".mov": true}
+)
+
+// importForeign crée les comptes, sujets et commentaires d'un forum tiers. Comme pour
+// importForum, un email connu est fusionné et un nom déjà pris reçoit un suffixe ; les
+// comptes créés devront réinitialiser leur mot de passe.
+func importForeign(ctx context.Context, db *sql.DB, uploadDir string, forum *foreignForum) (importReport, error) {
+	var report importReport
+	var written []string
+	cleanup := func() {
+		for _, file := range written {
+			os.Remove(file)
+		}
+	}
+
+	// Copie les pièces jointes et retourne leur chemin enregistré en base, par nom d'origine
+	copyFiles := func(files []foreignFile) (map[string]string, error) {
+		stored := map[string]string{}
+		for _, file := range files {
+			f, err := os.Open(file.Path)
+			if err != nil {
+				log.Printf("Pièce jointe %s ignorée : %v\n", file.Name, err)
+				report.Skipped++
+				continue
+			}
+			name, created, err := extractMedia(f, uploadDir, safeFileName(file.Name))
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			if name != safeFileName(file.Name) {
+				report.MediaRenamed++
+			}
+			if created {
+				written = append(written, filepath.Join(uploadDir, name))
+				report.Media++
+			}
+			stored[file.Name] = path.Join(uploadURLPrefix, name)
+		}
+		return stored, nil
+	}
+
+	// Le commentaire le plus récent de chaque sujet fixe sa dernière activité
+	lastActivity := map[string]time.Time{}
+	for _, reply := range forum.Replies {
+		if reply.Created.After(lastActivity[reply.TopicID]) {
+			lastActivity[reply.TopicID] = reply.Created
+		}
+	}
+
+	err := data.Import(ctx, db, func(im *data.Importer) error {
+		userIDs := map[string]int{}
+		for _, u := range forum.Users {
+			if u.Email == "" || u.Username == "" {
+				report.Skipped++
+				continue
+			}
+			existing, err := im.UserByEmail(ctx, u.Email)
+			if err == nil {
+				userIDs[u.ID] = existing.ID
+				report.UsersMerged++
+				continue
+			}
+			if !errors.Is(err, data.ErrNotFound) {
+				return err
+			}
+			username, err := freeUsername(ctx, im, u.Username)
+			if err != nil {
+				return err
+			}
+			if username != u.Username {
+				report.UsersRenamed++
+			}
+			id, err := im.AddUser(ctx, &data.User{Email: u.Email, Username: username, Role: "user", MustResetPassword: true})
+			if err != nil {
+				return fmt.Errorf("compte %s : %w", u.Email, err)
+			}
+			userIDs[u.ID] = id
+			report.UsersCreated++
+		}
+
+		topicIDs := map[string]int{}
+		for _, t := range forum.Topics {
+			userID, ok := userIDs[t.UserID]
+			if !ok {
+				report.Skipped++
+				continue
+			}
+			title := t.Title
+			if t.Category != "" {
+				title = "[" + t.Category + "] " + title
+			}
+			post := &data.Post{
+				Title: title, Content: t.Content, UserID: userID, Pinned: t.Pinned,
+				Locked: t.Locked, Archived: t.Archived, Created: t.Created,
+			}
+			if last, ok := lastActivity[t.ID]; ok {
+				post.LastActivity = sql.NullTime{Time: last, Valid: true}
+			}
+			files, err := copyFiles(t.Files)
+			if err != nil {
+				return err
+			}
+			for _, file := range t.Files {
+				stored, ok := files[file.Name]
+				if !ok {
+					continue
+				}
+				ext := strings.ToLower(path.Ext(stored))
+				switch {
+				case imageExtensions[ext]:
+					post.Image = append(post.Image, stored)
+				case videoExtensions[ext] && post.Video == "":
+					post.Video = stored
+				default:
+					post.Content += attachmentLink(file.Name, stored)
+				}
+			}
+			id, err := im.AddPost(ctx, post)
+			if err != nil {
+				return fmt.Errorf("sujet %s : %w", t.ID, err)
+			}
+			topicIDs[t.ID] = id
+			report.Posts++
+		}
+
+		for _, reply := range forum.Replies {
+			postID, postOK := topicIDs[reply.TopicID]
+			userID, userOK := userIDs[reply.UserID]
+			if !postOK || !userOK {
+				report.Skipped++
+				continue
+			}
+			content := reply.Content
+			files, err := copyFiles(reply.Files)
+			if err != nil {
+				return err
+			}
+			for _, file := range reply.Files {
+				if stored, ok := files[file.Name]; ok {
+					content += attachmentLink(file.Name, stored)
+				}
+			}
+			if _, err := im.AddComment(ctx, &data.Comment{PostID: postID, UserID: userID, Content: content, Created: sql.NullTime{Time: reply.Created, Valid: !reply.Created.IsZero()}}); err != nil {
+				return err
+			}
+			report.Comments++
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return report, err
+	}
+	return report, nil
+}
+
+// attachmentLink ajoute au texte un lien Markdown vers une pièce jointe
+func attachmentLink(name, stored string) string {
+	return "\n\n[" + strings.NewReplacer("[", "", "]", "").Replace(name) + "](/" + stored + ")"
+}
+
+// safeFileName garde le nom d'origine d'une pièce jointe sans ses répertoires
+func safeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "piece-jointe"
+	}
+	return name
+}
+
+func printImportReport(report importReport) {
+	fmt.Printf("Comptes : %d créés, %d fusionnés avec un compte de même email, %d renommés\n", report.UsersCreated, report.UsersMerged, report.UsersRenamed)
+	fmt.Printf("Sujets : %d, commentaires : %d, votes : %d, éléments ignorés : %d\n", report.Posts, report.Comments, report.Votes, report.Skipped)
+	if report.Duplicates > 0 {
+		fmt.Printf("Déjà importés de cette archive, non dupliqués : %d sujets et commentaires\n", report.Duplicates)
+	}
+	fmt.Printf("Fichiers : %d copiés, %d renommés pour éviter un conflit\n", report.Media, report.MediaRenamed)
+	if report.UsersCreated > 0 {
+		fmt.Println("Les comptes créés n'ont pas de mot de passe : ils devront le réinitialiser avant de se connecter.")
+	}
+}
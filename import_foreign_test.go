@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Extrait d'un dump mysqldump de phpBB 3.3, avec le préfixe de tables par défaut
+const phpbbDump = "-- MySQL dump 10.13\n" +
+	"/*!40101 SET NAMES utf8mb4 */;\n" +
+	"CREATE TABLE `phpbb_users` (\n  `user_id` int unsigned NOT NULL,\n  `user_type` tinyint NOT NULL,\n  `username` varchar(255) NOT NULL,\n  `user_email` varchar(100) NOT NULL\n);\n" +
+	"INSERT INTO `phpbb_users` VALUES (1,2,'Anonymous',''),(2,3,'admin','admin@example.com'),(3,0,'bob &amp; co','bob@example.com');\n" +
+	"CREATE TABLE `phpbb_forums` (\n  `forum_id` int NOT NULL,\n  `forum_name` varchar(255) NOT NULL\n);\n" +
+	"INSERT INTO `phpbb_forums` VALUES (5,'Général');\n" +
+	"CREATE TABLE `phpbb_topics` (\n  `topic_id` int NOT NULL,\n  `forum_id` int NOT NULL,\n  `topic_title` varchar(255) NOT NULL,\n  `topic_poster` int NOT NULL,\n  `topic_time` int NOT NULL,\n  `topic_status` tinyint NOT NULL,\n  `topic_type` tinyint NOT NULL,\n  `topic_first_post_id` int NOT NULL\n);\n" +
+	"INSERT INTO `phpbb_topics` VALUES (10,5,'Bienvenue',2,1700000000,1,1,100),(11,5,'Déplacé',2,1700000000,2,0,102);\n" +
+	"CREATE TABLE `phpbb_posts` (\n  `post_id` int NOT NULL,\n  `topic_id` int NOT NULL,\n  `poster_id` int NOT NULL,\n  `post_time` int NOT NULL,\n  `post_text` mediumtext NOT NULL\n);\n" +
+	"INSERT INTO `phpbb_posts` VALUES (100,10,2,1700000000,'<r><B><s>[b]</s>Salut<e>[/b]</e></B> à tous ; l\\'équipe</r>'),\n" +
+	"(101,10,3,1700003600,'[quote=admin:abc12345]Salut[/quote:abc12345]\\nMerci !');\n"
+
+func TestReadPHPBB(t *testing.T) {
+	dump := filepath.Join(t.TempDir(), "phpbb.sql")
+	if err := os.WriteFile(dump, []byte(phpbbDump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	forum, err := readPHPBB(dump, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUsers := []foreignUser{{ID: "2", Username: "admin", Email: "admin@example.com"}, {ID: "3", Username: "bob & co", Email: "bob@example.com"}}
+	if !reflect.DeepEqual(forum.Users, wantUsers) {
+		t.Errorf("comptes %+v, attendu %+v", forum.Users, wantUsers)
+	}
+	if len(forum.Topics) != 1 {
+		t.Fatalf("%d sujets, attendu 1 (le sujet déplacé est ignoré)", len(forum.Topics))
+	}
+	topic := forum.Topics[0]
+	if topic.Title != "Bienvenue" || topic.Category != "Général" || !topic.Pinned || !topic.Locked || topic.UserID != "2" {
+		t.Errorf("sujet %+v", topic)
+	}
+	if topic.Content != "**Salut** à tous ; l'équipe" {
+		t.Errorf("contenu du sujet %q", topic.Content)
+	}
+	if !topic.Created.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("date du sujet %v", topic.Created)
+	}
+	if len(forum.Replies) != 1 || forum.Replies[0].TopicID != "10" || forum.Replies[0].Content != "> Salut\n\nMerci !" {
+		t.Errorf("réponses %+v", forum.Replies)
+	}
+}
+
+func TestPHPBBToMarkdown(t *testing.T) {
+	tests := map[string]string{
+		"<t>Texte simple</t>": "Texte simple",
+		"[b:1abcdefg]gras[/b:1abcdefg] et [i:1abcdefg]italique[/i:1abcdefg]":                            "**gras** et *italique*",
+		"[url=https://example.com:1abcdefg]lien[/url:1abcdefg]":                                         "[lien](https://example.com)",
+		"[list:1abcdefg][*:1abcdefg]un[/*:m:1abcdefg][*:1abcdefg]deux[/*:m:1abcdefg][/list:u:1abcdefg]": "- un\n- deux",
+		"[quote:1abcdefg][quote:1abcdefg]a[/quote:1abcdefg]b[/quote:1abcdefg]":                          "> > a\n> b",
+		"&lt;script&gt;": "<script>",
+	}
+	for text, want := range tests {
+		if got := phpbbToMarkdown(text); got != want {
+			t.Errorf("phpbbToMarkdown(%q) = %q, attendu %q", text, got, want)
+		}
+	}
+}
+
+func TestReadDiscourse(t *testing.T) {
+	dir := t.TempDir()
+	public := filepath.Join(dir, "public")
+	writeUpload(t, public, "uploads/default/original/1X/photo.png", "image")
+	backup := filepath.Join(dir, "discourse.json")
+	content := `{
+	"users": [{"id": -1, "username": "system", "email": "no_email"}, {"id": 1, "username": "alice", "email": "alice@example.com"}],
+	"categories": [{"id": 3, "name": "Aide"}],
+	"topics": [{"id": 7, "title": "Question", "category_id": 3, "user_id": 1, "created_at": "2024-01-02T10:00:00Z", "pinned_at": null, "closed": true, "archived": false}],
+	"posts": [
+		{"id": 70, "topic_id": 7, "user_id": 1, "post_number": 1, "raw": "Comment **faire** ?", "created_at": "2024-01-02T10:00:00Z"},
+		{"id": 71, "topic_id": 7, "user_id": -1, "post_number": 2, "raw": "Réponse automatique", "created_at": "2024-01-02T11:00:00Z"}
+	],
+	"uploads": [
+		{"post_id": 70, "original_filename": "photo.png", "url": "/uploads/default/original/1X/photo.png"},
+		{"post_id": 70, "original_filename": "cdn.png", "url": "https://cdn.example.com/cdn.png"}
+	]
+}`
+	if err := os.WriteFile(backup, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	forum, err := readDiscourse(backup, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forum.Users) != 1 || forum.Users[0].Username != "alice" {
+		t.Errorf("comptes %+v, attendu alice seule", forum.Users)
+	}
+	if len(forum.Topics) != 1 {
+		t.Fatalf("%d sujets, attendu 1", len(forum.Topics))
+	}
+	topic := forum.Topics[0]
+	if topic.Category != "Aide" || !topic.Locked || topic.Pinned || topic.Content != "Comment **faire** ?" {
+		t.Errorf("sujet %+v", topic)
+	}
+	wantFiles := []foreignFile{{Name: "photo.png", Path: filepath.Join(public, "uploads", "default", "original", "1X", "photo.png")}}
+	if !reflect.DeepEqual(topic.Files, wantFiles) {
+		t.Errorf("fichiers %+v, attendu %+v", topic.Files, wantFiles)
+	}
+	if len(forum.Replies) != 1 || forum.Replies[0].UserID != "-1" {
+		t.Errorf("réponses %+v", forum.Replies)
+	}
+}
+
+func TestImportForeign(t *testing.T) {
+	db := openTestDatabase(t)
+	createUser(t, "alice")
+	dir := t.TempDir()
+	writeUpload(t, dir, "photo.png", "image")
+	writeUpload(t, dir, "notes.pdf", "document")
+
+	forum := &foreignForum{
+		Users: []foreignUser{
+			{ID: "1", Username: "alice", Email: "alice@example.com"},
+			{ID: "2", Username: "alice", Email: "autre@example.com"},
+			{ID: "3", Username: "sansemail"},
+		},
+		Topics: []foreignTopic{{
+			ID: "10", UserID: "2", Category: "Aide", Title: "Question", Content: "Contenu",
+			Created: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+			Files:   []foreignFile{{Name: "photo.png", Path: filepath.Join(dir, "photo.png")}, {Name: "notes.pdf", Path: filepath.Join(dir, "notes.pdf")}},
+		}},
+		Replies: []foreignReply{
+			{TopicID: "10", UserID: "1", Content: "Réponse", Created: time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)},
+			{TopicID: "10", UserID: "3", Content: "Auteur ignoré"},
+			{TopicID: "99", UserID: "1", Content: "Sujet inconnu"},
+		},
+	}
+	uploadDir := t.TempDir()
+	report, err := importForeign(context.Background(), db, uploadDir, forum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := importReport{UsersCreated: 1, UsersMerged: 1, UsersRenamed: 1, Posts: 1, Comments: 1, Skipped: 3, Media: 2}
+	if report != want {
+		t.Errorf("rapport %+v, attendu %+v", report, want)
+	}
+
+	var username, password string
+	var mustReset bool
+	if err := db.QueryRow("SELECT username, password, must_reset_password FROM utilisateurs WHERE email = 'autre@example.com'").Scan(&username, &password, &mustReset); err != nil {
+		t.Fatal(err)
+	}
+	if username != "alice_2" || password != "" || !mustReset {
+		t.Errorf("compte importé : %q, mot de passe %q, réinitialisation %v", username, password, mustReset)
+	}
+
+	var title, content, image string
+	if err := db.QueryRow("SELECT p.title, p.content, i.image FROM posts p JOIN posts i ON i.post_id = p.id WHERE p.user_id IS NOT NULL").Scan(&title, &content, &image); err != nil {
+		t.Fatal(err)
+	}
+	if title != "[Aide] Question" || image != uploadURLPrefix+"/photo.png" {
+		t.Errorf("sujet importé %q avec l'image %q", title, image)
+	}
+	if !strings.HasSuffix(content, "[notes.pdf](/"+uploadURLPrefix+"/notes.pdf)") {
+		t.Errorf("lien vers la pièce jointe absent : %q", content)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lecture d'un dump MySQL de phpBB 3 (mysqldump), sans serveur MySQL : les instructions
+// CREATE TABLE donnent l'ordre des colonnes et les INSERT les lignes des tables utiles.
+
+// sqlRow associe le nom de chaque colonne à sa valeur ; NULL devient une chaîne vide
+type sqlRow map[string]string
+
+type sqlDump struct {
+	columns map[string][]string
+	rows    map[string][]sqlRow
+}
+
+var (
+	createTablePattern = regexp.MustCompile("(?is)^CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?`?(\\w+)`?\\s*\\((.*)\\)")
+	columnPattern      = regexp.MustCompile("(?m)(?:^|[(,])\\s*`(\\w+)`\\s")
+	insertPattern      = regexp.MustCompile("(?is)^(?:INSERT|REPLACE)(?:\\s+IGNORE)?\\s+INTO\\s+`?(\\w+)`?\\s*(?:\\(([^)]*)\\))?\\s*VALUES\\s*")
+)
+
+// parseSQLDump lit les tables dont le nom est accepté par keep
+func parseSQLDump(dump []byte, keep func(table string) bool) (*sqlDump, error) {
+	d := &sqlDump{columns: map[string][]string{}, rows: map[string][]sqlRow{}}
+	for _, stmt := range splitStatements(dump) {
+		if m := createTablePattern.FindSubmatch(stmt); m != nil {
+			table := string(m[1])
+			if keep(table) {
+				for _, c := range columnPattern.FindAllSubmatch(m[2], -1) {
+					d.columns[table] = append(d.columns[table], string(c[1]))
+				}
+			}
+			continue
+		}
+		m := insertPattern.FindSubmatchIndex(stmt)
+		if m == nil {
+			continue
+		}
+		table := string(stmt[m[2]:m[3]])
+		if !keep(table) {
+			continue
+		}
+		columns := d.columns[table]
+		if m[4] >= 0 {
+			columns = nil
+			for _, c := range strings.Split(string(stmt[m[4]:m[5]]), ",") {
+				columns = append(columns, strings.Trim(strings.TrimSpace(c), "`"))
+			}
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("colonnes de la table %s inconnues : CREATE TABLE absent du dump", table)
+		}
+		tuples, err := parseTuples(stmt[m[1]:])
+		if err != nil {
+			return nil, fmt.Errorf("table %s : %w", table, err)
+		}
+		for _, values := range tuples {
+			if len(values) != len(columns) {
+				return nil, fmt.Errorf("table %s : %d valeurs pour %d colonnes", table, len(values), len(columns))
+			}
+			row := sqlRow{}
+			for i, c := range columns {
+				row[c] = values[i]
+			}
+			d.rows[table] = append(d.rows[table], row)
+		}
+	}
+	return d, nil
+}
+
+// splitStatements découpe le dump sur les points-virgules hors chaînes et commentaires
+func splitStatements(dump []byte) [][]byte {
+	var stmts [][]byte
+	start := 0
+	for i := 0; i < len(dump); i++ {
+		switch c := dump[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(dump) && dump[i] != c; i++ {
+				if dump[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '-' && bytes.HasPrefix(dump[i:], []byte("-- ")), c == '#':
+			for i < len(dump) && dump[i] != '\n' {
+				i++
+			}
+		case c == '/' && bytes.HasPrefix(dump[i:], []byte("/*")):
+			end := bytes.Index(dump[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(dump)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			if stmt := bytes.TrimSpace(dump[start:i]); len(stmt) > 0 {
+				stmts = append(stmts, stripLeadingComments(stmt))
+			}
+			start = i + 1
+		}
+	}
+	return stmts
+}
+
+// stripLeadingComments retire les lignes de commentaire qui précèdent une instruction
+func stripLeadingComments(stmt []byte) []byte {
+	for {
+		stmt = bytes.TrimSpace(stmt)
+		switch {
+		case bytes.HasPrefix(stmt, []byte("--")), bytes.HasPrefix(stmt, []byte("#")):
+			end := bytes.IndexByte(stmt, '\n')
+			if end < 0 {
+				return nil
+			}
+			stmt = stmt[end+1:]
+		case bytes.HasPrefix(stmt, []byte("/*")):
+			end := bytes.Index(stmt, []byte("*/"))
+			if end < 0 {
+				return nil
+			}
+			stmt = stmt[end+2:]
+		default:
+			return stmt
+		}
+	}
+}
+
+// parseTuples lit une suite de n-uplets (v1, v2, …), (…) au format de mysqldump
+func parseTuples(s []byte) ([][]string, error) {
+	var tuples [][]string
+	i := 0
+	skipSpace := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\n' || s[i] == '\r' || s[i] == '\t') {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(s) {
+			return tuples, nil
+		}
+		if s[i] != '(' {
+			return nil, fmt.Errorf("n-uplet attendu à la position %d", i)
+		}
+		i++
+		var values []string
+		for {
+			skipSpace()
+			if i >= len(s) {
+				return nil, errors.New("n-uplet non terminé")
+			}
+			var value string
+			if s[i] == '\'' {
+				var b strings.Builder
+				for i++; i < len(s); i++ {
+					c := s[i]
+					if c == '\\' && i+1 < len(s) {
+						i++
+						b.WriteByte(unescapeMySQL(s[i]))
+						continue
+					}
+					if c == '\'' {
+						if i+1 < len(s) && s[i+1] == '\'' {
+							b.WriteByte('\'')
+							i++
+							continue
+						}
+						break
+					}
+					b.WriteByte(c)
+				}
+				i++
+				value = b.String()
+			} else {
+				start := i
+				for i < len(s) && s[i] != ',' && s[i] != ')' {
+					i++
+				}
+				value = strings.TrimSpace(string(s[start:i]))
+				if strings.EqualFold(value, "NULL") {
+					value = ""
+				}
+			}
+			values = append(values, value)
+			skipSpace()
+			if i >= len(s) {
+				return nil, errors.New("n-uplet non terminé")
+			}
+			if s[i] == ')' {
+				i++
+				break
+			}
+			if s[i] != ',' {
+				return nil, fmt.Errorf("virgule attendue à la position %d", i)
+			}
+			i++
+		}
+		tuples = append(tuples, values)
+		skipSpace()
+		if i < len(s) && s[i] == ',' {
+			i++
+		}
+	}
+}
+
+func unescapeMySQL(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'Z':
+		return 26
+	}
+	return c
+}
+
+// Constantes de phpBB 3
+const (
+	phpbbUserIgnore  = "2" // user_type des invités et des robots
+	phpbbTopicLocked = "1" // topic_status d'un sujet verrouillé
+	phpbbTopicMoved  = "2" // topic_status d'un sujet déplacé, simple redirection
+	phpbbPostNormal  = "0" // topic_type d'un sujet ni épinglé ni annonce
+)
+
+// readPHPBB lit un dump de phpBB 3. filesDir est le répertoire files/ de phpBB, où les
+// pièces jointes sont rangées sous leur physical_filename ; vide, elles sont ignorées.
+func readPHPBB(dumpPath, filesDir string) (*foreignForum, error) {
+	dump, err := os.ReadFile(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	prefix := phpbbPrefix(dump)
+	if prefix == "" {
+		return nil, errors.New("aucune table phpBB (…_topics) dans le dump")
+	}
+	tables := map[string]bool{}
+	for _, t := range []string{"users", "forums", "topics", "posts", "attachments"} {
+		tables[prefix+t] = true
+	}
+	d, err := parseSQLDump(dump, func(table string) bool { return tables[table] })
+	if err != nil {
+		return nil, err
+	}
+
+	forum := &foreignForum{}
+	for _, u := range d.rows[prefix+"users"] {
+		if u["user_type"] == phpbbUserIgnore {
+			continue
+		}
+		forum.Users = append(forum.Users, foreignUser{ID: u["user_id"], Username: html.UnescapeString(u["username"]), Email: u["user_email"]})
+	}
+
+	categories := map[string]string{}
+	for _, f := range d.rows[prefix+"forums"] {
+		categories[f["forum_id"]] = html.UnescapeString(f["forum_name"])
+	}
+
+	files := map[string][]foreignFile{}
+	for _, a := range d.rows[prefix+"attachments"] {
+		if filesDir == "" || a["is_orphan"] == "1" {
+			continue
+		}
+		files[a["post_msg_id"]] = append(files[a["post_msg_id"]], foreignFile{
+			Name: a["real_filename"],
+			Path: filepath.Join(filesDir, safeFileName(a["physical_filename"])),
+		})
+	}
+
+	firstPosts := map[string]bool{}
+	for _, t := range d.rows[prefix+"topics"] {
+		if t["topic_status"] == phpbbTopicMoved {
+			continue
+		}
+		firstPosts[t["topic_first_post_id"]] = true
+		forum.Topics = append(forum.Topics, foreignTopic{
+			ID:       t["topic_id"],
+			UserID:   t["topic_poster"],
+			Category: categories[t["forum_id"]],
+			Title:    html.UnescapeString(t["topic_title"]),
+			Created:  unixTime(t["topic_time"]),
+			Pinned:   t["topic_type"] != "" && t["topic_type"] != phpbbPostNormal,
+			Locked:   t["topic_status"] == phpbbTopicLocked,
+		})
+	}
+
+	// Le premier message d'un sujet en est le contenu, les suivants en sont les réponses
+	topicIndex := map[string]int{}
+	for i, t := range forum.Topics {
+		topicIndex[t.ID] = i
+	}
+	for _, p := range d.rows[prefix+"posts"] {
+		content := phpbbToMarkdown(p["post_text"])
+		if firstPosts[p["post_id"]] {
+			if i, ok := topicIndex[p["topic_id"]]; ok {
+				forum.Topics[i].Content = content
+				forum.Topics[i].Files = files[p["post_id"]]
+			}
+			continue
+		}
+		forum.Replies = append(forum.Replies, foreignReply{
+			TopicID: p["topic_id"],
+			UserID:  p["poster_id"],
+			Content: content,
+			Created: unixTime(p["post_time"]),
+			Files:   files[p["post_id"]],
+		})
+	}
+	return forum, nil
+}
+
+// phpbbPrefix retrouve le préfixe des tables, phpbb_ par défaut à l'installation
+var phpbbTopicsTable = regexp.MustCompile("(?i)CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?`?(\\w*?)topics`?\\s*\\(")
+
+func phpbbPrefix(dump []byte) string {
+	if m := phpbbTopicsTable.FindSubmatch(dump); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+func unixTime(s string) time.Time {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+var (
+	phpbbXMLTag    = regexp.MustCompile(`<[^>]+>`)
+	phpbbBBCodeUID = regexp.MustCompile(`\[(/?[a-z*]+(?:=[^\]]*)?(?::[a-z])?):[a-z0-9]{5,8}\]`)
+	phpbbSmiley    = regexp.MustCompile(`<!-- s(\S+) --><img[^>]*><!-- s\S+ -->`)
+	phpbbLink      = regexp.MustCompile(`<!-- [mlwe] --><a[^>]*href="([^"]*)"[^>]*>.*?</a><!-- [mlwe] -->`)
+	phpbbListClose = regexp.MustCompile(`\[/\*(?::m)?\]|\[/list(?::[uo])?\]`)
+
+	bbcodeRules = []struct {
+		pattern *regexp.Regexp
+		replace string
+	}{
+		{regexp.MustCompile(`(?is)\[b\](.*?)\[/b\]`), "**$1**"},
+		{regexp.MustCompile(`(?is)\[i\](.*?)\[/i\]`), "*$1*"},
+		{regexp.MustCompile(`(?is)\[u\](.*?)\[/u\]`), "$1"},
+		{regexp.MustCompile(`(?is)\[(?:color|size|font)=[^\]]*\](.*?)\[/(?:color|size|font)\]`), "$1"},
+		{regexp.MustCompile(`(?is)\[url=([^\]]+)\](.*?)\[/url\]`), "[$2]($1)"},
+		{regexp.MustCompile(`(?is)\[url\](.*?)\[/url\]`), "<$1>"},
+		{regexp.MustCompile(`(?is)\[email\](.*?)\[/email\]`), "<$1>"},
+		{regexp.MustCompile(`(?is)\[img\](.*?)\[/img\]`), "![]($1)"},
+		{regexp.MustCompile(`(?is)\[code(?:=\w+)?\]\s*(.*?)\s*\[/code\]`), "\n```\n$1\n```\n"},
+		{regexp.MustCompile(`(?i)\[list(?:=[^\]]*)?\]`), "\n"},
+		{regexp.MustCompile(`\[\*\]\s*`), "\n- "},
+		{regexp.MustCompile(`(?is)\[attachment=\d+\].*?\[/attachment\]`), ""},
+	}
+)
+
+// phpbbToMarkdown convertit le texte d'un message phpBB en Markdown. phpBB 3.2 et plus
+// stocke du XML autour du BBCode d'origine ; phpBB 3.0 et 3.1 du BBCode suffixé par un uid.
+func phpbbToMarkdown(text string) string {
+	if strings.HasPrefix(text, "<r>") || strings.HasPrefix(text, "<t>") {
+		text = strings.ReplaceAll(text, "<br/>", "")
+		text = phpbbXMLTag.ReplaceAllString(text, "")
+	} else {
+		text = phpbbSmiley.ReplaceAllString(text, "$1")
+		text = phpbbLink.ReplaceAllString(text, "$1")
+		text = phpbbBBCodeUID.ReplaceAllString(text, "[$1]")
+	}
+	text = html.UnescapeString(text)
+	text = phpbbListClose.ReplaceAllString(text, "")
+
+	for _, rule := range bbcodeRules {
+		text = rule.pattern.ReplaceAllString(text, rule.replace)
+	}
+	return strings.TrimSpace(convertQuotes(text))
+}
+
+// convertQuotes transforme les [quote] en citations Markdown, de la plus imbriquée à la
+// plus extérieure, chaque niveau ajoutant son chevron
+func convertQuotes(text string) string {
+	for {
+		end := strings.Index(text, "[/quote]")
+		if end < 0 {
+			return text
+		}
+		start := strings.LastIndex(text[:end], "[quote")
+		if start < 0 {
+			return text
+		}
+		open := strings.IndexByte(text[start:end], ']')
+		if open < 0 {
+			return text
+		}
+		inner := strings.TrimSpace(text[start+open+1 : end])
+		text = text[:start] + "\n> " + strings.ReplaceAll(inner, "\n", "\n> ") + "\n" + text[end+len("[/quote]"):]
+	}
+}
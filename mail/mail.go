@@ -0,0 +1,115 @@
+// Package mail envoie les emails du forum : par SMTP en production, ou dans une boîte
+// d'envoi locale, répertoire ou sortie standard, pour le développement et les tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message est un email en texte brut
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envoie un message ; le serveur choisit son implémentation d'après la configuration
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// format retourne le message au format RFC 5322, encodé en UTF-8
+func format(from string, msg *Message, now time.Time) ([]byte, error) {
+	for _, field := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(field, "\r\n") {
+			return nil, errors.New("retour à la ligne interdit dans un en-tête")
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
+
+// SMTP envoie par un serveur SMTP, en STARTTLS quand il le propose
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP retourne un Mailer qui passe par host:port ; sans nom d'utilisateur, il envoie
+// sans s'authentifier
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	m := &SMTP{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTP) Send(ctx context.Context, msg *Message) error {
+	body, err := format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, body)
+}
+
+// Outbox garde les messages au lieu de les envoyer : un fichier .eml par message dans un
+// répertoire, ou tous les messages à la suite sur un flux
+type Outbox struct {
+	mu   sync.Mutex
+	dir  string
+	w    io.Writer
+	from string
+}
+
+// NewDirOutbox écrit chaque message dans un fichier du répertoire dir, créé au besoin
+func NewDirOutbox(dir, from string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: dir, from: from}, nil
+}
+
+// NewWriterOutbox écrit les messages sur w, par exemple os.Stdout
+func NewWriterOutbox(w io.Writer, from string) *Outbox {
+	return &Outbox{w: w, from: from}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+	body, err := format(o.from, msg, now)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.dir == "" {
+		_, err := fmt.Fprintf(o.w, "%s\r\n\r\n", body)
+		return err
+	}
+	// Horodaté à la nanoseconde, le nom trie les messages par date d'envoi
+	name := filepath.Join(o.dir, now.UTC().Format("20060102T150405.000000000")+".eml")
+	return os.WriteFile(name, body, 0644)
+}
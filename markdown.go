@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Taille maximale d'un texte soumis à l'aperçu
+const maxPreviewSize = 64 << 10
+
+// Nombre de rendus gardés en cache avant de le vider
+const maxRenderCacheSize = 2000
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(spoilerExtension{}),
+		goldmark.WithRendererOptions(html.WithHardWraps()),
+	)
+
+	sanitizer = newSanitizer()
+
+	renderCacheMu sync.Mutex
+	renderCache   = map[[sha256.Size]byte]template.HTML{} // map of source hashes to their rendered HTML
+)
+
+// newSanitizer n'autorise que le HTML produit par le rendu Markdown
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+	p.RequireNoReferrerOnLinks(true)
+	return p
+}
+
+// renderMarkdown convertit le texte d'un post ou d'un commentaire en HTML assaini. Le rendu
+// est mis en cache sous l'empreinte du texte, si bien qu'une révision n'est rendue qu'une fois.
+func renderMarkdown(source string) template.HTML {
+	key := sha256.Sum256([]byte(source))
+
+	renderCacheMu.Lock()
+	rendered, ok := renderCache[key]
+	renderCacheMu.Unlock()
+	if ok {
+		return rendered
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		log.Println("Erreur lors du rendu Markdown:", err)
+		return template.HTML(template.HTMLEscapeString(source))
+	}
+	rendered = template.HTML(sanitizer.SanitizeBytes(buf.Bytes()))
+
+	renderCacheMu.Lock()
+	if len(renderCache) >= maxRenderCacheSize {
+		renderCache = map[[sha256.Size]byte]template.HTML{}
+	}
+	renderCache[key] = rendered
+	renderCacheMu.Unlock()
+	return rendered
+}
+
+type previewHandler struct{}
+
+func (h *previewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if _, ok := sessionUser(r); !ok {
+		http.Error(w, "Connexion requise", http.StatusUnauthorized)
+		return
+	}
+	content := r.FormValue("content")
+	if len(content) > maxPreviewSize {
+		http.Error(w, "Contenu trop long", http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(renderMarkdown(content)))
+}
+
+// Spoilers : ||texte caché|| est rendu dans un <span class="spoiler">
+var kindSpoiler = ast.NewNodeKind("Spoiler")
+
+type spoilerNode struct {
+	ast.BaseInline
+}
+
+func (n *spoilerNode) Kind() ast.NodeKind {
+	return kindSpoiler
+}
+
+func (n *spoilerNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type spoilerDelimiterProcessor struct{}
+
+func (p spoilerDelimiterProcessor) IsDelimiter(b byte) bool {
+	return b == '|'
+}
+
+func (p spoilerDelimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char
+}
+
+func (p spoilerDelimiterProcessor) OnMatch(consumes int) ast.Node {
+	return &spoilerNode{}
+}
+
+type spoilerParser struct{}
+
+func (s spoilerParser) Trigger() []byte {
+	return []byte{'|'}
+}
+
+func (s spoilerParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	node := parser.ScanDelimiter(line, before, 2, spoilerDelimiterProcessor{})
+	if node == nil || node.OriginalLength != 2 {
+		return nil
+	}
+
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+type spoilerRenderer struct{}
+
+func (r spoilerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSpoiler, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			w.WriteString(`<span class="spoiler">`)
+		} else {
+			w.WriteString("</span>")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+type spoilerExtension struct{}
+
+func (e spoilerExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(spoilerParser{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(spoilerRenderer{}, 500),
+	))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	for _, payload := range xssPayloads {
+		assertNoXSS(t, payload, string(renderMarkdown(payload)))
+	}
+}
+
+func TestRenderMarkdownKeepsFormatting(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"**gras**", "<strong>gras</strong>"},
+		{"[lien](https://example.com)", `href="https://example.com"`},
+		{"[lien](https://example.com)", `rel="nofollow noreferrer"`},
+		{"```go\nfmt.Println()\n```", `<code class="language-go">`},
+		{"un ||secret|| caché", `<span class="spoiler">secret</span>`},
+		{"||**gras** caché||", `<span class="spoiler"><strong>gras</strong> caché</span>`},
+	}
+	for _, tt := range tests {
+		if got := string(renderMarkdown(tt.source)); !strings.Contains(got, tt.want) {
+			t.Errorf("renderMarkdown(%q) = %q, attendu %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdownSpoilerNeedsTwoBars(t *testing.T) {
+	for _, source := range []string{"a | b | c", "|un seul|", "|| ||"} {
+		if got := string(renderMarkdown(source)); strings.Contains(got, "spoiler") {
+			t.Errorf("renderMarkdown(%q) = %q : spoiler inattendu", source, got)
+		}
+	}
+}
+
+func TestRenderCacheStoresSanitizedHTML(t *testing.T) {
+	renderCacheMu.Lock()
+	renderCache = map[[sha256.Size]byte]template.HTML{}
+	renderCacheMu.Unlock()
+
+	for _, payload := range xssPayloads {
+		first := renderMarkdown(payload)
+		renderCacheMu.Lock()
+		cached, ok := renderCache[sha256.Sum256([]byte(payload))]
+		renderCacheMu.Unlock()
+		if !ok {
+			t.Fatalf("%q : rendu absent du cache", payload)
+		}
+		assertNoXSS(t, payload, string(cached))
+		if second := renderMarkdown(payload); second != first || second != cached {
+			t.Errorf("%q : le second rendu diffère du premier", payload)
+		}
+	}
+}
+
+func TestRenderCacheIsBounded(t *testing.T) {
+	renderCacheMu.Lock()
+	renderCache = map[[sha256.Size]byte]template.HTML{}
+	renderCacheMu.Unlock()
+
+	for i := 0; i < maxRenderCacheSize+10; i++ {
+		renderMarkdown(strings.Repeat("x", i+1))
+	}
+	renderCacheMu.Lock()
+	size := len(renderCache)
+	renderCacheMu.Unlock()
+	if size > maxRenderCacheSize {
+		t.Errorf("cache de %d rendus, maximum %d", size, maxRenderCacheSize)
+	}
+	assertNoXSS(t, xssPayloads[0], string(renderMarkdown(xssPayloads[0])))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	data "forum/Data"
+	"forum/mail"
+)
+
+// « Mot de passe oublié » envoie un lien de réinitialisation à usage unique, valable une
+// heure. La base ne garde que l'empreinte du jeton, et la réponse est la même que l'adresse
+// corresponde ou non à un compte. Réinitialiser le mot de passe ferme toutes les sessions et
+// révoque les jetons d'API : qui a pris le compte ne le garde par aucun accès.
+const (
+	passwordResetTTL  = time.Hour
+	passwordResetPath = "/password/reset"
+	// Bornes de longueur du mot de passe, comme à l'inscription. La borne haute ne fait que
+	// limiter la taille des formulaires : une phrase de passe doit tenir.
+	minPasswordLength = 6
+	maxPasswordLength = 64
+)
+
+type PasswordForgotPageData struct {
+	Sent bool
+}
+
+type PasswordResetPageData struct {
+	Token string
+	Valid bool
+	Error string
+}
+
+// forgotPasswordHandler envoie un lien de réinitialisation à l'adresse saisie
+type forgotPasswordHandler struct{}
+
+func (h *forgotPasswordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		renderTemplate(w, r, "password_forgot.html", PasswordForgotPageData{})
+	case http.MethodPost:
+		email := strings.TrimSpace(r.FormValue("email"))
+		if err := requestPasswordReset(r, email); err != nil {
+			log.Println("Erreur lors de la demande de réinitialisation du mot de passe:", err)
+		}
+		// Même page dans tous les cas, pour ne pas révéler quelles adresses ont un compte
+		renderTemplate(w, r, "password_forgot.html", PasswordForgotPageData{Sent: true})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// requestPasswordReset crée une demande pour le compte de cette adresse et lui envoie le lien.
+// Une adresse inconnue n'est pas une erreur ; les comptes distants n'ont pas de mot de passe.
+func requestPasswordReset(r *http.Request, email string) error {
+	if email == "" {
+		return nil
+	}
+	user, err := store.Users.ByEmail(r.Context(), email)
+	if errors.Is(err, data.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.IsRemote() {
+		return nil
+	}
+
+	secret := newResetSecret()
+	reset := &data.PasswordReset{UserID: user.ID, Hash: hashToken(secret), ExpiresAt: time.Now().Add(passwordResetTTL)}
+	if _, err := store.Resets.Create(r.Context(), reset); err != nil {
+		return err
+	}
+	msg := &mail.Message{
+		To:      user.Email,
+		Subject: "Réinitialisation de votre mot de passe",
+		Body: "Bonjour " + user.Username + ",\n\n" +
+			"Pour choisir un nouveau mot de passe, ouvrez ce lien :\n\n" +
+			mailURL(passwordResetPath+"?token="+url.QueryEscape(secret)) + "\n\n" +
+			"Il ne sert qu'une fois et expire dans " + strconv.Itoa(int(passwordResetTTL.Minutes())) + " minutes. " +
+			"Si vous n'avez rien demandé, ignorez ce message : votre mot de passe reste inchangé.\n",
+	}
+	// Envoyé en arrière-plan : le temps de réponse ne trahit pas l'existence du compte
+	go func() {
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			log.Println("Erreur lors de l'envoi de l'email de réinitialisation:", err)
+		}
+	}()
+	return nil
+}
+
+func newResetSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Erreur lors de la génération d'un jeton de réinitialisation:", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validPassword vérifie la longueur du mot de passe, ou retourne le message à afficher
+func validPassword(password string) (string, bool) {
+	if n := len([]rune(password)); n < minPasswordLength || n > maxPasswordLength {
+		return "Le mot de passe doit contenir entre " + strconv.Itoa(minPasswordLength) + " et " + strconv.Itoa(maxPasswordLength) + " caractères.", false
+	}
+	return "", true
+}
+
+// samePassword compare le mot de passe saisi à celui du compte en temps constant, pour que
+// la durée de la réponse ne révèle pas combien de caractères correspondent
+func samePassword(given, stored string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(stored)) == 1
+}
+
+// resetPasswordHandler affiche le formulaire du lien reçu par email et enregistre le nouveau mot de passe
+type resetPasswordHandler struct{}
+
+func (h *resetPasswordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		reset, err := activeReset(r.Context(), token)
+		if err != nil {
+			log.Println("Erreur lors de la vérification du jeton de réinitialisation:", err)
+			http.Error(w, "Erreur lors de la vérification du lien", http.StatusInternalServerError)
+			return
+		}
+		renderTemplate(w, r, "password_reset.html", PasswordResetPageData{Token: token, Valid: reset != nil})
+	case http.MethodPost:
+		token := r.FormValue("token")
+		reset, err := activeReset(r.Context(), token)
+		if err != nil {
+			log.Println("Erreur lors de la vérification du jeton de réinitialisation:", err)
+			http.Error(w, "Erreur lors de la vérification du lien", http.StatusInternalServerError)
+			return
+		}
+		if reset == nil {
+			renderTemplate(w, r, "password_reset.html", PasswordResetPageData{})
+			return
+		}
+		password := r.FormValue("password")
+		message, ok := validPassword(password)
+		if ok && password != r.FormValue("confirm") {
+			message, ok = "Les deux mots de passe ne correspondent pas.", false
+		}
+		if !ok {
+			renderTemplate(w, r, "password_reset.html", PasswordResetPageData{Token: token, Valid: true, Error: message})
+			return
+		}
+		if err := resetPassword(r.Context(), reset, password); err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				renderTemplate(w, r, "password_reset.html", PasswordResetPageData{})
+				return
+			}
+			log.Println("Erreur lors de la réinitialisation du mot de passe:", err)
+			http.Error(w, "Erreur lors de la réinitialisation du mot de passe", http.StatusInternalServerError)
+			return
+		}
+		setCookie(w, "error", "Mot de passe modifie : connectez-vous avec le nouveau mot de passe")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// activeReset retourne la demande encore valable du jeton, ou nil
+func activeReset(ctx context.Context, token string) (*data.PasswordReset, error) {
+	if token == "" {
+		return nil, nil
+	}
+	reset, err := store.Resets.ByHash(ctx, hashToken(token))
+	if errors.Is(err, data.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !reset.Valid(time.Now()) {
+		return nil, nil
+	}
+	return reset, nil
+}
+
+// resetPassword consomme la demande, change le mot de passe puis ferme les sessions et
+// révoque les jetons d'API du compte.
+// ErrNotFound signale une demande déjà consommée par une requête concurrente.
+func resetPassword(ctx context.Context, reset *data.PasswordReset, password string) error {
+	now := time.Now()
+	if err := store.Resets.Use(ctx, reset.ID, now); err != nil {
+		return err
+	}
+	user, err := store.Users.ByID(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+	if err := store.Users.ResetPassword(ctx, user.ID, password); err != nil {
+		return err
+	}
+	// Les autres liens envoyés ne doivent plus pouvoir changer le mot de passe
+	if err := store.Resets.Discard(ctx, user.ID, now); err != nil {
+		log.Println("Erreur lors de l'invalidation des autres liens de réinitialisation:", err)
+	}
+	endSessions(user.Email)
+	return store.Tokens.RevokeAll(ctx, user.ID, now)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// requestReset soumet le formulaire « Mot de passe oublié » depuis un hôte choisi par le client
+func requestReset(email string) *httptest.ResponseRecorder {
+	r := postForm("/password/forgot", url.Values{"email": {email}})
+	r.Host = "attaquant.example"
+	w := httptest.NewRecorder()
+	(&forgotPasswordHandler{}).ServeHTTP(w, r)
+	return w
+}
+
+// submitReset envoie le nouveau mot de passe avec le jeton du lien
+func submitReset(token, password, confirm string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	form := url.Values{"token": {token}, "password": {password}, "confirm": {confirm}}
+	(&resetPasswordHandler{}).ServeHTTP(w, postForm(passwordResetPath, form))
+	return w
+}
+
+const invalidResetLink = "Ce lien de réinitialisation est invalide"
+
+func TestPasswordReset(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	useConfig(t).PublicURL = "https://forum.example"
+	outbox := useMailer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	apiToken := createToken(t, aliceID, []string{scopeRead}, time.Now().Add(time.Hour))
+	withSession(t, httptest.NewRequest(http.MethodGet, "/", nil), "alice@example.com")
+
+	// Même réponse pour une adresse inconnue, sans email envoyé
+	unknown := requestReset("personne@example.com")
+	known := requestReset("alice@example.com")
+	if unknown.Code != http.StatusOK || known.Code != http.StatusOK || unknown.Body.String() != known.Body.String() {
+		t.Fatalf("réponses distinctes : %d et %d", unknown.Code, known.Code)
+	}
+	link := lastLink(t, outbox)
+	if strings.Contains(outbox.String(), "personne@example.com") {
+		t.Error("email envoyé à une adresse sans compte")
+	}
+	if !strings.HasPrefix(link, "https://forum.example"+passwordResetPath+"?token=") {
+		t.Fatalf("lien %q hors de public_url", link)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := u.Query().Get("token")
+	// La base ne garde que l'empreinte du jeton
+	if _, err := store.Resets.ByHash(ctx, token); err == nil {
+		t.Error("jeton enregistré en clair")
+	}
+
+	if w := submitReset(token, "nouveau1", "nouveau2"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ne correspondent pas") {
+		t.Errorf("confirmation différente : statut %d", w.Code)
+	}
+	assertRedirect(t, submitReset(token, "nouveau1", "nouveau1"), "/login")
+
+	alice, err := store.Users.ByID(ctx, aliceID)
+	if err != nil || alice.Password != "nouveau1" {
+		t.Fatalf("mot de passe non modifié : %+v, %v", alice, err)
+	}
+	if _, ok := sessionEmail("session-alice@example.com"); ok {
+		t.Error("session toujours ouverte après la réinitialisation")
+	}
+	if revoked, err := store.Tokens.ByHash(ctx, hashToken(apiToken)); err != nil || revoked.Active(time.Now()) {
+		t.Errorf("jeton d'API toujours actif après la réinitialisation : %+v, %v", revoked, err)
+	}
+
+	// Le lien ne sert qu'une fois
+	if w := submitReset(token, "encore11", "encore11"); !strings.Contains(w.Body.String(), invalidResetLink) {
+		t.Error("lien accepté une seconde fois")
+	}
+	if alice, _ := store.Users.ByID(ctx, aliceID); alice.Password != "nouveau1" {
+		t.Errorf("mot de passe %q après un lien déjà utilisé", alice.Password)
+	}
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	aliceID := createUser(t, "alice")
+	secret := newResetSecret()
+	reset := &data.PasswordReset{UserID: aliceID, Hash: hashToken(secret), ExpiresAt: time.Now().Add(-time.Minute)}
+	if _, err := store.Resets.Create(context.Background(), reset); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	(&resetPasswordHandler{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, passwordResetPath+"?token="+url.QueryEscape(secret), nil))
+	if !strings.Contains(w.Body.String(), invalidResetLink) {
+		t.Error("lien expiré affiché comme valable")
+	}
+	if w := submitReset(secret, "nouveau1", "nouveau1"); !strings.Contains(w.Body.String(), invalidResetLink) {
+		t.Error("lien expiré accepté")
+	}
+	if alice, _ := store.Users.ByID(context.Background(), aliceID); alice.Password != "secret1" {
+		t.Errorf("mot de passe %q changé par un lien expiré", alice.Password)
+	}
+}
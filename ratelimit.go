@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limitRule décrit un seau à jetons : Burst soumissions d'affilée, puis une toutes les Every
+type limitRule struct {
+	Every time.Duration
+	Burst int
+}
+
+// Limites appliquées aux requêtes POST de chaque route, par IP et par utilisateur connecté
+var routeLimits = map[string]limitRule{
+	"/login":    {Every: 10 * time.Second, Burst: 5},
+	"/register": {Every: time.Minute, Burst: 3},
+	"/newpost":  {Every: 30 * time.Second, Burst: 3},
+	"/details/": {Every: 10 * time.Second, Burst: 5},
+	"/signaler": {Every: time.Minute, Burst: 5},
+	// Chaque renvoi part dans la boîte de l'utilisateur
+	"/verify/resend": {Every: 5 * time.Minute, Burst: 2},
+	// Limite les emails envoyés à un tiers et les essais de jetons
+	"/password/forgot": {Every: time.Minute, Burst: 3},
+	"/password/reset":  {Every: 10 * time.Second, Burst: 5},
+	// Le mot de passe actuel y est vérifié
+	"/profil/settings": {Every: 10 * time.Second, Burst: 5},
+	// Les serveurs distants livrent par rafales, pour tous leurs utilisateurs à la fois
+	"/ap/inbox": {Every: time.Second, Burst: 30},
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	rule    limitRule
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(rule limitRule) *rateLimiter {
+	l := &rateLimiter{rule: rule, buckets: map[string]*tokenBucket{}}
+	go l.prune(10 * time.Minute)
+	return l
+}
+
+// allow consomme un jeton pour key, ou retourne le délai avant qu'un jeton soit disponible
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.rule.Burst), b.tokens+float64(now.Sub(b.last))/float64(l.rule.Every))
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * float64(l.rule.Every))
+}
+
+// prune oublie régulièrement les seaux restés inactifs assez longtemps pour être pleins
+func (l *rateLimiter) prune(interval time.Duration) {
+	for range time.Tick(interval) {
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if time.Since(b.last) > time.Duration(l.rule.Burst)*l.rule.Every {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// limitRequests limite les soumissions POST vers next selon la règle, par IP puis par utilisateur
+func limitRequests(rule limitRule, next http.Handler) http.Handler {
+	limiter := newRateLimiter(rule)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		keys := []string{"ip:" + clientIP(r)}
+		if user, ok := sessionUser(r); ok {
+			keys = append(keys, "user:"+strconv.Itoa(user.ID))
+		}
+		for _, key := range keys {
+			if ok, wait := limiter.allow(key); !ok {
+				tooManyRequests(w, r, wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP retourne l'adresse IP de la connexion, sans le port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("Trop de tentatives, réessayez dans %d secondes", seconds)
+	if isAPIRequest(r) {
+		apiError(w, http.StatusTooManyRequests, "rate_limited", message)
+		return
+	}
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+const (
+	// Nombre d'échecs de connexion tolérés avant de verrouiller le compte
+	maxLoginFailures = 5
+	// Durée du premier verrouillage, doublée à chaque nouvel échec
+	baseLoginLockout = time.Minute
+	maxLoginLockout  = 24 * time.Hour
+)
+
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+var (
+	loginFailuresMu sync.Mutex
+	failedLogins    = map[string]*loginFailures{} // map of emails to their consecutive failed logins
+)
+
+// loginLockedFor retourne le temps restant avant que le compte accepte de nouvelles tentatives
+func loginLockedFor(email string) time.Duration {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	f, ok := failedLogins[email]
+	if !ok {
+		return 0
+	}
+	if wait := time.Until(f.lockedUntil); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// recordLoginFailure compte un échec et verrouille le compte de plus en plus longtemps
+func recordLoginFailure(email string) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	f, ok := failedLogins[email]
+	if !ok {
+		f = &loginFailures{}
+		failedLogins[email] = f
+	}
+	f.count++
+	f.last = time.Now()
+	if f.count >= maxLoginFailures {
+		lockout := maxLoginLockout
+		if n := f.count - maxLoginFailures; n < 16 {
+			lockout = min(baseLoginLockout<<n, maxLoginLockout)
+		}
+		f.lockedUntil = time.Now().Add(lockout)
+	}
+}
+
+// resetLoginFailures efface les échecs après une connexion réussie
+func resetLoginFailures(email string) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	delete(failedLogins, email)
+}
+
+// pruneLoginFailures oublie régulièrement les échecs des comptes qui ne sont plus verrouillés
+// et n'ont pas reçu de tentative depuis maxLoginLockout. Sans cela, des emails inventés
+// feraient grossir failedLogins sans limite.
+func pruneLoginFailures(interval time.Duration) {
+	for range time.Tick(interval) {
+		forgetStaleLoginFailures(time.Now())
+	}
+}
+
+// forgetStaleLoginFailures supprime les échecs devenus sans effet à l'instant now
+func forgetStaleLoginFailures(now time.Time) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	for email, f := range failedLogins {
+		if now.After(f.lockedUntil) && now.Sub(f.last) > maxLoginLockout {
+			delete(failedLogins, email)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := &rateLimiter{rule: limitRule{Every: time.Minute, Burst: 2}, buckets: map[string]*tokenBucket{}}
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("soumission %d refusée dans la rafale", i+1)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait <= 0 || wait > time.Minute {
+		t.Errorf("après la rafale : autorisé %v, attente %s", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("une autre clé partage le seau de la première")
+	}
+
+	// Le seau se remplit avec le temps écoulé
+	l.buckets["a"].last = time.Now().Add(-time.Minute)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("jeton non rendu après une minute")
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	openTestDatabase(t)
+	createUser(t, "alice")
+	handler := limitRequests(limitRule{Every: time.Hour, Burst: 2}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(method, ip, email string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/newpost", nil)
+		r.RemoteAddr = ip + ":1234"
+		if email != "" {
+			r = withSession(t, r, email)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send(http.MethodPost, "192.0.2.1", ""); w.Code != http.StatusOK {
+			t.Fatalf("soumission %d : statut %d", i+1, w.Code)
+		}
+	}
+	w := send(http.MethodPost, "192.0.2.1", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("soumission au-delà de la rafale : statut %d, attendu 429", w.Code)
+	}
+	if retry, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retry <= 0 || retry > 3600 {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+	if w := send(http.MethodGet, "192.0.2.1", ""); w.Code != http.StatusOK {
+		t.Errorf("lecture limitée : statut %d", w.Code)
+	}
+
+	// Un utilisateur connecté est aussi limité en changeant d'adresse
+	for i, ip := range []string{"192.0.2.2", "192.0.2.3"} {
+		if w := send(http.MethodPost, ip, "alice@example.com"); w.Code != http.StatusOK {
+			t.Fatalf("soumission %d d'alice : statut %d", i+1, w.Code)
+		}
+	}
+	if w := send(http.MethodPost, "192.0.2.4", "alice@example.com"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("alice depuis une nouvelle adresse : statut %d, attendu 429", w.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	openTestDatabase(t)
+	createUser(t, "alice")
+	t.Cleanup(func() { resetLoginFailures("alice@example.com") })
+
+	login := func(password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		(&loginHandler{}).ServeHTTP(w, postForm("/login", url.Values{"email": {"alice@example.com"}, "password": {password}}))
+		return w
+	}
+	for i := 0; i < maxLoginFailures; i++ {
+		assertRedirect(t, login("mauvais"), "/login")
+	}
+	// Le compte est verrouillé, même pour le bon mot de passe
+	w := login("secret1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("connexion pendant le verrouillage : statut %d, attendu 429", w.Code)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry <= 0 || retry > int(baseLoginLockout.Seconds()) {
+		t.Errorf("Retry-After = %q, attendu au plus %s", w.Header().Get("Retry-After"), baseLoginLockout)
+	}
+
+	// Chaque nouvel échec double le verrouillage
+	recordLoginFailure("alice@example.com")
+	if wait := loginLockedFor("alice@example.com"); wait <= baseLoginLockout || wait > 2*baseLoginLockout {
+		t.Errorf("verrouillage de %s après un nouvel échec, attendu %s", wait, 2*baseLoginLockout)
+	}
+
+	// À l'échéance, une connexion réussie efface les échecs
+	loginFailuresMu.Lock()
+	failedLogins["alice@example.com"].lockedUntil = time.Now()
+	loginFailuresMu.Unlock()
+	assertRedirect(t, login("secret1"), "/")
+	if wait := loginLockedFor("alice@example.com"); wait != 0 {
+		t.Errorf("compte encore verrouillé %s après une connexion réussie", wait)
+	}
+	recordLoginFailure("alice@example.com")
+	if wait := loginLockedFor("alice@example.com"); wait != 0 {
+		t.Errorf("verrouillé %s dès le premier échec suivant", wait)
+	}
+}
+
+func TestForgetStaleLoginFailures(t *testing.T) {
+	loginFailuresMu.Lock()
+	previous := failedLogins
+	now := time.Now()
+	failedLogins = map[string]*loginFailures{
+		"oublie@example.com":     {count: 2, last: now.Add(-maxLoginLockout - time.Minute)},
+		"recent@example.com":     {count: 2, last: now.Add(-time.Minute)},
+		"verrouille@example.com": {count: 20, last: now.Add(-maxLoginLockout - time.Minute), lockedUntil: now.Add(time.Minute)},
+	}
+	loginFailuresMu.Unlock()
+	t.Cleanup(func() {
+		loginFailuresMu.Lock()
+		failedLogins = previous
+		loginFailuresMu.Unlock()
+	})
+
+	forgetStaleLoginFailures(now)
+	for email, kept := range map[string]bool{"oublie@example.com": false, "recent@example.com": true, "verrouille@example.com": true} {
+		if _, ok := failedLogins[email]; ok != kept {
+			t.Errorf("%s : conservé %v, attendu %v", email, ok, kept)
+		}
+	}
+}
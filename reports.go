@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	data "forum/Data"
+)
+
+const maxReportReasonLength = 500
+
+// reportEvent est la charge utile de report.filed
+type reportEvent struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	CommentID int       `json:"comment_id,omitempty"`
+	Reporter  string    `json:"reporter"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// reportHandler enregistre le signalement d'un sujet ou d'un commentaire par un membre
+// connecté et l'annonce aux webhooks abonnés à report.filed
+type reportHandler struct{}
+
+func (h *reportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	user, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
+		return
+	}
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Post non trouvé", http.StatusNotFound)
+		return
+	}
+
+	// Seul ce que le membre peut lire peut être signalé
+	ctx := r.Context()
+	if _, err := store.Posts.Get(ctx, postID, user.ID); err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			http.Error(w, "Post non trouvé", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Erreur lors de la récupération du post", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération du post:", err)
+		return
+	}
+	var commentID int
+	if param := r.FormValue("comment_id"); param != "" {
+		commentID, err = strconv.Atoi(param)
+		if err != nil {
+			http.Error(w, "Commentaire non trouvé", http.StatusNotFound)
+			return
+		}
+		comment, err := store.Comments.Get(ctx, commentID, user.ID)
+		if errors.Is(err, data.ErrNotFound) || (err == nil && comment.PostID != postID) {
+			http.Error(w, "Commentaire non trouvé", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erreur lors de la récupération du commentaire", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération du commentaire:", err)
+			return
+		}
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" || utf8.RuneCountInString(reason) > maxReportReasonLength {
+		setErrorCookie(w, "Le motif du signalement doit faire entre 1 et "+strconv.Itoa(maxReportReasonLength)+" caracteres")
+		http.Redirect(w, r, postURL(postID), http.StatusSeeOther)
+		return
+	}
+	report := &data.Report{UserID: user.ID, PostID: postID, CommentID: commentID, Reason: reason}
+	id, err := store.Reports.Create(ctx, report)
+	if err != nil {
+		http.Error(w, "Erreur lors de l'enregistrement du signalement", http.StatusInternalServerError)
+		log.Println("Erreur lors de l'enregistrement du signalement:", err)
+		return
+	}
+	// Les signalements d'un membre shadowbanné sont gardés sans alerter les modérateurs
+	if !user.Shadowbanned {
+		emitEvent(ctx, eventReportFiled, reportEvent{
+			ID: id, PostID: postID, CommentID: commentID, Reporter: user.Username, Reason: reason, CreatedAt: time.Now().UTC(),
+		})
+	}
+	http.Redirect(w, r, postURL(postID), http.StatusSeeOther)
+}
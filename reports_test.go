@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	data "forum/Data"
+)
+
+func TestReportHandler(t *testing.T) {
+	openTestDatabase(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	createUser(t, "bob")
+	ombreID := createUser(t, "ombre")
+	postID := createPost(t, aliceID, "Sujet signalé")
+	otherID := createPost(t, aliceID, "Autre sujet")
+	commentID, err := store.Comments.Create(ctx, &Comment{PostID: postID, UserID: aliceID, Content: "Réponse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hiddenID := createPost(t, ombreID, "Sujet caché")
+	if err := store.Users.SetShadowbanned(ctx, ombreID, true); err != nil {
+		t.Fatal(err)
+	}
+	hookID, err := store.Webhooks.Create(ctx, &data.Webhook{URL: "http://127.0.0.1/", Secret: newWebhookSecret(), Events: []string{eventReportFiled}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := func(email string, form url.Values) *httptest.ResponseRecorder {
+		r := postForm("/signaler", form)
+		if email != "" {
+			r = withSession(t, r, email)
+		}
+		w := httptest.NewRecorder()
+		(&reportHandler{}).ServeHTTP(w, r)
+		return w
+	}
+
+	assertRedirect(t, report("", url.Values{"post_id": {strconv.Itoa(postID)}, "reason": {"Spam"}}), "/login")
+	rejected := map[string]struct {
+		form   url.Values
+		status int
+	}{
+		"sujet inconnu":          {url.Values{"post_id": {"9999"}, "reason": {"Spam"}}, http.StatusNotFound},
+		"sujet invisible":        {url.Values{"post_id": {strconv.Itoa(hiddenID)}, "reason": {"Spam"}}, http.StatusNotFound},
+		"commentaire d'un autre": {url.Values{"post_id": {strconv.Itoa(otherID)}, "comment_id": {strconv.Itoa(commentID)}, "reason": {"Spam"}}, http.StatusNotFound},
+		"commentaire inconnu":    {url.Values{"post_id": {strconv.Itoa(postID)}, "comment_id": {"9999"}, "reason": {"Spam"}}, http.StatusNotFound},
+		"motif vide":             {url.Values{"post_id": {strconv.Itoa(postID)}, "reason": {"  "}}, http.StatusSeeOther},
+	}
+	for name, tt := range rejected {
+		if w := report("bob@example.com", tt.form); w.Code != tt.status {
+			t.Errorf("%s : statut %d, attendu %d", name, w.Code, tt.status)
+		}
+	}
+	if n := countRows(t, testDB, "SELECT COUNT(*) FROM reports"); n != 0 {
+		t.Fatalf("%d signalements enregistrés pour des requêtes refusées", n)
+	}
+
+	w := report("bob@example.com", url.Values{"post_id": {strconv.Itoa(postID)}, "comment_id": {strconv.Itoa(commentID)}, "reason": {"Propos injurieux"}})
+	assertRedirect(t, w, postURL(postID))
+	// Le signalement d'un membre shadowbanné est gardé sans alerter les modérateurs
+	assertRedirect(t, report("ombre@example.com", url.Values{"post_id": {strconv.Itoa(postID)}, "reason": {"Spam"}}), postURL(postID))
+	if n := countRows(t, testDB, "SELECT COUNT(*) FROM reports"); n != 2 {
+		t.Errorf("%d signalements enregistrés, attendu 2", n)
+	}
+
+	deliveries, err := store.Webhooks.Deliveries(ctx, hookID, webhookLogSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Event != eventReportFiled {
+		t.Fatalf("livraisons %+v, attendu un seul report.filed", deliveries)
+	}
+	var payload struct {
+		Event string      `json:"event"`
+		Data  reportEvent `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(deliveries[0].Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	got := payload.Data
+	if got.PostID != postID || got.CommentID != commentID || got.Reporter != "bob" || got.Reason != "Propos injurieux" || got.ID == 0 {
+		t.Errorf("charge utile %+v", got)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	data "forum/Data"
+)
+
+// sessionUser retourne l'utilisateur connecté, avec son rôle et ses sanctions. Une requête
+// à l'API authentifiée par jeton a pour utilisateur le titulaire du jeton.
+func sessionUser(r *http.Request) (*User, bool) {
+	if auth := requestToken(r); auth != nil {
+		return auth.user, true
+	}
+	sessionCookie, err := r.Cookie("session_id")
+	if err != nil {
+		return nil, false
+	}
+	email, ok := sessionEmail(sessionCookie.Value)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := store.Users.ByEmail(r.Context(), email)
+	if err != nil {
+		if !errors.Is(err, data.ErrNotFound) {
+			log.Println("Erreur lors de la récupération de l'utilisateur connecté:", err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// viewerID retourne l'ID de l'utilisateur connecté, ou 0 pour un visiteur anonyme
+func viewerID(r *http.Request) int {
+	if user, ok := sessionUser(r); ok {
+		return user.ID
+	}
+	return 0
+}
+
+// enforceSanctions applique les sanctions à toutes les routes : un compte banni est
+// déconnecté, un compte suspendu ne peut plus rien soumettre hormis sa déconnexion.
+// L'API reçoit les mêmes refus en JSON.
+func enforceSanctions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := sessionUser(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user.Banned {
+			endSessions(user.Email)
+			if isAPIRequest(r) {
+				apiError(w, http.StatusForbidden, "account_banned", "Votre compte a été banni")
+				return
+			}
+			setErrorCookie(w, "Votre compte a été banni")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if user.IsSuspended() && !readOnly && r.URL.Path != "/logout" {
+			message := fmt.Sprintf("Votre compte est suspendu jusqu'au %s", user.SuspendedUntil.Time.Format("02/01/2006 15:04"))
+			if isAPIRequest(r) {
+				apiError(w, http.StatusForbidden, "account_suspended", message)
+				return
+			}
+			setErrorCookie(w, message)
+			http.Error(w, message, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type ModerationPageData struct {
+	Moderator  *User
+	Sanctioned []User
+}
+
+type moderationHandler struct{}
+
+func (h *moderationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if !moderator.IsModerator() {
+		http.Error(w, "Accès réservé aux modérateurs", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		sanctioned, err := store.Users.Sanctioned(r.Context(), time.Now())
+		if err != nil {
+			http.Error(w, "Erreur lors de la récupération des sanctions", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération des sanctions:", err)
+			return
+		}
+
+		renderTemplate(w, r, "moderation.html", ModerationPageData{Moderator: moderator, Sanctioned: sanctioned})
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
+			return
+		}
+		username := r.FormValue("username")
+		target, err := store.Users.ByUsername(r.Context(), username)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				http.Error(w, "Utilisateur non trouvé", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Erreur lors de la récupération de l'utilisateur", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération de l'utilisateur:", err)
+			return
+		}
+		if target.IsModerator() && moderator.Role != data.RoleAdmin {
+			http.Error(w, "Seul un administrateur peut sanctionner un modérateur", http.StatusForbidden)
+			return
+		}
+
+		ctx := r.Context()
+		switch r.FormValue("action") {
+		case "suspend":
+			days, convErr := strconv.Atoi(r.FormValue("days"))
+			if convErr != nil || days <= 0 {
+				http.Error(w, "Durée de suspension invalide", http.StatusBadRequest)
+				return
+			}
+			err = store.Users.Suspend(ctx, target.ID, time.Now().AddDate(0, 0, days))
+		case "unsuspend":
+			err = store.Users.Unsuspend(ctx, target.ID)
+		case "ban":
+			err = store.Users.SetBanned(ctx, target.ID, true)
+		case "unban":
+			err = store.Users.SetBanned(ctx, target.ID, false)
+		case "shadowban":
+			err = store.Users.SetShadowbanned(ctx, target.ID, true)
+		case "unshadowban":
+			err = store.Users.SetShadowbanned(ctx, target.ID, false)
+		default:
+			http.Error(w, "Action de modération inconnue", http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "Erreur lors de l'application de la sanction", http.StatusInternalServerError)
+			log.Println("Erreur lors de l'application de la sanction:", err)
+			return
+		}
+		if r.FormValue("action") == "ban" {
+			endSessions(target.Email)
+		}
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// setRole donne le rôle à l'utilisateur
+func setRole(t *testing.T, userID int, role string) {
+	t.Helper()
+	if _, err := testDB.Exec("UPDATE utilisateurs SET role = ? WHERE id = ?", role, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnforceSanctions(t *testing.T) {
+	openTestDatabase(t)
+	bannedID := createUser(t, "banni")
+	suspendedID := createUser(t, "suspendu")
+	createUser(t, "alice")
+	if _, err := testDB.Exec("UPDATE utilisateurs SET banned = 1 WHERE id = ?", bannedID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("UPDATE utilisateurs SET suspended_until = ? WHERE id = ?", time.Now().Add(time.Hour), suspendedID); err != nil {
+		t.Fatal(err)
+	}
+
+	var reached bool
+	handler := enforceSanctions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		email   string
+		reached bool
+		status  int
+	}{
+		{"visiteur", http.MethodPost, "/newpost", "", true, http.StatusOK},
+		{"compte sans sanction", http.MethodPost, "/newpost", "alice@example.com", true, http.StatusOK},
+		{"compte suspendu en lecture", http.MethodGet, "/", "suspendu@example.com", true, http.StatusOK},
+		{"compte suspendu qui publie", http.MethodPost, "/newpost", "suspendu@example.com", false, http.StatusForbidden},
+		{"compte suspendu qui commente", http.MethodPost, "/details/1", "suspendu@example.com", false, http.StatusForbidden},
+		{"compte suspendu qui se déconnecte", http.MethodPost, "/logout", "suspendu@example.com", true, http.StatusOK},
+		{"compte banni", http.MethodGet, "/", "banni@example.com", false, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.email != "" {
+				r = withSession(t, r, tt.email)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if reached != tt.reached || w.Code != tt.status {
+				t.Errorf("handler atteint : %v, statut %d ; attendu %v, %d", reached, w.Code, tt.reached, tt.status)
+			}
+		})
+	}
+
+	// Le compte banni est déconnecté
+	if _, ok := sessionEmail("session-banni@example.com"); ok {
+		t.Error("la session du compte banni est restée ouverte")
+	}
+}
+
+func TestShadowbanHidesContent(t *testing.T) {
+	useTemplates(t)
+	openTestDatabase(t)
+	authorID := createUser(t, "fantome")
+	createUser(t, "alice")
+	if _, err := testDB.Exec("UPDATE utilisateurs SET shadowbanned = 1 WHERE id = ?", authorID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("INSERT INTO posts (title, content, user_id) VALUES (?, ?, ?)", "Sujet invisible", "Contenu", authorID); err != nil {
+		t.Fatal(err)
+	}
+
+	for email, visible := range map[string]bool{"": false, "alice@example.com": false, "fantome@example.com": true} {
+		r := httptest.NewRequest(http.MethodGet, "/posts", nil)
+		if email != "" {
+			r = withSession(t, r, email)
+		}
+		w := httptest.NewRecorder()
+		(&postsHandler{}).ServeHTTP(w, r)
+		if got := strings.Contains(w.Body.String(), "Sujet invisible"); got != visible {
+			t.Errorf("lecteur %q : sujet visible %v, attendu %v", email, got, visible)
+		}
+	}
+}
+
+func TestModerationHandler(t *testing.T) {
+	openTestDatabase(t)
+	moderatorID := createUser(t, "modo")
+	otherModeratorID := createUser(t, "modo2")
+	createUser(t, "alice")
+	setRole(t, moderatorID, data.RoleModerator)
+	setRole(t, otherModeratorID, data.RoleModerator)
+
+	sanction := func(email, username, action string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {username}, "action": {action}, "days": {"3"}}
+		w := httptest.NewRecorder()
+		(&moderationHandler{}).ServeHTTP(w, withSession(t, postForm("/moderation", form), email))
+		return w
+	}
+
+	if w := sanction("alice@example.com", "modo", "ban"); w.Code != http.StatusForbidden {
+		t.Errorf("sanction par un simple membre : statut %d, attendu 403", w.Code)
+	}
+	if w := sanction("modo@example.com", "modo2", "ban"); w.Code != http.StatusForbidden {
+		t.Errorf("sanction d'un modérateur par un modérateur : statut %d, attendu 403", w.Code)
+	}
+	if w := sanction("modo@example.com", "personne", "ban"); w.Code != http.StatusNotFound {
+		t.Errorf("sanction d'un compte inconnu : statut %d, attendu 404", w.Code)
+	}
+	if w := sanction("modo@example.com", "alice", "fouetter"); w.Code != http.StatusBadRequest {
+		t.Errorf("action inconnue : statut %d, attendu 400", w.Code)
+	}
+
+	newSession("session-alice", "alice@example.com")
+	defer endSession("session-alice")
+	assertRedirect(t, sanction("modo@example.com", "alice", "suspend"), "/moderation")
+	assertRedirect(t, sanction("modo@example.com", "alice", "ban"), "/moderation")
+
+	var banned bool
+	var suspendedUntil time.Time
+	if err := testDB.QueryRow("SELECT banned, suspended_until FROM utilisateurs WHERE username = 'alice'").Scan(&banned, &suspendedUntil); err != nil {
+		t.Fatal(err)
+	}
+	if !banned {
+		t.Error("alice n'est pas bannie")
+	}
+	if wait := time.Until(suspendedUntil); wait < 71*time.Hour || wait > 73*time.Hour {
+		t.Errorf("suspendue pour %s, attendu 3 jours", wait)
+	}
+	if _, ok := sessionEmail("session-alice"); ok {
+		t.Error("la session d'alice est restée ouverte après le bannissement")
+	}
+}
@@ -1,48 +1,33 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
-	"text/template"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	data "forum/Data"
+	"forum/config"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-type User struct {
-	ID       int
-	Email    string
-	Username string
-	Password string
-	Profile  string
-	DB       *sql.DB
-}
-
-type Comment struct {
-	ID       int
-	PostID   int
-	UserID   int
-	Username string
-	Content  string
-}
-
-type Post struct {
-	ID       int
-	Title    string
-	Content  string
-	Video    string
-	Image    []string
-	UserID   int
-	Username string
-	Comments []Comment
-}
+// Les modèles sont définis par Data ; ces alias évitent de préfixer chaque gabarit et gestionnaire
+type (
+	User    = data.User
+	Comment = data.Comment
+	Post    = data.Post
+)
 
 type MainPageData struct {
 	IsLoggedIn     bool
@@ -50,116 +35,143 @@ type MainPageData struct {
 	Posts          []Post
 }
 
+type PostsPageData struct {
+	Query string
+	Posts []Post
+}
+
+type PostDetailData struct {
+	Post
+	CanModerate bool
+}
+
+// Chemin public des images et vidéos envoyées avec les posts, enregistré en base
+const uploadURLPrefix = "img_video"
+
+// Nombre maximal de sujets affichés pour une recherche
+const maxSearchResults = 50
+
 var (
-	db       *sql.DB
-	sessions = map[string]string{} // map to store session IDs and corresponding usernames
+	store *data.Store
+	cfg   *config.Config
 )
 
-func main() {
-	var err error
-	db, err = data.InitDB()
+// serve démarre le serveur HTTP avec la configuration donnée
+func serve(c *config.Config) {
+	cfg = c
+	db, err := openDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store = data.NewStore(db)
+	if mailer, err = newMailer(cfg); err != nil {
+		log.Fatal(err)
+	}
+	linkSecret = newLinkSecret(cfg)
+	if err := os.MkdirAll(cfg.UploadDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	assets := loadAssets(cfg.ThemeDir, cfg.Dev)
+	templates, err = loadTemplates(subAssets(assets, "src"), cfg.Dev)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	http.Handle("/", &mainPageHandler{})
-	http.Handle("/register", &registerHandler{})
-	http.Handle("/login", &loginHandler{})
-	http.Handle("/newpost", &newPostHandler{})
+	http.Handle("/register", limitRequests(routeLimits["/register"], &registerHandler{}))
+	http.Handle("/login", limitRequests(routeLimits["/login"], &loginHandler{}))
+	http.Handle("/newpost", limitRequests(routeLimits["/newpost"], &newPostHandler{}))
 	http.Handle("/posts", &postsHandler{})
-	http.Handle("/details/", &postDetailHandler{})
+	http.Handle("/details/", limitRequests(routeLimits["/details/"], &postDetailHandler{}))
 	http.Handle("/erreur", &errorHandler{})
 	http.Handle("/logout", &logoutHandler{})
 	http.Handle("/profil", &profilHandler{})
+	http.Handle("/profil/tokens", &tokensHandler{})
+	http.Handle("/profil/settings", limitRequests(routeLimits["/profil/settings"], &settingsHandler{}))
 	http.Handle("/profilOther", &profilOtherHandler{})
+	http.Handle(verifyPath, &verifyEmailHandler{})
+	http.Handle("/password/forgot", limitRequests(routeLimits["/password/forgot"], &forgotPasswordHandler{}))
+	http.Handle(passwordResetPath, limitRequests(routeLimits[passwordResetPath], &resetPasswordHandler{}))
+	http.Handle(verifyPath+"/resend", limitRequests(routeLimits[verifyPath+"/resend"], &resendVerificationHandler{}))
+	http.Handle("/preview", &previewHandler{})
+	http.Handle("/moderation", &moderationHandler{})
+	http.Handle("/moderation/thread", &threadModerationHandler{})
+	http.Handle("/signaler", limitRequests(routeLimits["/signaler"], &reportHandler{}))
+	http.Handle("/admin/webhooks", &webhooksHandler{})
+	http.Handle("/feed.atom", &feedHandler{})
+	http.Handle("/feed.rss", &feedHandler{})
+	http.Handle(feedPrefix, &feedHandler{})
+
+	http.Handle("/api/", &apiNotFoundHandler{})
+	http.Handle("/api/openapi.json", &apiSpecHandler{})
+	http.Handle(apiPrefix+"posts", limitRequests(routeLimits["/newpost"], &apiPostsHandler{}))
+	http.Handle(apiPrefix+"posts/", limitRequests(routeLimits["/details/"], &apiPostHandler{}))
+	http.Handle(apiPrefix+"comments/", &apiCommentHandler{})
+	http.Handle(apiPrefix+"users/", &apiUserHandler{})
+	http.Handle(apiPrefix+"me", &apiMeHandler{})
+
+	if cfg.Federation {
+		http.Handle("/.well-known/webfinger", &webfingerHandler{})
+		http.Handle(apUsersPrefix, limitRequests(routeLimits[apSharedInbox], &apUserHandler{}))
+		http.Handle(apSharedInbox, limitRequests(routeLimits[apSharedInbox], &apSharedInboxHandler{}))
+		http.Handle(apPostsPrefix, &apObjectHandler{})
+		http.Handle(apCommentsPrefix, &apObjectHandler{})
+	}
 
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))))
-	http.Handle("/src/", http.StripPrefix("/src/", http.FileServer(http.Dir("src/"))))
-	http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("images/"))))
-	http.Handle("/img_video/", http.StripPrefix("/img_video/", http.FileServer(http.Dir("img_video/"))))
-
-	fmt.Println("Serveur écoutant sur le port 6969...")
-	log.Fatal(http.ListenAndServe("localhost:6969", nil))
-}
+	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(subAssets(assets, "static")))))
+	http.Handle("/src/", http.StripPrefix("/src/", http.FileServer(http.FS(subAssets(assets, "src")))))
+	http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.FS(subAssets(assets, "images")))))
+	http.Handle("/"+uploadURLPrefix+"/", http.StripPrefix("/"+uploadURLPrefix+"/", http.FileServer(http.Dir(cfg.UploadDir))))
 
-func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
-	t, err := template.ParseFiles(tmpl)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	go archiveInactiveThreads(cfg.ArchiveAfterDays)
+	go pruneLoginFailures(10 * time.Minute)
+	go deliverWebhooks()
+	if cfg.Federation {
+		go deliverActivities()
 	}
-
-	if err := t.Execute(w, data); err != nil {
-		log.Println(err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	if cfg.BackupIntervalHours > 0 {
+		if cfg.DatabaseDriver == data.SQLite {
+			go scheduleBackups(db, cfg)
+		} else {
+			log.Println("Sauvegardes programmées ignorées :", data.ErrSQLiteOnly)
+		}
 	}
+
+	fmt.Printf("Serveur écoutant sur %s...\n", cfg.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Addr, securityHeaders(limitBody(cfg.MaxUploadBytes(), authenticateToken(enforceSanctions(verifyCSRF(http.DefaultServeMux)))))))
+}
+
+// limitBody refuse les corps de requête dépassant max octets, avant toute lecture du formulaire
+func limitBody(max int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
 }
 
 type mainPageHandler struct{}
 
 func (h *mainPageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		var data MainPageData
-		sessionCookie, err := r.Cookie("session_id")
-		if err == nil {
-			email, ok := sessions[sessionCookie.Value]
-			if ok {
-				data.IsLoggedIn = true
-				// Retrieve the profile picture of the user
-				var profilePicture string
-				err := db.QueryRow("SELECT profile_picture FROM utilisateurs WHERE email = ?", email).Scan(&profilePicture)
-				if err == nil {
-					data.ProfilePicture = profilePicture
-				}
-			}
+		var page MainPageData
+		viewer, loggedIn := sessionUser(r)
+		if loggedIn {
+			page.IsLoggedIn = true
+			page.ProfilePicture = viewer.ProfilePicture
+		} else {
+			viewer = &User{}
 		}
 
-		// Retrieve posts with limit 7 and order by creation date
-		rows, err := db.Query("SELECT p.id, p.title, p.content, p.video, u.username FROM posts p JOIN utilisateurs u ON p.user_id = u.id ORDER BY p.created_at DESC LIMIT 7")
+		// Retrieve the 7 latest posts, pinned first
+		posts, err := store.Posts.List(r.Context(), viewer.ID, 7)
 		if err != nil {
 			http.Error(w, "Erreur lors de la récupération des posts", http.StatusInternalServerError)
 			log.Println("Erreur lors de la récupération des posts:", err)
 			return
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var post Post
-			var videoPtr sql.NullString
-			err := rows.Scan(&post.ID, &post.Title, &post.Content, &videoPtr, &post.Username)
-			if err != nil {
-				http.Error(w, "Erreur lors de la lecture des posts", http.StatusInternalServerError)
-				log.Println("Erreur lors de la lecture des posts:", err)
-				return
-			}
-			if videoPtr.Valid {
-				post.Video = videoPtr.String
-			}
-
-			// Retrieve associated images
-			imageRows, err := db.Query("SELECT image FROM posts WHERE post_id = ?", post.ID)
-			if err != nil {
-				http.Error(w, "Erreur lors de la récupération des images", http.StatusInternalServerError)
-				log.Println("Erreur lors de la récupération des images:", err)
-				return
-			}
-			defer imageRows.Close()
-
-			for imageRows.Next() {
-				var imagePath string
-				if err := imageRows.Scan(&imagePath); err != nil {
-					http.Error(w, "Erreur lors de la lecture des images", http.StatusInternalServerError)
-					log.Println("Erreur lors de la lecture des images:", err)
-					return
-				}
-				post.Image = append(post.Image, imagePath)
-			}
-
-			data.Posts = append(data.Posts, post)
-		}
+		page.Posts = posts
 
-		renderTemplate(w, "./src/Main_page.html", data)
+		renderTemplate(w, r, "Main_page.html", page)
 		return
 	}
 	if r.Method == http.MethodPost {
@@ -173,7 +185,7 @@ type registerHandler struct{}
 
 func (h *registerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		renderTemplate(w, "./src/register.html", nil)
+		renderTemplate(w, r, "register.html", nil)
 		return
 	}
 	if r.Method == http.MethodPost {
@@ -183,37 +195,52 @@ func (h *registerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		email := r.FormValue("email")
-		username := r.FormValue("username")
+		username := strings.TrimSpace(r.FormValue("username"))
 		password := r.FormValue("password")
 		if email == "" || username == "" || password == "" {
 			setCookie(w, "error", "Email, nom d'utilisateur ou mot de passe vide")
 			http.Redirect(w, r, "/register", http.StatusSeeOther)
 			return
 		}
-		emailPattern := `^[^\s@]+@[^\s@]+\.[^\s@]+$`
-		matched, err := regexp.MatchString(emailPattern, email)
-		if err != nil || !matched {
+		if !validUsername(username) {
+			setCookie(w, "error", usernameRules)
+			http.Redirect(w, r, "/register", http.StatusSeeOther)
+			return
+		}
+		if !validEmail(email) {
 			setCookie(w, "error", "Email invalide")
 			http.Redirect(w, r, "/register", http.StatusSeeOther)
 			return
 		}
-		if usernameExists(username) {
+		if _, ok := validPassword(password); !ok {
+			setCookie(w, "error", "Le mot de passe doit contenir entre "+strconv.Itoa(minPasswordLength)+" et "+strconv.Itoa(maxPasswordLength)+" caracteres")
+			http.Redirect(w, r, "/register", http.StatusSeeOther)
+			return
+		}
+		if usernameExists(r.Context(), username) {
 			setCookie(w, "error", "Nom d'utilisateur deja pris, veuillez en choisir un autre")
 			http.Redirect(w, r, "/register", http.StatusSeeOther)
 			return
 		}
-		if emailExists(email) {
+		if emailExists(r.Context(), email) {
 			setCookie(w, "error", "Email deja existente, veuillez en choisir un autre")
 			http.Redirect(w, r, "/register", http.StatusSeeOther)
 			return
 		}
-		_, err = db.Exec("INSERT INTO utilisateurs (email, username, password) VALUES (?, ?, ?)", email, username, password)
+		id, err := store.Users.Create(r.Context(), &User{Email: email, Username: username, Password: password})
 		if err != nil {
 			setCookie(w, "error", "Erreur lors de l'inscription")
 			log.Println("Erreur lors de l'insertion dans la base de données:", err)
 			http.Redirect(w, r, "/register", http.StatusSeeOther)
 			return
 		}
+		emitUserRegistered(r.Context(), id)
+		if err := sendVerificationEmail(r, &User{ID: id, Email: email, Username: username}); err != nil {
+			log.Println("Erreur lors de l'envoi de l'email de confirmation:", err)
+			setCookie(w, "error", "Inscription reussie, mais l'email de confirmation n'a pas pu etre envoye : redemandez-le depuis votre profil")
+		} else {
+			setCookie(w, "error", "Inscription reussie : confirmez votre adresse avec le lien envoye par email pour pouvoir publier")
+		}
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
@@ -222,18 +249,39 @@ func (h *registerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func setCookie(w http.ResponseWriter, name, value string) {
 	cookie := &http.Cookie{
-		Name:   name,
-		Value:  value,
-		Path:   "/",
-		MaxAge: 10, // The cookie will be valid for 10 seconds
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   10, // The cookie will be valid for 10 seconds
+		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, cookie)
 }
 
-func usernameExists(username string) bool {
-	var exists bool
-	query := "SELECT EXISTS (SELECT 1 FROM utilisateurs WHERE username = ?)"
-	err := db.QueryRow(query, username).Scan(&exists)
+// Longueur maximale d'un nom d'utilisateur local, en caractères
+const maxUsernameLength = 30
+
+// Message d'erreur rappelant les règles de validUsername
+var usernameRules = "Le nom d'utilisateur doit faire entre 1 et " + strconv.Itoa(maxUsernameLength) + " caracteres, sans @"
+
+// validUsername vérifie le nom choisi par un membre. « @ » est réservé aux comptes qui
+// représentent un acteur ActivityPub distant, nommés nom@hôte : un compte local ne doit
+// pas pouvoir s'y faire passer pour l'un d'eux.
+func validUsername(username string) bool {
+	n := utf8.RuneCountInString(username)
+	if n == 0 || n > maxUsernameLength || strings.TrimSpace(username) != username {
+		return false
+	}
+	for _, c := range username {
+		if c == '@' || unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func usernameExists(ctx context.Context, username string) bool {
+	exists, err := store.Users.UsernameExists(ctx, username)
 	if err != nil {
 		log.Println("Erreur lors de la vérification du nom d'utilisateur :", err)
 		return true
@@ -241,12 +289,10 @@ func usernameExists(username string) bool {
 	return exists
 }
 
-func emailExists(email string) bool {
-	var exists bool
-	query := "SELECT EXISTS (SELECT 1 FROM utilisateurs WHERE email = ?)"
-	err := db.QueryRow(query, email).Scan(&exists)
+func emailExists(ctx context.Context, email string) bool {
+	exists, err := store.Users.EmailExists(ctx, email)
 	if err != nil {
-		log.Println("Erreur lors de la vérification du nom d'utilisateur :", err)
+		log.Println("Erreur lors de la vérification de l'email :", err)
 		return true
 	}
 	return exists
@@ -256,7 +302,7 @@ type loginHandler struct{}
 
 func (h *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		renderTemplate(w, "./src/login.html", nil)
+		renderTemplate(w, r, "login.html", nil)
 		return
 	}
 	if r.Method == http.MethodPost {
@@ -271,10 +317,14 @@ func (h *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
-		var dbPassword string
-		err := db.QueryRow("SELECT password FROM utilisateurs WHERE email = ?", email).Scan(&dbPassword)
+		if wait := loginLockedFor(email); wait > 0 {
+			tooManyRequests(w, r, wait)
+			return
+		}
+		user, err := store.Users.ByEmail(r.Context(), email)
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if errors.Is(err, data.ErrNotFound) {
+				recordLoginFailure(email)
 				setErrorCookie(w, "Email ou mot de passe incorrect")
 				http.Redirect(w, r, "/login", http.StatusSeeOther)
 				return
@@ -284,18 +334,35 @@ func (h *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			log.Println("Erreur lors de la vérification de l'utilisateur:", err)
 			return
 		}
-		if password != dbPassword {
-			setErrorCookie(w, "Mot de passe incorrect")
+		// Le mot de passe est vérifié avant tout autre état du compte, avec le même message
+		// qu'un email inconnu : un échec ne révèle pas si le compte existe ou a été importé.
+		// Les comptes importés n'ont pas de mot de passe et ne correspondent donc jamais.
+		if user.Password == "" || !samePassword(password, user.Password) {
+			recordLoginFailure(email)
+			setErrorCookie(w, "Email ou mot de passe incorrect")
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
+		if user.MustResetPassword {
+			setErrorCookie(w, "Ce compte a ete importe d'un autre forum : choisissez un mot de passe avec 'Mot de passe oublie ?'")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if user.Banned {
+			setErrorCookie(w, "Votre compte a été banni")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		resetLoginFailures(email)
 		// Créer une session
 		sessionID := uuid.New().String()
-		sessions[sessionID] = email
+		newSession(sessionID, email)
 		cookie := &http.Cookie{
-			Name:  "session_id",
-			Value: sessionID,
-			Path:  "/",
+			Name:     "session_id",
+			Value:    sessionID,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
 		}
 		http.SetCookie(w, cookie)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -311,7 +378,7 @@ func (h *logoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		sessionCookie, err := r.Cookie("session_id")
 		if err == nil {
 			// Supprime la session du serveur
-			delete(sessions, sessionCookie.Value)
+			endSession(sessionCookie.Value)
 
 			// Expire le cookie côté client
 			sessionCookie.MaxAge = -1
@@ -325,9 +392,10 @@ func (h *logoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func setErrorCookie(w http.ResponseWriter, errorMsg string) {
 	cookie := &http.Cookie{
-		Name:  "error",
-		Value: errorMsg,
-		Path:  "/",
+		Name:     "error",
+		Value:    errorMsg,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, cookie)
 }
@@ -336,31 +404,22 @@ type newPostHandler struct{}
 
 func (h *newPostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		renderTemplate(w, "./src/new_post.html", nil)
+		renderTemplate(w, r, "new_post.html", nil)
 		return
 	}
 	if r.Method == http.MethodPost {
 		// Check if user is logged in
-		sessionCookie, err := r.Cookie("session_id")
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		email, ok := sessions[sessionCookie.Value]
+		user, ok := sessionUser(r)
 		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
-		var userID int
-		err = db.QueryRow("SELECT id FROM utilisateurs WHERE email = ?", email).Scan(&userID)
-		if err != nil {
-			http.Error(w, "Erreur lors de la vérification de l'utilisateur", http.StatusInternalServerError)
-			log.Println("Erreur lors de la vérification de l'utilisateur:", err)
+		if !requireVerified(w, r, user) {
 			return
 		}
 
 		// Handle form submission
-		if err := r.ParseMultipartForm(20 << 20); err != nil {
+		if err := r.ParseMultipartForm(cfg.MaxUploadBytes()); err != nil {
 			http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
 			return
 		}
@@ -385,8 +444,8 @@ func (h *newPostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			switch fileExt {
 			case ".mp4", ".avi", ".mov":
 				// Handle video file
-				videoPath = filepath.Join("./img_video", fileHeader.Filename)
-				out, err := os.Create(videoPath)
+				videoPath = path.Join(uploadURLPrefix, fileHeader.Filename)
+				out, err := os.Create(filepath.Join(cfg.UploadDir, fileHeader.Filename))
 				if err != nil {
 					http.Error(w, "Erreur lors de la sauvegarde de la vidéo", http.StatusInternalServerError)
 					return
@@ -404,9 +463,9 @@ func (h *newPostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 			case ".jpg", ".jpeg", ".png", ".gif":
 				// Handle image file
-				imagePath := filepath.Join("./img_video", fileHeader.Filename)
+				imagePath := path.Join(uploadURLPrefix, fileHeader.Filename)
 				imagePaths = append(imagePaths, imagePath)
-				out, err := os.Create(imagePath)
+				out, err := os.Create(filepath.Join(cfg.UploadDir, fileHeader.Filename))
 				if err != nil {
 					http.Error(w, "Erreur lors de la sauvegarde de l'image", http.StatusInternalServerError)
 					return
@@ -429,28 +488,28 @@ func (h *newPostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Insert the post into the database
-		result, err := db.Exec("INSERT INTO posts (title, content, video, user_id) VALUES (?, ?, ?, ?)", title, content, videoPath, userID)
+		post := &Post{Title: title, Content: content, Video: videoPath, UserID: user.ID}
+		id, err := store.Posts.Create(r.Context(), post)
 		if err != nil {
 			http.Error(w, "Erreur lors de la création du post", http.StatusInternalServerError)
 			log.Println("Erreur lors de l'insertion dans la base de données:", err)
 			return
 		}
-
-		// Get the ID of the inserted post
-		postID, _ := result.LastInsertId()
+		post.ID = id
 
 		// Insert images into the database
 		for _, imagePath := range imagePaths {
-			_, err := db.Exec("INSERT INTO posts (title, content, image, post_id) VALUES (?, ?, ?, ?)", title, content, imagePath, postID)
-			if err != nil {
+			if err := store.Attachments.Add(r.Context(), post, imagePath); err != nil {
 				http.Error(w, "Erreur lors de la création du post", http.StatusInternalServerError)
 				log.Println("Erreur lors de l'insertion de l'image dans la base de données:", err)
 				return
 			}
 		}
+		emitPostCreated(r.Context(), user, post.ID)
+		federatePost(r.Context(), user, post.ID)
 
 		// Redirect to the main page with the ID of the new post
-		http.Redirect(w, r, fmt.Sprintf("/?postID=%d", postID), http.StatusSeeOther)
+		http.Redirect(w, r, fmt.Sprintf("/?postID=%d", post.ID), http.StatusSeeOther)
 		return
 	}
 	http.NotFound(w, r)
@@ -460,52 +519,20 @@ type postsHandler struct{}
 
 func (h *postsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		var posts []Post
-
-		rows, err := db.Query("SELECT p.id, p.title, p.content, p.video, u.username FROM posts p JOIN utilisateurs u ON p.user_id = u.id")
+		page := PostsPageData{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+		var err error
+		if page.Query != "" {
+			page.Posts, err = store.Posts.Search(r.Context(), page.Query, viewerID(r), maxSearchResults)
+		} else {
+			page.Posts, err = store.Posts.List(r.Context(), viewerID(r), 0)
+		}
 		if err != nil {
 			http.Error(w, "Erreur lors de la récupération des posts", http.StatusInternalServerError)
 			log.Println("Erreur lors de la récupération des posts:", err)
 			return
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var post Post
-			var videoPtr sql.NullString
-			err := rows.Scan(&post.ID, &post.Title, &post.Content, &videoPtr, &post.Username)
-			if err != nil {
-				http.Error(w, "Erreur lors de la lecture des posts", http.StatusInternalServerError)
-				log.Println("Erreur lors de la lecture des posts:", err)
-				return
-			}
-			if videoPtr.Valid {
-				post.Video = videoPtr.String
-			}
-
-			// Retrieve associated images
-			imageRows, err := db.Query("SELECT image FROM posts WHERE post_id = ?", post.ID)
-			if err != nil {
-				http.Error(w, "Erreur lors de la récupération des images", http.StatusInternalServerError)
-				log.Println("Erreur lors de la récupération des images:", err)
-				return
-			}
-			defer imageRows.Close()
-
-			for imageRows.Next() {
-				var imagePath string
-				if err := imageRows.Scan(&imagePath); err != nil {
-					http.Error(w, "Erreur lors de la lecture des images", http.StatusInternalServerError)
-					log.Println("Erreur lors de la lecture des images:", err)
-					return
-				}
-				post.Image = append(post.Image, imagePath)
-			}
-
-			posts = append(posts, post)
-		}
-
-		renderTemplate(w, "./src/posts.html", posts)
+		renderTemplate(w, r, "posts.html", page)
 		return
 	}
 	http.NotFound(w, r)
@@ -515,50 +542,67 @@ type postDetailHandler struct{}
 
 func (h *postDetailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Extract postID from URL path
-	postID := r.URL.Path[len("/details/"):]
-	if postID == "" {
+	idParam := r.URL.Path[len("/details/"):]
+	if idParam == "" {
 		http.Error(w, "ID du post manquant dans l'URL", http.StatusBadRequest)
 		return
 	}
+	postID, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Post non trouvé", http.StatusNotFound)
+		return
+	}
 
 	if r.Method == http.MethodPost {
 		// Handle new comment submission
-		sessionCookie, err := r.Cookie("session_id")
-		if err != nil {
+		user, ok := sessionUser(r)
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
-		email, ok := sessions[sessionCookie.Value]
-		if !ok {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		if !requireVerified(w, r, user) {
 			return
 		}
-		var userID int
-		err = db.QueryRow("SELECT id FROM utilisateurs WHERE email = ?", email).Scan(&userID)
+		locked, archived, err := store.Posts.State(r.Context(), postID)
 		if err != nil {
-			http.Error(w, "Erreur lors de la vérification de l'utilisateur", http.StatusInternalServerError)
-			log.Println("Erreur lors de la vérification de l'utilisateur:", err)
+			if errors.Is(err, data.ErrNotFound) {
+				http.Error(w, "Post non trouvé", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Erreur lors de la récupération du post", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération du post:", err)
+			return
+		}
+		if locked || archived {
+			http.Error(w, "Ce sujet est fermé aux nouveaux commentaires", http.StatusForbidden)
 			return
 		}
-		commentContent := r.FormValue("comment")
-		_, err = db.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, commentContent)
+		comment := &Comment{PostID: postID, UserID: user.ID, Username: user.Username, Content: r.FormValue("comment")}
+		comment.ID, err = store.Comments.Create(r.Context(), comment)
 		if err != nil {
 			http.Error(w, "Erreur lors de l'ajout du commentaire", http.StatusInternalServerError)
 			log.Println("Erreur lors de l'ajout du commentaire:", err)
 			return
 		}
+		if err := store.Posts.Touch(r.Context(), postID); err != nil {
+			log.Println("Erreur lors de la mise à jour de l'activité du post:", err)
+		}
+		emitCommentCreated(r.Context(), user, comment)
+		federateComment(r.Context(), user, comment)
 
 		// Redirect to the same post detail page after successfully adding a comment
-		http.Redirect(w, r, fmt.Sprintf("/details/%s", postID), http.StatusSeeOther)
+		http.Redirect(w, r, postURL(postID), http.StatusSeeOther)
 		return
 	}
 
 	// Fetch post details and comments for GET request
-	var post Post
-	var videoPtr sql.NullString
-	err := db.QueryRow("SELECT p.id, p.title, p.content, p.video, p.user_id, u.username FROM posts p JOIN utilisateurs u ON p.user_id = u.id WHERE p.id = ?", postID).Scan(&post.ID, &post.Title, &post.Content, &videoPtr, &post.UserID, &post.Username)
+	viewer, loggedIn := sessionUser(r)
+	if !loggedIn {
+		viewer = &User{}
+	}
+	post, err := store.Posts.Get(r.Context(), postID, viewer.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, data.ErrNotFound) {
 			http.Error(w, "Post non trouvé", http.StatusNotFound)
 			return
 		}
@@ -566,104 +610,63 @@ func (h *postDetailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Println("Erreur lors de la récupération du post:", err)
 		return
 	}
-	if videoPtr.Valid {
-		post.Video = videoPtr.String
-	}
-
-	// Fetch images associated with the post
-	imageRows, err := db.Query("SELECT image FROM posts WHERE post_id = ?", postID)
-	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des images", http.StatusInternalServerError)
-		log.Println("Erreur lors de la récupération des images:", err)
-		return
-	}
-	defer imageRows.Close()
-
-	for imageRows.Next() {
-		var imagePath string
-		if err := imageRows.Scan(&imagePath); err != nil {
-			http.Error(w, "Erreur lors de la lecture des images", http.StatusInternalServerError)
-			log.Println("Erreur lors de la lecture des images:", err)
-			return
-		}
-		post.Image = append(post.Image, imagePath)
-	}
 
 	// Fetch comments associated with the post
-	commentRows, err := db.Query("SELECT c.id, c.user_id, u.username, c.content FROM comments c JOIN utilisateurs u ON c.user_id = u.id WHERE c.post_id = ?", postID)
+	post.Comments, err = store.Comments.ForPost(r.Context(), postID, viewer.ID)
 	if err != nil {
 		http.Error(w, "Erreur lors de la récupération des commentaires", http.StatusInternalServerError)
 		log.Println("Erreur lors de la récupération des commentaires:", err)
 		return
 	}
-	defer commentRows.Close()
-
-	for commentRows.Next() {
-		var comment Comment
-		if err := commentRows.Scan(&comment.ID, &comment.UserID, &comment.Username, &comment.Content); err != nil {
-			http.Error(w, "Erreur lors de la lecture des commentaires", http.StatusInternalServerError)
-			log.Println("Erreur lors de la lecture des commentaires:", err)
-			return
-		}
-		post.Comments = append(post.Comments, comment)
-	}
 
-	renderTemplate(w, "./src/post_detail.html", post)
+	renderTemplate(w, r, "post_detail.html", PostDetailData{Post: *post, CanModerate: viewer.IsModerator()})
 }
 
-
 type errorHandler struct{}
 
 func (h *errorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "./src/erreur.html", nil)
+	renderTemplate(w, r, "erreur.html", nil)
 }
 
 type profilHandler struct{}
 
 func (h *profilHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Check if user is logged in
-	sessionCookie, err := r.Cookie("session_id")
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-	email, ok := sessions[sessionCookie.Value]
+	user, ok := sessionUser(r)
 	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	var user User
-	err = db.QueryRow("SELECT id, email, username FROM utilisateurs WHERE email = ?", email).Scan(&user.ID, &user.Email, &user.Username)
-	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des informations de l'utilisateur", http.StatusInternalServerError)
-		log.Println("Erreur lors de la récupération des informations de l'utilisateur:", err)
-		return
-	}
-
-	renderTemplate(w, "./src/profil.html", user)
+	renderProfil(w, r, user, "")
 }
 
 type profilOtherHandler struct{}
 
 func (h *profilOtherHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    username := r.URL.Query().Get("username")
-    if username == "" {
-        http.Error(w, "Nom d'utilisateur manquant", http.StatusBadRequest)
-        return
-    }
-
-    var user User
-    err := db.QueryRow("SELECT id, email, username FROM utilisateurs WHERE username = ?", username).Scan(&user.ID, &user.Email, &user.Username)
-    if err != nil {
-        if err == sql.ErrNoRows {
-            http.Error(w, "Utilisateur non trouvé", http.StatusNotFound)
-            return
-        }
-        http.Error(w, "Erreur lors de la récupération de l'utilisateur", http.StatusInternalServerError)
-        log.Println("Erreur lors de la récupération de l'utilisateur:", err)
-        return
-    }
-
-    renderTemplate(w, "./src/profilOther.html", user)
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		http.Error(w, "Nom d'utilisateur manquant", http.StatusBadRequest)
+		return
+	}
+
+	user, err := store.Users.ByUsername(r.Context(), username)
+	if errors.Is(err, data.ErrNotFound) {
+		// Le compte a peut-être changé de nom depuis que le lien a été écrit
+		var redirected bool
+		if redirected, err = formerProfile(w, r, username); redirected {
+			return
+		}
+		if err == nil {
+			http.Error(w, "Utilisateur non trouvé", http.StatusNotFound)
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de l'utilisateur", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération de l'utilisateur:", err)
+		return
+	}
+
+	renderTemplate(w, r, "profilOther.html", user)
 }
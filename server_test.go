@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	data "forum/Data"
+	"forum/config"
+)
+
+// testDB est la base ouverte par openTestDatabase, où les tests préparent leurs données
+var testDB *sql.DB
+
+// openTestDatabase ouvre une base SQLite neuve dans un répertoire temporaire du test
+// et la rend accessible aux handlers le temps du test, avec la configuration par défaut
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	useConfig(t)
+	db, err := data.InitDB(data.SQLite, filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousDB, previousStore := testDB, store
+	testDB, store = db, data.NewStore(db)
+	t.Cleanup(func() {
+		testDB, store = previousDB, previousStore
+		db.Close()
+	})
+	return db
+}
+
+// useConfig remplace la configuration par les réglages par défaut le temps du test
+func useConfig(t *testing.T) *config.Config {
+	t.Helper()
+	previous := cfg
+	cfg = config.Default()
+	cfg.UploadDir = t.TempDir()
+	t.Cleanup(func() { cfg = previous })
+	return cfg
+}
+
+// createUser insère un compte et retourne son ID
+func createUser(t *testing.T, username string) int {
+	t.Helper()
+	result, err := testDB.Exec("INSERT INTO utilisateurs (email, username, password) VALUES (?, ?, ?)", username+"@example.com", username, "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// withSession ouvre une session pour email et l'attache à la requête
+func withSession(t *testing.T, r *http.Request, email string) *http.Request {
+	t.Helper()
+	id := "session-" + email
+	newSession(id, email)
+	t.Cleanup(func() { endSession(id) })
+	r.AddCookie(&http.Cookie{Name: "session_id", Value: id})
+	return r
+}
+
+// postForm construit une requête POST de formulaire urlencodé
+func postForm(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// responseCookie retourne la valeur du cookie name posé par la réponse
+func responseCookie(w *httptest.ResponseRecorder, name string) (string, bool) {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c.Value, true
+		}
+	}
+	return "", false
+}
+
+// assertRedirect vérifie une redirection 303 vers location
+func assertRedirect(t *testing.T, w *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("statut %d, attendu 303 : %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Location"); got != location {
+		t.Fatalf("redirection vers %q, attendu %q", got, location)
+	}
+}
+
+// Phrase de passe plus longue que l'ancienne limite de 12 caractères
+const longPassword = "correct cheval agrafe batterie"
+
+func TestLoginHandler(t *testing.T) {
+	f := useFakeStore(t)
+	f.addUser(User{Email: "alice@example.com", Username: "alice", Password: "secret1"})
+	f.addUser(User{Email: "banni@example.com", Username: "banni", Password: "secret1", Banned: true})
+	f.addUser(User{Email: "importe@example.com", Username: "importe", MustResetPassword: true})
+	f.addUser(User{Email: "phrase@example.com", Username: "phrase", Password: longPassword, EmailVerified: true})
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		location string
+		message  string // fragment du cookie error, vide pour une connexion réussie
+	}{
+		{"champs vides", "alice@example.com", "", "/login", "vide"},
+		{"compte inconnu", "personne@example.com", "secret1", "/login", "incorrect"},
+		{"mauvais mot de passe", "alice@example.com", "mauvais", "/login", "incorrect"},
+		{"compte importé", "importe@example.com", "secret1", "/login", "incorrect"},
+		{"compte banni", "banni@example.com", "secret1", "/login", "banni"},
+		{"phrase de passe tronquée", "phrase@example.com", longPassword[:12], "/login", "incorrect"},
+		{"connexion", "alice@example.com", "secret1", "/", ""},
+		{"connexion par phrase de passe", "phrase@example.com", longPassword, "/", ""},
+	}
+	failures := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			(&loginHandler{}).ServeHTTP(w, postForm("/login", url.Values{"email": {tt.email}, "password": {tt.password}}))
+			assertRedirect(t, w, tt.location)
+
+			message, _ := responseCookie(w, "error")
+			sessionID, hasSession := responseCookie(w, "session_id")
+			if tt.message != "" {
+				if !strings.Contains(message, tt.message) {
+					t.Errorf("message %q, attendu %q", message, tt.message)
+				}
+				if hasSession {
+					t.Error("session ouverte malgré l'échec")
+				}
+				if tt.message == "incorrect" {
+					failures[message] = true
+				}
+				return
+			}
+			if !hasSession {
+				t.Fatal("pas de cookie de session")
+			}
+			defer endSession(sessionID)
+			if email, ok := sessionEmail(sessionID); !ok || email != tt.email {
+				t.Errorf("session de %q, attendu %q", email, tt.email)
+			}
+		})
+	}
+	// Compte inconnu, mauvais mot de passe et compte importé sont indiscernables
+	if len(failures) != 1 {
+		t.Errorf("messages d'échec distincts : %v", failures)
+	}
+}
+
+func TestRegisterHandler(t *testing.T) {
+	f := useFakeStore(t)
+	outbox := useMailer(t)
+	f.addUser(User{Email: "alice@example.com", Username: "alice", Password: "secret1"})
+
+	tests := []struct {
+		name     string
+		username string
+		location string
+	}{
+		{"nom vide", "   ", "/register"},
+		{"nom distant", "bob@mastodon.example", "/register"},
+		{"nom trop long", strings.Repeat("é", maxUsernameLength+1), "/register"},
+		{"caractère de contrôle", "bob\x00", "/register"},
+		{"nom déjà pris", "alice", "/register"},
+		{"inscription", " bob ", "/login"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"email": {"membre" + strconv.Itoa(i) + "@example.com"}, "username": {tt.username}, "password": {"secret1"}}
+			w := httptest.NewRecorder()
+			(&registerHandler{}).ServeHTTP(w, postForm("/register", form))
+			assertRedirect(t, w, tt.location)
+		})
+	}
+	if !usernameExists(context.Background(), "bob") {
+		t.Error("bob non inscrit, ou inscrit sans retirer les espaces")
+	}
+	if !strings.Contains(outbox.String(), "To: membre5@example.com") || strings.Count(outbox.String(), "Subject:") != 1 {
+		t.Errorf("email de confirmation attendu pour la seule inscription réussie :\n%s", outbox.String())
+	}
+	if usernameExists(context.Background(), "bob@mastodon.example") {
+		t.Error("nom local contenant @ accepté")
+	}
+}
+
+// multipartPost construit le formulaire de /newpost, avec un fichier joint si filename n'est pas vide
+func multipartPost(t *testing.T, title, content, filename string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", title)
+	mw.WriteField("content", content)
+	if filename != "" {
+		fw, err := mw.CreateFormFile("all", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("contenu du fichier"))
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/newpost", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestNewPostHandler(t *testing.T) {
+	f := useFakeStore(t)
+	aliceID := f.addUser(User{Email: "alice@example.com", Username: "alice", Password: "secret1", EmailVerified: true})
+	f.addUser(User{Email: "bob@example.com", Username: "bob", Password: "secret1"})
+
+	t.Run("visiteur anonyme", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		(&newPostHandler{}).ServeHTTP(w, multipartPost(t, "Titre", "Contenu", ""))
+		assertRedirect(t, w, "/login")
+	})
+
+	t.Run("adresse non confirmée", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		(&newPostHandler{}).ServeHTTP(w, withSession(t, multipartPost(t, "Titre", "Contenu", ""), "bob@example.com"))
+		assertRedirect(t, w, "/profil")
+		if len(f.posts) != 0 {
+			t.Errorf("%d sujets créés, attendu aucun", len(f.posts))
+		}
+	})
+
+	t.Run("fichier refusé", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		(&newPostHandler{}).ServeHTTP(w, withSession(t, multipartPost(t, "Titre", "Contenu", "script.exe"), "alice@example.com"))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("statut %d, attendu 400", w.Code)
+		}
+		if len(f.posts) != 0 {
+			t.Errorf("%d sujets créés, attendu aucun", len(f.posts))
+		}
+	})
+
+	t.Run("sujet avec image", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		(&newPostHandler{}).ServeHTTP(w, withSession(t, multipartPost(t, "Titre", "Contenu **gras**", "photo.png"), "alice@example.com"))
+		assertRedirect(t, w, "/?postID=1")
+
+		if len(f.posts) != 1 {
+			t.Fatalf("%d sujets créés, attendu 1", len(f.posts))
+		}
+		post := f.posts[0]
+		if post.Title != "Titre" || post.Content != "Contenu **gras**" || post.UserID != aliceID {
+			t.Errorf("sujet enregistré : %+v", post)
+		}
+		if len(post.Image) != 1 || post.Image[0] != uploadURLPrefix+"/photo.png" {
+			t.Errorf("images du sujet : %v", post.Image)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.UploadDir, "photo.png")); err != nil {
+			t.Errorf("image non enregistrée : %v", err)
+		}
+	})
+}
+
+func TestPostDetailHandlerComments(t *testing.T) {
+	useTemplates(t)
+	f := useFakeStore(t)
+	aliceID := f.addUser(User{Email: "alice@example.com", Username: "alice", Password: "secret1", EmailVerified: true})
+	f.addUser(User{Email: "bob@example.com", Username: "bob", Password: "secret1"})
+	f.addUser(User{Email: "ombre@example.com", Username: "ombre", Password: "secret1", EmailVerified: true, Shadowbanned: true})
+	open := f.addPost(Post{Title: "Ouvert", Content: "Sujet ouvert", UserID: aliceID})
+	locked := f.addPost(Post{Title: "Verrouillé", Content: "Sujet verrouillé", UserID: aliceID, Locked: true})
+	archived := f.addPost(Post{Title: "Archivé", Content: "Sujet archivé", UserID: aliceID, Archived: true})
+
+	comment := func(t *testing.T, postID, email, content string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := postForm("/details/"+postID, url.Values{"comment": {content}})
+		if email != "" {
+			r = withSession(t, r, email)
+		}
+		w := httptest.NewRecorder()
+		(&postDetailHandler{}).ServeHTTP(w, r)
+		return w
+	}
+	id := func(n int) string { return strings.TrimPrefix(postURL(n), "/details/") }
+
+	tests := []struct {
+		name   string
+		postID string
+		email  string
+		status int
+	}{
+		{"visiteur anonyme", id(open), "", http.StatusSeeOther},
+		{"adresse non confirmée", id(open), "bob@example.com", http.StatusSeeOther},
+		{"sujet verrouillé", id(locked), "alice@example.com", http.StatusForbidden},
+		{"sujet archivé", id(archived), "alice@example.com", http.StatusForbidden},
+		{"sujet inexistant", "99", "alice@example.com", http.StatusNotFound},
+		{"ID invalide", "abc", "alice@example.com", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := comment(t, tt.postID, tt.email, "refusé"); w.Code != tt.status {
+				t.Errorf("statut %d, attendu %d", w.Code, tt.status)
+			}
+			if len(f.comments) != 0 {
+				t.Errorf("%d commentaires enregistrés, attendu aucun", len(f.comments))
+			}
+		})
+	}
+
+	t.Run("commentaire publié", func(t *testing.T) {
+		w := comment(t, id(open), "alice@example.com", "Bonjour **tout le monde**")
+		assertRedirect(t, w, postURL(open))
+		if len(f.comments) != 1 || f.comments[0].Content != "Bonjour **tout le monde**" || f.comments[0].UserID != aliceID {
+			t.Fatalf("commentaires enregistrés : %+v", f.comments)
+		}
+		if f.touched[open] != 1 {
+			t.Errorf("activité du sujet mise à jour %d fois, attendu 1", f.touched[open])
+		}
+	})
+
+	t.Run("commentaire shadowbanné", func(t *testing.T) {
+		assertRedirect(t, comment(t, id(open), "ombre@example.com", "Invisible des autres"), postURL(open))
+
+		page := func(email string) string {
+			r := httptest.NewRequest(http.MethodGet, postURL(open), nil)
+			if email != "" {
+				r = withSession(t, r, email)
+			}
+			w := httptest.NewRecorder()
+			(&postDetailHandler{}).ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("statut %d : %s", w.Code, w.Body)
+			}
+			return w.Body.String()
+		}
+		anonymous := page("")
+		if !strings.Contains(anonymous, "<strong>tout le monde</strong>") {
+			t.Error("le commentaire publié n'apparaît pas rendu en Markdown")
+		}
+		if strings.Contains(anonymous, "Invisible des autres") {
+			t.Error("le commentaire shadowbanné est visible d'un visiteur")
+		}
+		if !strings.Contains(page("ombre@example.com"), "Invisible des autres") {
+			t.Error("le commentaire shadowbanné est invisible de son auteur")
+		}
+	})
+}
+
+func TestValidPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{"cinq5", false},
+		{"six666", true},
+		{longPassword, true},
+		{strings.Repeat("é", maxPasswordLength), true},
+		{strings.Repeat("a", maxPasswordLength+1), false},
+	}
+	for _, tt := range tests {
+		if _, ok := validPassword(tt.password); ok != tt.valid {
+			t.Errorf("validPassword(%q) = %v, attendu %v", tt.password, ok, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import "sync"
+
+// Les sessions ouvertes, de l'ID de session à l'email du compte. La carte est partagée
+// par toutes les requêtes : on n'y accède que par les fonctions ci-dessous.
+var (
+	sessionsMu sync.RWMutex
+	sessions   = map[string]string{}
+)
+
+// newSession ouvre une session pour cet email
+func newSession(sessionID, email string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	sessions[sessionID] = email
+}
+
+// sessionEmail retourne l'email de la session, si elle est ouverte
+func sessionEmail(sessionID string) (string, bool) {
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+
+	email, ok := sessions[sessionID]
+	return email, ok
+}
+
+// endSession ferme une session et oublie son jeton CSRF
+func endSession(sessionID string) {
+	sessionsMu.Lock()
+	delete(sessions, sessionID)
+	sessionsMu.Unlock()
+
+	deleteCSRFToken(sessionID)
+}
+
+// endSessions supprime toutes les sessions ouvertes pour cet email
+func endSessions(email string) {
+	sessionsMu.Lock()
+	var ended []string
+	for id, sessionEmail := range sessions {
+		if sessionEmail == email {
+			delete(sessions, id)
+			ended = append(ended, id)
+		}
+	}
+	sessionsMu.Unlock()
+
+	for _, id := range ended {
+		deleteCSRFToken(id)
+	}
+}
+
+// endOtherSessions ferme les sessions de cet email, sauf la session keep
+func endOtherSessions(email, keep string) {
+	sessionsMu.Lock()
+	var ended []string
+	for id, sessionEmail := range sessions {
+		if sessionEmail == email && id != keep {
+			delete(sessions, id)
+			ended = append(ended, id)
+		}
+	}
+	sessionsMu.Unlock()
+
+	for _, id := range ended {
+		deleteCSRFToken(id)
+	}
+}
+
+// renameSessions rattache les sessions ouvertes pour oldEmail à la nouvelle adresse du compte
+func renameSessions(oldEmail, email string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	for id, sessionEmail := range sessions {
+		if sessionEmail == oldEmail {
+			sessions[id] = email
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	data "forum/Data"
+)
+
+// Paramètres du compte, depuis /profil : le mot de passe, l'adresse et le nom ne changent que
+// sur présentation du mot de passe actuel, et une nouvelle adresse doit être confirmée avant
+// de pouvoir publier. Un ancien nom d'utilisateur mène encore au profil.
+
+var emailPattern = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+
+func validEmail(email string) bool {
+	return emailPattern.MatchString(email)
+}
+
+// settingsHandler applique les formulaires de la section Paramètres du profil
+type settingsHandler struct{}
+
+func (h *settingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	user, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
+		return
+	}
+
+	var message string
+	var err error
+	switch r.FormValue("action") {
+	case "password":
+		message, err = changePassword(r, user)
+	case "email":
+		message, err = changeEmail(r, user)
+	case "username":
+		message, err = changeUsername(r, user)
+	default:
+		http.Error(w, "Action inconnue", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la mise à jour du compte", http.StatusInternalServerError)
+		log.Println("Erreur lors de la mise à jour du compte:", err)
+		return
+	}
+	setCookie(w, "error", message)
+	http.Redirect(w, r, "/profil", http.StatusSeeOther)
+}
+
+// changePassword remplace le mot de passe, ferme les autres sessions du compte et révoque
+// ses jetons d'API : un accès obtenu avec l'ancien mot de passe ne survit pas au changement
+func changePassword(r *http.Request, user *User) (string, error) {
+	if !samePassword(r.FormValue("current"), user.Password) {
+		return "Mot de passe actuel incorrect", nil
+	}
+	password := r.FormValue("password")
+	if _, ok := validPassword(password); !ok {
+		return "Le mot de passe doit contenir entre " + strconv.Itoa(minPasswordLength) + " et " + strconv.Itoa(maxPasswordLength) + " caracteres", nil
+	}
+	if password != r.FormValue("confirm") {
+		return "Les deux mots de passe ne correspondent pas", nil
+	}
+	if err := store.Users.SetPassword(r.Context(), user.ID, password); err != nil {
+		return "", err
+	}
+	if err := store.Tokens.RevokeAll(r.Context(), user.ID, time.Now()); err != nil {
+		return "", err
+	}
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		endOtherSessions(user.Email, cookie.Value)
+	}
+	return "Mot de passe modifie", nil
+}
+
+// changeEmail remplace l'adresse et envoie le lien qui la confirme. Les liens de
+// réinitialisation envoyés à l'ancienne adresse ne servent plus.
+func changeEmail(r *http.Request, user *User) (string, error) {
+	if !samePassword(r.FormValue("current"), user.Password) {
+		return "Mot de passe actuel incorrect", nil
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	if !validEmail(email) {
+		return "Email invalide", nil
+	}
+	if email == user.Email {
+		return "C'est deja votre adresse", nil
+	}
+	if emailExists(r.Context(), email) {
+		return "Email deja utilise par un autre compte", nil
+	}
+	if err := store.Users.ChangeEmail(r.Context(), user.ID, email); err != nil {
+		return "", err
+	}
+	if err := store.Resets.Discard(r.Context(), user.ID, time.Now()); err != nil {
+		return "", err
+	}
+	// Les sessions désignent le compte par son adresse
+	renameSessions(user.Email, email)
+	user.Email, user.EmailVerified = email, false
+	if err := sendVerificationEmail(r, user); err != nil {
+		log.Println("Erreur lors de l'envoi de l'email de confirmation:", err)
+		return "Adresse modifiee, mais l'email de confirmation n'a pas pu etre envoye : redemandez-le ci-dessous", nil
+	}
+	return "Adresse modifiee : confirmez-la avec le lien envoye par email pour pouvoir publier", nil
+}
+
+// changeUsername renomme le compte, aux mêmes règles qu'à l'inscription ; l'ancien nom
+// redirige vers le nouveau profil
+func changeUsername(r *http.Request, user *User) (string, error) {
+	if !samePassword(r.FormValue("current"), user.Password) {
+		return "Mot de passe actuel incorrect", nil
+	}
+	username := strings.TrimSpace(r.FormValue("username"))
+	if !validUsername(username) {
+		return usernameRules, nil
+	}
+	if username == user.Username {
+		return "C'est deja votre nom d'utilisateur", nil
+	}
+	if usernameExists(r.Context(), username) {
+		return "Nom d'utilisateur deja pris, veuillez en choisir un autre", nil
+	}
+	if err := store.Users.Rename(r.Context(), user.ID, user.Username, username); err != nil {
+		return "", err
+	}
+	return "Nom d'utilisateur modifie", nil
+}
+
+// formerProfile redirige l'adresse du profil d'un ancien nom vers le profil actuel du compte,
+// ou répond false si personne n'a porté ce nom. La redirection n'est pas permanente : le nom
+// libéré peut être repris par un autre compte.
+func formerProfile(w http.ResponseWriter, r *http.Request, username string) (bool, error) {
+	user, err := store.Users.ByFormerUsername(r.Context(), username)
+	if errors.Is(err, data.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	http.Redirect(w, r, profileURL(user.Username), http.StatusFound)
+	return true, nil
+}
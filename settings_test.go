@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// submitSettings envoie un formulaire des paramètres du compte dans la session de email et
+// retourne le message affiché au retour sur le profil
+func submitSettings(t *testing.T, email string, form url.Values) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	(&settingsHandler{}).ServeHTTP(w, withSession(t, postForm("/profil/settings", form), email))
+	assertRedirect(t, w, "/profil")
+	message, _ := responseCookie(w, "error")
+	return message
+}
+
+func TestChangePassword(t *testing.T) {
+	openTestDatabase(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	apiToken := createToken(t, aliceID, []string{scopeRead}, time.Now().Add(time.Hour))
+	newSession("autre-appareil", "alice@example.com")
+	t.Cleanup(func() { endSession("autre-appareil") })
+
+	tests := []struct {
+		name                       string
+		current, password, confirm string
+		message                    string
+		stored                     string
+	}{
+		{"mot de passe actuel incorrect", "secret", longPassword, longPassword, "Mot de passe actuel incorrect", "secret1"},
+		{"trop court", "secret1", "court", "court", "entre 6 et 64", "secret1"},
+		{"confirmation différente", "secret1", longPassword, longPassword + "!", "ne correspondent pas", "secret1"},
+		{"phrase de passe", "secret1", longPassword, longPassword, "Mot de passe modifie", longPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"action": {"password"}, "current": {tt.current}, "password": {tt.password}, "confirm": {tt.confirm}}
+			if message := submitSettings(t, "alice@example.com", form); !strings.Contains(message, tt.message) {
+				t.Errorf("message %q, attendu %q", message, tt.message)
+			}
+			if alice, _ := store.Users.ByID(ctx, aliceID); alice.Password != tt.stored {
+				t.Errorf("mot de passe enregistré %q, attendu %q", alice.Password, tt.stored)
+			}
+		})
+	}
+
+	// Seule la session qui a changé le mot de passe reste ouverte, et aucun jeton ne survit
+	if _, ok := sessionEmail("autre-appareil"); ok {
+		t.Error("autre session toujours ouverte")
+	}
+	if token, err := store.Tokens.ByHash(ctx, hashToken(apiToken)); err != nil || token.Active(time.Now()) {
+		t.Errorf("jeton d'API toujours actif : %+v, %v", token, err)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	openTestDatabase(t)
+	useConfig(t).PublicURL = "https://forum.example"
+	outbox := useMailer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	verifyUser(t, aliceID)
+	createUser(t, "bob")
+	pending := &data.PasswordReset{UserID: aliceID, Hash: hashToken(newResetSecret()), ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := store.Resets.Create(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := []struct {
+		name, current, email, message string
+	}{
+		{"mot de passe actuel incorrect", "mauvais", "alice@nouveau.example", "Mot de passe actuel incorrect"},
+		{"adresse invalide", "secret1", "alice", "Email invalide"},
+		{"adresse d'un autre compte", "secret1", "bob@example.com", "deja utilise"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"action": {"email"}, "current": {tt.current}, "email": {tt.email}}
+			if message := submitSettings(t, "alice@example.com", form); !strings.Contains(message, tt.message) {
+				t.Errorf("message %q, attendu %q", message, tt.message)
+			}
+		})
+	}
+	if reset, _ := store.Resets.ByHash(ctx, pending.Hash); !reset.Valid(time.Now()) {
+		t.Fatal("lien de réinitialisation invalidé par un changement refusé")
+	}
+
+	form := url.Values{"action": {"email"}, "current": {"secret1"}, "email": {"alice@nouveau.example"}}
+	if message := submitSettings(t, "alice@example.com", form); !strings.Contains(message, "Adresse modifiee") {
+		t.Fatalf("message %q", message)
+	}
+	alice, err := store.Users.ByID(ctx, aliceID)
+	if err != nil || alice.Email != "alice@nouveau.example" || alice.EmailVerified {
+		t.Fatalf("compte après le changement : %+v, %v", alice, err)
+	}
+	// La session suit le compte, la nouvelle adresse reçoit son lien de confirmation
+	if email, ok := sessionEmail("session-alice@example.com"); !ok || email != "alice@nouveau.example" {
+		t.Errorf("session de %q, attendu la nouvelle adresse", email)
+	}
+	if !strings.Contains(outbox.String(), "To: alice@nouveau.example") {
+		t.Errorf("lien de confirmation non envoyé à la nouvelle adresse :\n%s", outbox.String())
+	}
+	// Un lien envoyé à l'ancienne adresse ne permet plus de reprendre le compte
+	if reset, _ := store.Resets.ByHash(ctx, pending.Hash); reset.Valid(time.Now()) {
+		t.Error("lien de réinitialisation de l'ancienne adresse toujours valable")
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	openTestDatabase(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	createUser(t, "bob")
+
+	rejected := []struct {
+		name, current, username, message string
+	}{
+		{"sans mot de passe", "", "alice2", "Mot de passe actuel incorrect"},
+		{"mot de passe actuel incorrect", "mauvais", "alice2", "Mot de passe actuel incorrect"},
+		{"nom vide", "secret1", "  ", usernameRules},
+		{"nom distant", "secret1", "bob@mastodon.example", usernameRules},
+		{"nom trop long", "secret1", strings.Repeat("a", maxUsernameLength+1), usernameRules},
+		{"nom déjà pris", "secret1", "bob", "deja pris"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"action": {"username"}, "current": {tt.current}, "username": {tt.username}}
+			if message := submitSettings(t, "alice@example.com", form); !strings.Contains(message, tt.message) {
+				t.Errorf("message %q, attendu %q", message, tt.message)
+			}
+			if alice, _ := store.Users.ByID(ctx, aliceID); alice.Username != "alice" {
+				t.Errorf("compte renommé en %q", alice.Username)
+			}
+		})
+	}
+
+	form := url.Values{"action": {"username"}, "current": {"secret1"}, "username": {" alice2 "}}
+	if message := submitSettings(t, "alice@example.com", form); message != "Nom d'utilisateur modifie" {
+		t.Fatalf("message %q", message)
+	}
+	if alice, _ := store.Users.ByID(ctx, aliceID); alice.Username != "alice2" {
+		t.Fatalf("nom %q, attendu alice2", alice.Username)
+	}
+	// L'ancien profil mène au nouveau
+	w := httptest.NewRecorder()
+	if found, err := formerProfile(w, httptest.NewRequest(http.MethodGet, profileURL("alice"), nil), "alice"); err != nil || !found {
+		t.Fatalf("ancien nom inconnu : %v", err)
+	}
+	if w.Code != http.StatusFound || w.Header().Get("Location") != profileURL("alice2") {
+		t.Errorf("statut %d vers %q, attendu 302 vers le nouveau profil", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,21 @@
+// Affiche le message d'erreur laissé par le serveur dans le cookie "error"
+document.addEventListener("DOMContentLoaded", function() {
+    const error = getCookie("error");
+    if (error) {
+        alert(error);
+        document.cookie = "error=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;";
+    }
+
+    // Boutons de navigation : <button data-href="/page">
+    document.querySelectorAll("button[data-href]").forEach(function(button) {
+        button.addEventListener("click", function() {
+            window.location.href = button.dataset.href;
+        });
+    });
+});
+
+function getCookie(name) {
+    const value = `; ${document.cookie}`;
+    const parts = value.split(`; ${name}=`);
+    if (parts.length === 2) return parts.pop().split(';').shift();
+}
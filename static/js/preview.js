@@ -0,0 +1,21 @@
+// Aperçu en direct du contenu Markdown d'un nouveau post
+document.addEventListener("DOMContentLoaded", function() {
+    const content = document.getElementById("content");
+    const preview = document.getElementById("preview");
+    const token = document.querySelector("input[name=csrf_token]").value;
+    let timer;
+
+    content.addEventListener("input", function() {
+        clearTimeout(timer);
+        timer = setTimeout(function() {
+            const body = new URLSearchParams({content: content.value});
+            fetch("/preview", {
+                method: "POST",
+                headers: {"X-CSRF-Token": token},
+                body: body,
+            })
+                .then(function(response) { return response.ok ? response.text() : ""; })
+                .then(function(html) { preview.innerHTML = html; });
+        }, 300);
+    });
+});
@@ -0,0 +1,18 @@
+// Gère le clic sur la photo de profil
+document.addEventListener("DOMContentLoaded", function() {
+    const picture = document.getElementById("profile-picture");
+    const input = document.getElementById("profile-picture-input");
+    if (!picture || !input) {
+        return;
+    }
+
+    picture.addEventListener("click", function() {
+        // Afficher le formulaire d'upload d'image
+        document.getElementById("upload-form").style.display = "block";
+    });
+
+    // Afficher le nom du fichier sélectionné
+    input.addEventListener("change", function() {
+        document.getElementById("upload-button").value = "Upload ";
+    });
+});
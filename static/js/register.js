@@ -0,0 +1,31 @@
+document.addEventListener("DOMContentLoaded", function() {
+    document.getElementById("registrationForm").addEventListener("submit", function(event) {
+        if (!validateForm()) {
+            event.preventDefault();
+        }
+    });
+});
+
+function validateForm() {
+    const email = document.getElementById('email').value;
+    const username = document.getElementById('username').value;
+    const password = document.getElementById('password').value;
+
+    if (!email || !username || !password) {
+        alert("Veuillez renseigner tous les champs.");
+        return false;
+    }
+
+    const emailPattern = /^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$/;
+    if (!emailPattern.test(email)) {
+        alert("Veuillez renseigner un email valide.");
+        return false;
+    }
+
+    if (password.length < 6 || password.length > 64) {
+        alert("Le mot de passe doit contenir entre 6 et 64 caractères.");
+        return false;
+    }
+
+    return true;
+}
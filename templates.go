@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Gabarits partagés par toutes les pages : la mise en page de base et les partiels
+const (
+	layoutPattern   = "layout/*.html"
+	partialsPattern = "partials/*.html"
+	pagesPattern    = "*.html"
+)
+
+// templateSet garde chaque page analysée une fois pour toutes, avec la mise en page et les partiels.
+// En mode développement, les gabarits sont rechargés dès qu'un fichier change.
+type templateSet struct {
+	mu       sync.RWMutex
+	fsys     fs.FS
+	dev      bool
+	pages    map[string]*template.Template
+	loadedAt time.Time
+}
+
+var templates *templateSet
+
+// loadTemplates analyse toutes les pages du système de fichiers
+func loadTemplates(fsys fs.FS, dev bool) (*templateSet, error) {
+	ts := &templateSet{fsys: fsys, dev: dev}
+	if err := ts.load(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (ts *templateSet) load() error {
+	shared, err := template.New("layout").Funcs(templateFuncs(nil, nil)).ParseFS(ts.fsys, layoutPattern, partialsPattern)
+	if err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(ts.fsys, pagesPattern)
+	if err != nil {
+		return err
+	}
+	pages := map[string]*template.Template{}
+	for _, file := range files {
+		page, err := shared.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err := page.ParseFS(ts.fsys, file); err != nil {
+			return err
+		}
+		pages[file] = page
+	}
+
+	ts.mu.Lock()
+	ts.pages = pages
+	ts.loadedAt = time.Now()
+	ts.mu.Unlock()
+	return nil
+}
+
+// reloadIfChanged recharge les gabarits si un fichier a été modifié depuis le dernier chargement
+func (ts *templateSet) reloadIfChanged() {
+	ts.mu.RLock()
+	loadedAt := ts.loadedAt
+	ts.mu.RUnlock()
+
+	changed := false
+	fs.WalkDir(ts.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(loadedAt) {
+			changed = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if !changed {
+		return
+	}
+	if err := ts.load(); err != nil {
+		log.Println("Erreur lors du rechargement des gabarits:", err)
+		return
+	}
+	log.Println("Gabarits rechargés")
+}
+
+// page retourne une copie de la page, prête à recevoir les fonctions propres à la requête
+func (ts *templateSet) page(name string) (*template.Template, error) {
+	if ts.dev {
+		ts.reloadIfChanged()
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	t, ok := ts.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("gabarit %q introuvable", name)
+	}
+	return t.Clone()
+}
+
+// templateFuncs retourne les fonctions disponibles dans les gabarits. csrfToken et viewer
+// dépendent de la requête, les autres sont communes à toutes les pages.
+func templateFuncs(w http.ResponseWriter, r *http.Request) template.FuncMap {
+	var token string
+	var user *User
+	if r != nil {
+		// Le jeton peut poser un cookie : il doit être connu avant d'écrire la page
+		token = csrfToken(w, r)
+		if u, ok := sessionUser(r); ok {
+			user = u
+		}
+	}
+	return template.FuncMap{
+		"csrfToken":       func() string { return token },
+		"viewer":          func() *User { return user },
+		"markdown":        renderMarkdown,
+		"date":            formatDate,
+		"plural":          plural,
+		"postURL":         postURL,
+		"profileURL":      profileURL,
+		"userFeedURL":     userFeedURL,
+		"fediverseHandle": fediverseHandle,
+	}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("02/01/2006 à 15:04")
+}
+
+// plural accorde le nom avec n : plural 1 "commentaire" "commentaires" donne "1 commentaire"
+func plural(n int, singular, pluralForm string) string {
+	if n == 0 || n == 1 {
+		return strconv.Itoa(n) + " " + singular
+	}
+	return strconv.Itoa(n) + " " + pluralForm
+}
+
+func postURL(id int) string {
+	return "/details/" + strconv.Itoa(id)
+}
+
+func profileURL(username string) string {
+	return "/profilOther?username=" + url.QueryEscape(username)
+}
+
+func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	t, err := templates.page(name)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := t.Funcs(templateFuncs(w, r)).ExecuteTemplate(&buf, "layout", data); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
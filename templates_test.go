@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// useTemplates charge les gabarits embarqués le temps du test
+func useTemplates(t *testing.T) {
+	t.Helper()
+	ts, err := loadTemplates(subAssets(embeddedAssets, "src"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := templates
+	templates = ts
+	t.Cleanup(func() { templates = previous })
+}
+
+// Charges utiles XSS soumises comme titre, contenu, nom d'utilisateur ou commentaire
+var xssPayloads = []string{
+	`<script>alert("xss")</script>`,
+	`<img src=x onerror=alert(1)>`,
+	`<a href="javascript:alert(1)">lien</a>`,
+	`<div onmouseover="alert(1)">survol</div>`,
+	`<svg onload=alert(1)>`,
+	`<iframe src="https://evil.example"></iframe>`,
+	`"><script>alert(1)</script>`,
+	`' onfocus='alert(1)`,
+	`[lien](javascript:alert(1))`,
+	`[lien](JaVaScRiPt:alert(1))`,
+	`![image](javascript:alert(1))`,
+	`<span class="spoiler" onclick="alert(1)">piège</span>`,
+	`||<script>alert(1)</script>||`,
+	`||[lien](javascript:alert(1))||`,
+	`||<img src=x onerror=alert(1)>||`,
+}
+
+// assertNoXSS analyse le HTML et échoue s'il contient un script en ligne, un cadre, un
+// attribut de gestionnaire d'événement ou une URL javascript:
+func assertNoXSS(t *testing.T, payload, document string) {
+	t.Helper()
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		t.Fatalf("%q : HTML illisible : %v", payload, err)
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script":
+				// Seuls les scripts de l'interface, chargés par src, sont permis
+				if n.FirstChild != nil || !hasAttr(n, "src") {
+					t.Errorf("%q : script en ligne dans le rendu", payload)
+				}
+			case "iframe", "object", "embed":
+				t.Errorf("%q : élément <%s> dans le rendu", payload, n.Data)
+			}
+			for _, a := range n.Attr {
+				value := strings.ToLower(strings.TrimSpace(a.Val))
+				if strings.HasPrefix(strings.ToLower(a.Key), "on") {
+					t.Errorf("%q : attribut %s=%q dans le rendu", payload, a.Key, a.Val)
+				}
+				if (a.Key == "href" || a.Key == "src") && strings.HasPrefix(value, "javascript:") {
+					t.Errorf("%q : URL %s=%q dans le rendu", payload, a.Key, a.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// TestPagesEscapeUserContent rend les pages avec les charges utiles dans chaque champ
+// saisi par un utilisateur
+func TestPagesEscapeUserContent(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	for i, payload := range xssPayloads {
+		userID := createUser(t, fmt.Sprintf("%s%d", payload, i))
+		result, err := testDB.Exec("INSERT INTO posts (title, content, user_id) VALUES (?, ?, ?)", payload, payload, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		postID, _ := result.LastInsertId()
+		if _, err := testDB.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, payload); err != nil {
+			t.Fatal(err)
+		}
+
+		pages := []struct {
+			handler http.Handler
+			target  string
+		}{
+			{&postDetailHandler{}, fmt.Sprintf("/details/%d", postID)},
+			{&postsHandler{}, "/posts"},
+			{&mainPageHandler{}, "/"},
+			{&profilOtherHandler{}, "/profilOther?username=" + url.QueryEscape(fmt.Sprintf("%s%d", payload, i))},
+		}
+		for _, page := range pages {
+			w := httptest.NewRecorder()
+			page.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, page.target, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s : statut %d : %s", page.target, w.Code, w.Body)
+			}
+			assertNoXSS(t, page.target+" "+payload, w.Body.String())
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	csp := w.Header().Get("Content-Security-Policy")
+	for _, directive := range []string{"script-src 'self'", "object-src 'none'", "frame-ancestors 'none'"} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("directive %q absente de la politique %q", directive, csp)
+		}
+	}
+	if strings.Contains(csp, "unsafe-inline") {
+		t.Errorf("la politique autorise les scripts en ligne : %q", csp)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("en-têtes : %v", w.Header())
+	}
+}
+
+// TestDevModeReloadsSourceTemplates modifie un gabarit de src sur disque, comme pendant le
+// développement : il n'est rechargé qu'en mode développement
+func TestDevModeReloadsSourceTemplates(t *testing.T) {
+	dir := t.TempDir()
+	err := fs.WalkDir(embeddedAssets, "src", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := embeddedAssets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	erreur := filepath.Join(dir, "src", "erreur.html")
+	original, err := os.ReadFile(erreur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dev := range []bool{false, true} {
+		ts, err := loadTemplates(subAssets(loadAssets("", dev), "src"), dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edited := strings.Replace(string(original), "Page not found", "Modifié à chaud", 1)
+		if err := os.WriteFile(erreur, []byte(edited), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Second)
+		os.Chtimes(erreur, later, later)
+
+		page, err := ts.page("erreur.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body strings.Builder
+		if err := page.Funcs(templateFuncs(nil, nil)).ExecuteTemplate(&body, "layout", nil); err != nil {
+			t.Fatal(err)
+		}
+		if reloaded := strings.Contains(body.String(), "Modifié à chaud"); reloaded != dev {
+			t.Errorf("mode développement %v : gabarit rechargé %v", dev, reloaded)
+		}
+		if err := os.WriteFile(erreur, original, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
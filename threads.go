@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	data "forum/Data"
+)
+
+type threadModerationHandler struct{}
+
+func (h *threadModerationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	moderator, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if !moderator.IsModerator() {
+		http.Error(w, "Accès réservé aux modérateurs", http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
+		return
+	}
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Post non trouvé", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	switch r.FormValue("action") {
+	case "pin":
+		err = store.Posts.SetPinned(ctx, postID, true)
+	case "unpin":
+		err = store.Posts.SetPinned(ctx, postID, false)
+	case "lock":
+		err = store.Posts.SetLocked(ctx, postID, true)
+	case "unlock":
+		err = store.Posts.SetLocked(ctx, postID, false)
+	case "archive":
+		err = store.Posts.SetArchived(ctx, postID, true)
+	case "unarchive":
+		err = store.Posts.SetArchived(ctx, postID, false)
+	default:
+		http.Error(w, "Action de modération inconnue", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, data.ErrNotFound) {
+		http.Error(w, "Post non trouvé", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la modération du sujet", http.StatusInternalServerError)
+		log.Println("Erreur lors de la modération du sujet:", err)
+		return
+	}
+	http.Redirect(w, r, postURL(postID), http.StatusSeeOther)
+}
+
+// archiveInactiveThreads archive périodiquement les sujets sans activité depuis days jours
+func archiveInactiveThreads(days int) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		archiveInactivePosts(days)
+		<-ticker.C
+	}
+}
+
+// archiveInactivePosts archive en une passe les sujets non épinglés sans activité depuis days jours
+func archiveInactivePosts(days int) {
+	n, err := store.Posts.ArchiveInactive(context.Background(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Println("Erreur lors de l'archivage des sujets inactifs:", err)
+	} else if n > 0 {
+		log.Printf("%d sujet(s) archivé(s) pour inactivité\n", n)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// createPost insère un sujet et retourne son ID
+func createPost(t *testing.T, userID int, title string) int {
+	t.Helper()
+	result, err := testDB.Exec("INSERT INTO posts (title, content, user_id) VALUES (?, ?, ?)", title, "Contenu "+title, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// postState retourne les indicateurs épinglé, verrouillé et archivé du sujet
+func postState(t *testing.T, postID int) (pinned, locked, archived bool) {
+	t.Helper()
+	if err := testDB.QueryRow("SELECT pinned, locked, archived FROM posts WHERE id = ?", postID).Scan(&pinned, &locked, &archived); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestThreadModerationHandler(t *testing.T) {
+	openTestDatabase(t)
+	moderatorID := createUser(t, "modo")
+	aliceID := createUser(t, "alice")
+	setRole(t, moderatorID, data.RoleModerator)
+	postID := createPost(t, aliceID, "Sujet")
+
+	moderate := func(email string, postID int, action string) *httptest.ResponseRecorder {
+		form := url.Values{"post_id": {strconv.Itoa(postID)}, "action": {action}}
+		w := httptest.NewRecorder()
+		(&threadModerationHandler{}).ServeHTTP(w, withSession(t, postForm("/moderation/thread", form), email))
+		return w
+	}
+
+	if w := moderate("alice@example.com", postID, "lock"); w.Code != http.StatusForbidden {
+		t.Errorf("verrouillage par un simple membre : statut %d, attendu 403", w.Code)
+	}
+	if w := moderate("modo@example.com", postID+1, "lock"); w.Code != http.StatusNotFound {
+		t.Errorf("sujet inconnu : statut %d, attendu 404", w.Code)
+	}
+	if w := moderate("modo@example.com", postID, "supprimer"); w.Code != http.StatusBadRequest {
+		t.Errorf("action inconnue : statut %d, attendu 400", w.Code)
+	}
+
+	location := fmt.Sprintf("/details/%d", postID)
+	steps := []struct {
+		action                   string
+		pinned, locked, archived bool
+	}{
+		{"pin", true, false, false},
+		{"lock", true, true, false},
+		{"unpin", false, true, false},
+		{"unlock", false, false, false},
+		{"archive", false, false, true},
+		{"unarchive", false, false, false},
+	}
+	for _, step := range steps {
+		assertRedirect(t, moderate("modo@example.com", postID, step.action), location)
+		if pinned, locked, archived := postState(t, postID); pinned != step.pinned || locked != step.locked || archived != step.archived {
+			t.Errorf("après %s : épinglé %v, verrouillé %v, archivé %v", step.action, pinned, locked, archived)
+		}
+	}
+}
+
+func TestClosedThreadsRefuseComments(t *testing.T) {
+	openTestDatabase(t)
+	aliceID := createUser(t, "alice")
+	verifyUser(t, aliceID)
+	open := createPost(t, aliceID, "Ouvert")
+	locked := createPost(t, aliceID, "Verrouillé")
+	archived := createPost(t, aliceID, "Archivé")
+	if _, err := testDB.Exec("UPDATE posts SET locked = 1 WHERE id = ?", locked); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("UPDATE posts SET archived = 1 WHERE id = ?", archived); err != nil {
+		t.Fatal(err)
+	}
+
+	comment := func(postID int) *httptest.ResponseRecorder {
+		target := fmt.Sprintf("/details/%d", postID)
+		w := httptest.NewRecorder()
+		(&postDetailHandler{}).ServeHTTP(w, withSession(t, postForm(target, url.Values{"comment": {"Réponse"}}), "alice@example.com"))
+		return w
+	}
+	for _, postID := range []int{locked, archived} {
+		if w := comment(postID); w.Code != http.StatusForbidden {
+			t.Errorf("commentaire sur le sujet %d fermé : statut %d, attendu 403", postID, w.Code)
+		}
+	}
+	assertRedirect(t, comment(open), fmt.Sprintf("/details/%d", open))
+
+	var n int
+	testDB.QueryRow("SELECT COUNT(*) FROM comments").Scan(&n)
+	if n != 1 {
+		t.Errorf("%d commentaires enregistrés, attendu 1", n)
+	}
+	var active bool
+	testDB.QueryRow("SELECT last_activity_at IS NOT NULL FROM posts WHERE id = ?", open).Scan(&active)
+	if !active {
+		t.Error("l'activité du sujet commenté n'est pas mise à jour")
+	}
+}
+
+func TestPinnedPostsComeFirst(t *testing.T) {
+	useTemplates(t)
+	openTestDatabase(t)
+	aliceID := createUser(t, "alice")
+	pinned := createPost(t, aliceID, "Annonce épinglée")
+	createPost(t, aliceID, "Sujet récent")
+	if _, err := testDB.Exec("UPDATE posts SET pinned = 1, created_at = ? WHERE id = ?", time.Now().UTC().AddDate(0, 0, -1), pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	(&postsHandler{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts", nil))
+	body := w.Body.String()
+	if i, j := strings.Index(body, "Annonce épinglée"), strings.Index(body, "Sujet récent"); i < 0 || j < 0 || i > j {
+		t.Errorf("le sujet épinglé n'est pas en tête :\n%s", body)
+	}
+}
+
+func TestArchiveInactivePosts(t *testing.T) {
+	openTestDatabase(t)
+	aliceID := createUser(t, "alice")
+	old := createPost(t, aliceID, "Ancien")
+	oldPinned := createPost(t, aliceID, "Ancien épinglé")
+	revived := createPost(t, aliceID, "Ancien relancé")
+	recent := createPost(t, aliceID, "Récent")
+
+	longAgo := time.Now().UTC().AddDate(0, 0, -30-1).Format("2006-01-02 15:04:05")
+	if _, err := testDB.Exec("UPDATE posts SET created_at = ? WHERE id IN (?, ?, ?)", longAgo, old, oldPinned, revived); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("UPDATE posts SET pinned = 1 WHERE id = ?", oldPinned); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("UPDATE posts SET last_activity_at = CURRENT_TIMESTAMP WHERE id = ?", revived); err != nil {
+		t.Fatal(err)
+	}
+
+	archiveInactivePosts(30)
+	for postID, want := range map[int]bool{old: true, oldPinned: false, revived: false, recent: false} {
+		if _, _, archived := postState(t, postID); archived != want {
+			t.Errorf("sujet %d : archivé %v, attendu %v", postID, archived, want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	data "forum/Data"
+)
+
+// Les jetons d'accès personnels authentifient les scripts auprès de l'API par l'en-tête
+// Authorization: Bearer <jeton>. Le secret n'est montré qu'à sa création ; la base n'en
+// garde que l'empreinte SHA-256.
+const tokenPrefix = "forum_"
+
+// Portées d'un jeton. Une requête en lecture exige scopeRead ; chaque écriture exige la
+// portée de la ressource modifiée.
+const (
+	scopeRead     = "read"
+	scopePosts    = "posts"
+	scopeComments = "comments"
+	scopeVotes    = "votes"
+)
+
+type tokenScope struct {
+	Name  string
+	Label string
+}
+
+var tokenScopes = []tokenScope{
+	{scopeRead, "Lire les sujets, commentaires et profils"},
+	{scopePosts, "Publier et modifier des sujets"},
+	{scopeComments, "Publier et modifier des commentaires"},
+	{scopeVotes, "Voter"},
+}
+
+// Durées de validité proposées, en jours
+var tokenLifetimes = []int{7, 30, 90, 365}
+
+const (
+	maxTokenNameLength = 100
+	// Intervalle minimal entre deux mises à jour de la date de dernière utilisation
+	tokenTouchInterval = time.Minute
+)
+
+// newTokenSecret génère le secret d'un jeton et son empreinte
+func newTokenSecret() (secret, hash string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Erreur lors de la génération d'un jeton d'API:", err)
+	}
+	secret = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashToken(secret)
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+type tokenContextKey struct{}
+
+// tokenAuth est l'authentification d'une requête par jeton, gardée dans son contexte
+type tokenAuth struct {
+	user  *User
+	token *data.APIToken
+}
+
+// requestToken retourne le jeton qui authentifie la requête, ou nil pour une session ou un visiteur
+func requestToken(r *http.Request) *tokenAuth {
+	auth, _ := r.Context().Value(tokenContextKey{}).(*tokenAuth)
+	return auth
+}
+
+// authenticateToken vérifie le jeton Bearer des requêtes à l'API. Un jeton inconnu, expiré
+// ou révoqué est refusé ; un jeton valide rend son titulaire visible de sessionUser, pour
+// que sanctions et limites s'appliquent comme à une session.
+func authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" || !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		secret, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			invalidToken(w, "En-tête Authorization attendu : Bearer <jeton>")
+			return
+		}
+		ctx := r.Context()
+		token, err := store.Tokens.ByHash(ctx, hashToken(strings.TrimSpace(secret)))
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				invalidToken(w, "Jeton inconnu")
+				return
+			}
+			apiInternalError(w, "Erreur lors de la vérification du jeton", err)
+			return
+		}
+		now := time.Now()
+		if !token.Active(now) {
+			invalidToken(w, "Jeton expiré ou révoqué")
+			return
+		}
+		user, err := store.Users.ByID(ctx, token.UserID)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				invalidToken(w, "Jeton inconnu")
+				return
+			}
+			apiInternalError(w, "Erreur lors de la vérification du jeton", err)
+			return
+		}
+		if !token.LastUsed.Valid || now.Sub(token.LastUsed.Time) >= tokenTouchInterval {
+			if err := store.Tokens.Touch(ctx, token.ID, now); err != nil {
+				log.Println("Erreur lors de la mise à jour du jeton:", err)
+			}
+		}
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !token.HasScope(scopeRead) {
+			insufficientScope(w, scopeRead)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, tokenContextKey{}, &tokenAuth{user: user, token: token})))
+	})
+}
+
+func invalidToken(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	apiError(w, http.StatusUnauthorized, "invalid_token", message)
+}
+
+func insufficientScope(w http.ResponseWriter, scope string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+	apiError(w, http.StatusForbidden, "insufficient_scope", "Ce jeton n'a pas la portée "+scope)
+}
+
+type ProfilPageData struct {
+	*User
+	Tokens    []data.APIToken
+	Scopes    []tokenScope
+	Lifetimes []int
+	// Secret du jeton qui vient d'être créé, affiché une seule fois
+	NewToken string
+	Now      time.Time
+}
+
+// renderProfil affiche le profil de l'utilisateur connecté avec ses jetons
+func renderProfil(w http.ResponseWriter, r *http.Request, user *User, newToken string) {
+	tokens, err := store.Tokens.ForUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération des jetons", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération des jetons:", err)
+		return
+	}
+	renderTemplate(w, r, "profil.html", ProfilPageData{
+		User: user, Tokens: tokens, Scopes: tokenScopes, Lifetimes: tokenLifetimes, NewToken: newToken, Now: time.Now(),
+	})
+}
+
+// tokensHandler crée et révoque les jetons de l'utilisateur connecté depuis /profil
+type tokensHandler struct{}
+
+func (h *tokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	user, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "create":
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" || utf8.RuneCountInString(name) > maxTokenNameLength {
+			setErrorCookie(w, "Le nom du jeton doit faire entre 1 et "+strconv.Itoa(maxTokenNameLength)+" caracteres")
+			http.Redirect(w, r, "/profil", http.StatusSeeOther)
+			return
+		}
+		var scopes []string
+		for _, s := range tokenScopes {
+			if r.Form.Has("scope_" + s.Name) {
+				scopes = append(scopes, s.Name)
+			}
+		}
+		if len(scopes) == 0 {
+			setErrorCookie(w, "Choisissez au moins une portee")
+			http.Redirect(w, r, "/profil", http.StatusSeeOther)
+			return
+		}
+		days, err := strconv.Atoi(r.FormValue("days"))
+		if err != nil || !validLifetime(days) {
+			http.Error(w, "Durée de validité invalide", http.StatusBadRequest)
+			return
+		}
+		secret, hash := newTokenSecret()
+		token := &data.APIToken{UserID: user.ID, Name: name, Hash: hash, Scopes: scopes, ExpiresAt: time.Now().AddDate(0, 0, days)}
+		if _, err := store.Tokens.Create(r.Context(), token); err != nil {
+			http.Error(w, "Erreur lors de la création du jeton", http.StatusInternalServerError)
+			log.Println("Erreur lors de la création du jeton:", err)
+			return
+		}
+		// Le secret n'est affiché qu'ici : la page n'est pas mise en cache
+		w.Header().Set("Cache-Control", "no-store")
+		renderProfil(w, r, user, secret)
+	case "revoke":
+		id, err := strconv.Atoi(r.FormValue("token_id"))
+		if err != nil {
+			http.Error(w, "Jeton non trouvé", http.StatusNotFound)
+			return
+		}
+		if err := store.Tokens.Revoke(r.Context(), id, user.ID, time.Now()); err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				http.Error(w, "Jeton non trouvé", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Erreur lors de la révocation du jeton", http.StatusInternalServerError)
+			log.Println("Erreur lors de la révocation du jeton:", err)
+			return
+		}
+		http.Redirect(w, r, "/profil", http.StatusSeeOther)
+	default:
+		http.Error(w, "Action inconnue", http.StatusBadRequest)
+	}
+}
+
+func validLifetime(days int) bool {
+	for _, d := range tokenLifetimes {
+		if d == days {
+			return true
+		}
+	}
+	return false
+}
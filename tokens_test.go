@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// createToken enregistre un jeton de l'utilisateur et retourne son secret
+func createToken(t *testing.T, userID int, scopes []string, expiresAt time.Time) string {
+	t.Helper()
+	secret, hash := newTokenSecret()
+	_, err := store.Tokens.Create(context.Background(), &data.APIToken{UserID: userID, Name: "test", Hash: hash, Scopes: scopes, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// newAPIServer sert l'API comme serve, derrière les mêmes intermédiaires d'authentification
+func newAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/api/", &apiNotFoundHandler{})
+	mux.Handle("/api/openapi.json", &apiSpecHandler{})
+	mux.Handle(apiPrefix+"posts", &apiPostsHandler{})
+	mux.Handle(apiPrefix+"posts/", &apiPostHandler{})
+	mux.Handle(apiPrefix+"comments/", &apiCommentHandler{})
+	mux.Handle(apiPrefix+"users/", &apiUserHandler{})
+	mux.Handle(apiPrefix+"me", &apiMeHandler{})
+	srv := httptest.NewServer(authenticateToken(enforceSanctions(verifyCSRF(mux))))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	openTestDatabase(t)
+	aliceID := createUser(t, "alice")
+	verifyUser(t, aliceID)
+	hour := time.Now().Add(time.Hour)
+	all := createToken(t, aliceID, []string{scopeRead, scopePosts, scopeComments, scopeVotes}, hour)
+	readOnly := createToken(t, aliceID, []string{scopeRead}, hour)
+	postsOnly := createToken(t, aliceID, []string{scopePosts}, hour)
+	expired := createToken(t, aliceID, []string{scopeRead}, time.Now().Add(-time.Minute))
+	revoked := createToken(t, aliceID, []string{scopeRead}, hour)
+	revokedToken, err := store.Tokens.ByHash(context.Background(), hashToken(revoked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Tokens.Revoke(context.Background(), revokedToken.ID, aliceID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	srv := newAPIServer(t)
+
+	tests := []struct {
+		name, method, path, header string
+		status                     int
+		challenge                  string
+	}{
+		{"anonyme", "GET", "posts", "", http.StatusOK, ""},
+		{"anonyme sur /me", "GET", "me", "", http.StatusUnauthorized, "Bearer"},
+		{"toutes portées", "GET", "me", "Bearer " + all, http.StatusOK, ""},
+		{"autre schéma", "GET", "me", "Basic " + all, http.StatusUnauthorized, "invalid_token"},
+		{"jeton inconnu", "GET", "me", "Bearer forum_inconnu", http.StatusUnauthorized, "invalid_token"},
+		{"jeton expiré", "GET", "me", "Bearer " + expired, http.StatusUnauthorized, "invalid_token"},
+		{"jeton révoqué", "GET", "me", "Bearer " + revoked, http.StatusUnauthorized, "invalid_token"},
+		{"lecture sans portée read", "GET", "posts", "Bearer " + postsOnly, http.StatusForbidden, "insufficient_scope"},
+		{"écriture sans portée posts", "POST", "posts", "Bearer " + readOnly, http.StatusForbidden, `scope="posts"`},
+		{"écriture avec portée posts", "POST", "posts", "Bearer " + postsOnly, http.StatusCreated, ""},
+		{"vote sans portée votes", "PUT", "posts/1/vote", "Bearer " + readOnly, http.StatusForbidden, `scope="votes"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *strings.Reader
+			switch tt.method {
+			case "POST":
+				body = strings.NewReader(`{"title": "Par jeton", "content": "Contenu"}`)
+			case "PUT":
+				body = strings.NewReader(`{"value": 1}`)
+			default:
+				body = strings.NewReader("")
+			}
+			req, _ := http.NewRequest(tt.method, srv.URL+apiPrefix+tt.path, body)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("statut %d, attendu %d", resp.StatusCode, tt.status)
+			}
+			if challenge := resp.Header.Get("WWW-Authenticate"); !strings.Contains(challenge, tt.challenge) || (tt.challenge == "") != (challenge == "") {
+				t.Errorf("WWW-Authenticate %q, attendu %q", challenge, tt.challenge)
+			}
+		})
+	}
+
+	token, err := store.Tokens.ByHash(context.Background(), hashToken(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.LastUsed.Valid {
+		t.Error("date de dernière utilisation non enregistrée")
+	}
+}
+
+func TestTokensHandler(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	aliceID := createUser(t, "alice")
+	createUser(t, "bob")
+	handler := &tokensHandler{}
+
+	w := httptest.NewRecorder()
+	form := url.Values{"action": {"create"}, "name": {"script"}, "scope_" + scopeRead: {"on"}, "days": {"30"}}
+	handler.ServeHTTP(w, withSession(t, postForm("/profil/tokens", form), "alice@example.com"))
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("création : statut %d, Cache-Control %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	tokens, err := store.Tokens.ForUser(context.Background(), aliceID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("jetons de alice : %+v, %v", tokens, err)
+	}
+	token := tokens[0]
+	if token.Name != "script" || !token.HasScope(scopeRead) || token.HasScope(scopePosts) {
+		t.Errorf("jeton créé %+v", token)
+	}
+	if days := time.Until(token.ExpiresAt).Hours() / 24; days < 29 || days > 30 {
+		t.Errorf("jeton valable %.1f jours, attendu 30", days)
+	}
+	// Le secret affiché une fois est celui dont la base garde l'empreinte
+	start := strings.Index(w.Body.String(), tokenPrefix)
+	if start < 0 {
+		t.Fatal("secret absent de la page")
+	}
+	secret := w.Body.String()[start:]
+	secret = secret[:strings.IndexAny(secret, "<\n ")]
+	if hashToken(secret) != token.Hash || strings.Contains(w.Body.String(), token.Hash) {
+		t.Error("secret affiché sans rapport avec l'empreinte enregistrée")
+	}
+
+	rejected := []url.Values{
+		{"action": {"create"}, "name": {""}, "scope_" + scopeRead: {"on"}, "days": {"30"}},
+		{"action": {"create"}, "name": {"sans portée"}, "days": {"30"}},
+		{"action": {"create"}, "name": {"durée libre"}, "scope_" + scopeRead: {"on"}, "days": {"3650"}},
+	}
+	for _, form := range rejected {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withSession(t, postForm("/profil/tokens", form), "alice@example.com"))
+		if w.Code == http.StatusOK {
+			t.Errorf("jeton %q accepté", form.Get("name"))
+		}
+	}
+
+	// Seul le titulaire révoque son jeton
+	revoke := url.Values{"action": {"revoke"}, "token_id": {strconv.Itoa(token.ID)}}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, withSession(t, postForm("/profil/tokens", revoke), "bob@example.com"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("révocation par bob : statut %d, attendu 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, withSession(t, postForm("/profil/tokens", revoke), "alice@example.com"))
+	assertRedirect(t, w, "/profil")
+	if tokens, _ := store.Tokens.ForUser(context.Background(), aliceID); len(tokens) != 1 || tokens[0].Active(time.Now()) {
+		t.Errorf("jeton toujours actif après révocation : %+v", tokens)
+	}
+}
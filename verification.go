@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	data "forum/Data"
+	"forum/config"
+	"forum/mail"
+)
+
+// Un compte inscrit reçoit un lien de confirmation : tant qu'il ne l'a pas suivi, il peut se
+// connecter mais pas publier. Le lien porte l'ID du compte et sa date d'expiration, signés
+// par HMAC avec l'adresse : il ne vaut plus rien si l'adresse change entre-temps.
+const (
+	verificationLinkTTL = 48 * time.Hour
+	verifyPath          = "/verify"
+)
+
+var (
+	mailer mail.Mailer
+	// Clé HMAC des liens envoyés par email
+	linkSecret []byte
+)
+
+// newMailer retourne le Mailer choisi par la configuration
+func newMailer(c *config.Config) (mail.Mailer, error) {
+	switch c.Mailer {
+	case "smtp":
+		return mail.NewSMTP(c.SMTPHost, c.SMTPPort, c.SMTPUsername, c.SMTPPassword, c.MailFrom), nil
+	case "file":
+		return mail.NewDirOutbox(c.MailDir, c.MailFrom)
+	default:
+		return mail.NewWriterOutbox(os.Stdout, c.MailFrom), nil
+	}
+}
+
+// newLinkSecret retourne la clé de secret_key, ou une clé aléatoire valable jusqu'à l'arrêt du serveur
+func newLinkSecret(c *config.Config) []byte {
+	if c.SecretKey != "" {
+		return []byte(c.SecretKey)
+	}
+	log.Println("secret_key absent : les liens envoyés par email ne seront plus valables après un redémarrage")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Erreur lors de la génération de la clé des liens:", err)
+	}
+	return b
+}
+
+// signLink signe l'objet du lien, le compte, son adresse et l'expiration
+func signLink(purpose string, userID int, email string, expires int64) string {
+	mac := hmac.New(sha256.New, linkSecret)
+	fmt.Fprintf(mac, "%s\n%d\n%s\n%d", purpose, userID, email, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mailURL préfixe le chemin d'un lien envoyé par email par public_url, jamais par l'hôte
+// de la requête : l'en-tête Host est choisi par le client, qui pourrait sinon faire partir
+// vers son propre serveur un lien signé reçu par la victime. Validate exige public_url avec
+// les mailers smtp et file ; le mailer stdout, réservé au développement, se rabat sur addr.
+func mailURL(path string) string {
+	if base := cfg.BaseURL(); base != "" {
+		return base + path
+	}
+	host, port, _ := net.SplitHostPort(cfg.Addr)
+	if host == "" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + path
+}
+
+// verificationURL retourne le lien de confirmation de l'adresse actuelle du compte
+func verificationURL(user *User) string {
+	expires := time.Now().Add(verificationLinkTTL).Unix()
+	q := url.Values{}
+	q.Set("user", strconv.Itoa(user.ID))
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", signLink("verify-email", user.ID, user.Email, expires))
+	return mailURL(verifyPath + "?" + q.Encode())
+}
+
+// sendVerificationEmail envoie le lien de confirmation à l'adresse du compte
+func sendVerificationEmail(r *http.Request, user *User) error {
+	return mailer.Send(r.Context(), &mail.Message{
+		To:      user.Email,
+		Subject: "Confirmez votre adresse email",
+		Body: "Bonjour " + user.Username + ",\n\n" +
+			"Pour confirmer votre adresse et pouvoir publier sur le forum, ouvrez ce lien :\n\n" +
+			verificationURL(user) + "\n\n" +
+			"Il expire dans " + strconv.Itoa(int(verificationLinkTTL.Hours())) + " heures. " +
+			"Si vous n'êtes pas à l'origine de cette inscription, ignorez ce message.\n",
+	})
+}
+
+// requireVerified refuse la publication à un compte dont l'adresse n'est pas confirmée
+func requireVerified(w http.ResponseWriter, r *http.Request, user *User) bool {
+	if user.EmailVerified {
+		return true
+	}
+	if isAPIRequest(r) {
+		apiError(w, http.StatusForbidden, "email_unverified", "Confirmez votre adresse email avant de publier")
+		return false
+	}
+	setErrorCookie(w, "Confirmez votre adresse email avant de publier : le lien vous a ete envoye, vous pouvez le redemander depuis votre profil")
+	http.Redirect(w, r, "/profil", http.StatusSeeOther)
+	return false
+}
+
+type VerifyPageData struct {
+	Verified bool
+	Message  string
+}
+
+// verifyEmailHandler confirme l'adresse d'un compte depuis le lien envoyé par email
+type verifyEmailHandler struct{}
+
+func (h *verifyEmailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	err := verifyEmail(r.Context(), r.URL.Query())
+	if err != nil && !errors.Is(err, errInvalidLink) {
+		http.Error(w, "Erreur lors de la confirmation de l'adresse", http.StatusInternalServerError)
+		log.Println("Erreur lors de la confirmation de l'adresse:", err)
+		return
+	}
+	page := VerifyPageData{Verified: err == nil, Message: "Votre adresse email est confirmée : vous pouvez publier."}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		page.Message = "Ce lien de confirmation est invalide ou a expiré. Demandez-en un nouveau depuis votre profil."
+	}
+	renderTemplate(w, r, "verify.html", page)
+}
+
+var errInvalidLink = errors.New("lien invalide ou expiré")
+
+func verifyEmail(ctx context.Context, q url.Values) error {
+	userID, err := strconv.Atoi(q.Get("user"))
+	if err != nil {
+		return errInvalidLink
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return errInvalidLink
+	}
+	user, err := store.Users.ByID(ctx, userID)
+	if errors.Is(err, data.ErrNotFound) {
+		return errInvalidLink
+	}
+	if err != nil {
+		return err
+	}
+	expected := signLink("verify-email", user.ID, user.Email, expires)
+	if !hmac.Equal([]byte(q.Get("signature")), []byte(expected)) {
+		return errInvalidLink
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	if err := store.Users.VerifyEmail(ctx, user.ID, user.Email); err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			return errInvalidLink
+		}
+		return err
+	}
+	return nil
+}
+
+// resendVerificationHandler renvoie le lien de confirmation à l'utilisateur connecté
+type resendVerificationHandler struct{}
+
+func (h *resendVerificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	user, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if user.EmailVerified {
+		http.Redirect(w, r, "/profil", http.StatusSeeOther)
+		return
+	}
+	if err := sendVerificationEmail(r, user); err != nil {
+		log.Println("Erreur lors de l'envoi de l'email de confirmation:", err)
+		setErrorCookie(w, "Erreur lors de l'envoi de l'email, reessayez plus tard")
+		http.Redirect(w, r, "/profil", http.StatusSeeOther)
+		return
+	}
+	setCookie(w, "error", "Un nouveau lien de confirmation vous a ete envoye")
+	http.Redirect(w, r, "/profil", http.StatusSeeOther)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"forum/mail"
+)
+
+// testOutbox garde les emails envoyés ; certains partent en arrière-plan
+type testOutbox struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *testOutbox) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *testOutbox) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// useMailer remplace l'envoi des emails par une boîte d'envoi en mémoire, avec une clé de liens fixe
+func useMailer(t *testing.T) *testOutbox {
+	t.Helper()
+	outbox := &testOutbox{}
+	previousMailer, previousSecret := mailer, linkSecret
+	mailer = mail.NewWriterOutbox(outbox, "forum@localhost")
+	linkSecret = []byte("une-clé-de-test-de-trente-deux-octets")
+	t.Cleanup(func() { mailer, linkSecret = previousMailer, previousSecret })
+	return outbox
+}
+
+// verifyUser confirme l'adresse d'un compte de createUser, qui peut alors publier
+func verifyUser(t *testing.T, userID int) {
+	t.Helper()
+	if _, err := testDB.Exec("UPDATE utilisateurs SET email_verified = 1 WHERE id = ?", userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var mailLink = regexp.MustCompile(`https?://\S+`)
+
+// lastLink retourne le dernier lien envoyé par email, en attendant un envoi en arrière-plan
+func lastLink(t *testing.T, outbox *testOutbox) string {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if links := mailLink.FindAllString(outbox.String(), -1); len(links) > 0 {
+			return links[len(links)-1]
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("aucun lien envoyé")
+		}
+	}
+}
+
+// getVerify suit un lien de confirmation et retourne le statut de la page
+func getVerify(t *testing.T, link string) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	(&verifyEmailHandler{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	return w.Code
+}
+
+func TestVerificationLink(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	useConfig(t).PublicURL = "https://forum.example/"
+	outbox := useMailer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	alice, err := store.Users.ByID(ctx, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// L'hôte de la requête, choisi par le client, n'entre pas dans le lien
+	r := httptest.NewRequest(http.MethodPost, "/verify/resend", nil)
+	r.Host = "attaquant.example"
+	if err := sendVerificationEmail(r, alice); err != nil {
+		t.Fatal(err)
+	}
+	link := lastLink(t, outbox)
+	if !strings.HasPrefix(link, "https://forum.example"+verifyPath+"?") {
+		t.Fatalf("lien %q hors de public_url", link)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := u.Query()
+	tampered.Set("user", strconv.Itoa(createUser(t, "bob")))
+	expired := u.Query()
+	expired.Set("expires", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+	for name, q := range map[string]url.Values{"compte modifié": tampered, "lien expiré": expired} {
+		if code := getVerify(t, verifyPath+"?"+q.Encode()); code != http.StatusBadRequest {
+			t.Errorf("%s : statut %d, attendu 400", name, code)
+		}
+	}
+
+	if code := getVerify(t, u.RequestURI()); code != http.StatusOK {
+		t.Fatalf("statut %d, attendu 200", code)
+	}
+	if alice, err = store.Users.ByID(ctx, aliceID); err != nil || !alice.EmailVerified {
+		t.Fatalf("adresse non confirmée : %+v, %v", alice, err)
+	}
+	// Le lien reste valable une fois suivi, sans effet
+	if code := getVerify(t, u.RequestURI()); code != http.StatusOK {
+		t.Errorf("second passage : statut %d, attendu 200", code)
+	}
+}
+
+func TestVerificationLinkAfterEmailChange(t *testing.T) {
+	openTestDatabase(t)
+	useTemplates(t)
+	useConfig(t).PublicURL = "https://forum.example"
+	outbox := useMailer(t)
+	ctx := context.Background()
+	aliceID := createUser(t, "alice")
+	alice, err := store.Users.ByID(ctx, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendVerificationEmail(httptest.NewRequest(http.MethodGet, "/", nil), alice); err != nil {
+		t.Fatal(err)
+	}
+	link, _ := url.Parse(lastLink(t, outbox))
+
+	// Le lien signé pour l'ancienne adresse ne confirme pas la nouvelle
+	if _, err := testDB.Exec("UPDATE utilisateurs SET email = ? WHERE id = ?", "alice@nouveau.example", aliceID); err != nil {
+		t.Fatal(err)
+	}
+	if code := getVerify(t, link.RequestURI()); code != http.StatusBadRequest {
+		t.Errorf("statut %d, attendu 400", code)
+	}
+	if alice, _ := store.Users.ByID(ctx, aliceID); alice.EmailVerified {
+		t.Error("nouvelle adresse confirmée par l'ancien lien")
+	}
+}
+
+func TestMailURL(t *testing.T) {
+	c := useConfig(t)
+	c.PublicURL = "https://forum.example/"
+	if got := mailURL(verifyPath); got != "https://forum.example/verify" {
+		t.Errorf("avec public_url : %q", got)
+	}
+	// Sans public_url, possible seulement avec le mailer stdout, l'adresse d'écoute sert de base
+	c.PublicURL, c.Addr = "", ":6969"
+	if got := mailURL(verifyPath); got != "http://localhost:6969/verify" {
+		t.Errorf("sans public_url : %q", got)
+	}
+}
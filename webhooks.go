@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	data "forum/Data"
+)
+
+// Les webhooks envoient en POST un JSON {"event", "created_at", "data"} aux URL déclarées
+// par les administrateurs. Le corps est signé par HMAC-SHA256 avec le secret du webhook,
+// dans l'en-tête X-Forum-Signature: sha256=<hex>. Une livraison refusée est retentée avec
+// un délai doublé à chaque échec, puis abandonnée ; chacune reste dans le journal.
+const (
+	eventPostCreated    = "post.created"
+	eventCommentCreated = "comment.created"
+	eventUserRegistered = "user.registered"
+	eventReportFiled    = "report.filed"
+)
+
+type webhookEvent struct {
+	Name  string
+	Label string
+}
+
+var webhookEvents = []webhookEvent{
+	{eventPostCreated, "Nouveau sujet"},
+	{eventCommentCreated, "Nouveau commentaire"},
+	{eventUserRegistered, "Nouvelle inscription"},
+	{eventReportFiled, "Nouveau signalement"},
+}
+
+const (
+	webhookPollInterval = 5 * time.Second
+	webhookTimeout      = 10 * time.Second
+	webhookBatchSize    = 20
+	// Délai avant la deuxième tentative, doublé ensuite à chaque échec
+	webhookRetryDelay  = 30 * time.Second
+	webhookMaxAttempts = 8
+	// Longueur maximale de la réponse gardée dans le journal après un échec
+	webhookMaxErrorLength = 500
+	webhookLogSize        = 50
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+type webhookPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// emitEvent programme la livraison de l'événement aux webhooks actifs qui y sont abonnés.
+// Une erreur est journalisée sans faire échouer la requête qui a produit l'événement.
+func emitEvent(ctx context.Context, event string, v interface{}) {
+	hooks, err := store.Webhooks.List(ctx)
+	if err != nil {
+		log.Println("Erreur lors de la récupération des webhooks:", err)
+		return
+	}
+	var payload []byte
+	for _, hook := range hooks {
+		if !hook.Active || !hook.Subscribed(event) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(webhookPayload{Event: event, CreatedAt: time.Now().UTC(), Data: v})
+			if err != nil {
+				log.Println("Erreur lors de l'encodage de l'événement:", err)
+				return
+			}
+		}
+		if _, err := store.Webhooks.Enqueue(ctx, hook.ID, event, string(payload)); err != nil {
+			log.Println("Erreur lors de la programmation d'une livraison de webhook:", err)
+		}
+	}
+}
+
+// emitUserRegistered annonce une inscription, sans l'email du compte
+func emitUserRegistered(ctx context.Context, userID int) {
+	user, err := store.Users.ByID(ctx, userID)
+	if err != nil {
+		log.Println("Erreur lors de la récupération de l'utilisateur:", err)
+		return
+	}
+	emitEvent(ctx, eventUserRegistered, newAPIProfile(user, false))
+}
+
+// emitPostCreated annonce un nouveau sujet, sauf si son auteur est shadowbanné
+func emitPostCreated(ctx context.Context, author *User, postID int) {
+	if author.Shadowbanned {
+		return
+	}
+	post, err := store.Posts.Get(ctx, postID, author.ID)
+	if err != nil {
+		log.Println("Erreur lors de la récupération du post:", err)
+		return
+	}
+	emitEvent(ctx, eventPostCreated, newAPIPost(post))
+}
+
+// emitCommentCreated annonce un nouveau commentaire, sauf si son auteur est shadowbanné
+func emitCommentCreated(ctx context.Context, author *User, comment *Comment) {
+	if author.Shadowbanned {
+		return
+	}
+	emitEvent(ctx, eventCommentCreated, newAPIComment(comment))
+}
+
+// signWebhook retourne la signature du corps, telle qu'envoyée dans X-Forum-Signature
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryBackoff retourne le délai avant la tentative suivant la tentative attempt, en doublant
+// base à chaque échec
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	return base << (attempt - 1)
+}
+
+// deliverWebhooks livre périodiquement les événements en attente
+func deliverWebhooks() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deliverDueWebhooks(context.Background())
+	}
+}
+
+func deliverDueWebhooks(ctx context.Context) {
+	due, err := store.Webhooks.Due(ctx, time.Now(), webhookBatchSize)
+	if err != nil {
+		log.Println("Erreur lors de la récupération des livraisons de webhooks:", err)
+		return
+	}
+	for i := range due {
+		d := &due[i]
+		hook, err := store.Webhooks.Get(ctx, d.WebhookID)
+		if err != nil {
+			log.Println("Erreur lors de la récupération du webhook:", err)
+			continue
+		}
+		attemptDelivery(ctx, hook, d)
+		if err := store.Webhooks.Record(ctx, d); err != nil {
+			log.Println("Erreur lors de l'enregistrement d'une livraison de webhook:", err)
+		}
+	}
+}
+
+// attemptDelivery envoie la livraison et met à jour son état, son compteur et sa prochaine tentative
+func attemptDelivery(ctx context.Context, hook *data.Webhook, d *data.WebhookDelivery) {
+	now := time.Now()
+	d.Attempts++
+	d.StatusCode = sql.NullInt64{}
+	d.Error = ""
+
+	status, err := sendWebhook(ctx, hook, d)
+	if status != 0 {
+		d.StatusCode = sql.NullInt64{Int64: int64(status), Valid: true}
+	}
+	if err == nil {
+		d.Status = data.DeliveryDelivered
+		d.Delivered = sql.NullTime{Time: now, Valid: true}
+		d.NextAttempt = sql.NullTime{}
+		return
+	}
+	d.Error = err.Error()
+	if d.Attempts >= webhookMaxAttempts {
+		d.Status = data.DeliveryFailed
+		d.NextAttempt = sql.NullTime{}
+		log.Printf("Livraison %d du webhook %d abandonnée après %d tentatives: %v\n", d.ID, hook.ID, d.Attempts, err)
+		return
+	}
+	d.NextAttempt = sql.NullTime{Time: now.Add(retryBackoff(webhookRetryDelay, d.Attempts)), Valid: true}
+}
+
+// sendWebhook poste la charge utile signée ; toute réponse hors 2xx est un échec
+func sendWebhook(ctx context.Context, hook *data.Webhook, d *data.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "forum-webhooks")
+	req.Header.Set("X-Forum-Event", d.Event)
+	req.Header.Set("X-Forum-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Forum-Signature", signWebhook(hook.Secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxErrorLength))
+		return resp.StatusCode, nil
+	}
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorLength))
+	message := resp.Status
+	if s := strings.TrimSpace(string(excerpt)); s != "" {
+		message += " : " + s
+	}
+	return resp.StatusCode, errors.New(message)
+}
+
+// newWebhookSecret génère le secret partagé qui signe les livraisons
+func newWebhookSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Erreur lors de la génération d'un secret de webhook:", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validWebhookURL n'accepte que les URL absolues en http ou https
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+type WebhooksPageData struct {
+	Webhooks []data.Webhook
+	Events   []webhookEvent
+	// Webhook dont le journal est affiché, avec ses dernières livraisons
+	Selected   *data.Webhook
+	Deliveries []data.WebhookDelivery
+}
+
+// webhooksHandler permet aux administrateurs de déclarer les webhooks, de consulter le
+// journal des livraisons et de relancer une livraison
+type webhooksHandler struct{}
+
+func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	admin, ok := sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if admin.Role != data.RoleAdmin {
+		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		h.update(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *webhooksHandler) list(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	page := WebhooksPageData{Events: webhookEvents}
+	var err error
+	page.Webhooks, err = store.Webhooks.List(ctx)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération des webhooks", http.StatusInternalServerError)
+		log.Println("Erreur lors de la récupération des webhooks:", err)
+		return
+	}
+	if idParam := r.URL.Query().Get("id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			http.Error(w, "Webhook non trouvé", http.StatusNotFound)
+			return
+		}
+		page.Selected, err = store.Webhooks.Get(ctx, id)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				http.Error(w, "Webhook non trouvé", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Erreur lors de la récupération du webhook", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération du webhook:", err)
+			return
+		}
+		page.Deliveries, err = store.Webhooks.Deliveries(ctx, id, webhookLogSize)
+		if err != nil {
+			http.Error(w, "Erreur lors de la récupération des livraisons", http.StatusInternalServerError)
+			log.Println("Erreur lors de la récupération des livraisons:", err)
+			return
+		}
+	}
+	renderTemplate(w, r, "webhooks.html", page)
+}
+
+func (h *webhooksHandler) update(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Erreur lors de la lecture du formulaire", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if r.FormValue("action") == "create" {
+		hookURL := strings.TrimSpace(r.FormValue("url"))
+		if !validWebhookURL(hookURL) {
+			setErrorCookie(w, "URL invalide : http:// ou https:// attendu")
+			http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+			return
+		}
+		hook := &data.Webhook{URL: hookURL, Secret: newWebhookSecret(), Active: true}
+		for _, e := range webhookEvents {
+			if r.Form.Has("event_" + e.Name) {
+				hook.Events = append(hook.Events, e.Name)
+			}
+		}
+		if len(hook.Events) == 0 {
+			setErrorCookie(w, "Choisissez au moins un evenement")
+			http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+			return
+		}
+		id, err := store.Webhooks.Create(ctx, hook)
+		if err != nil {
+			http.Error(w, "Erreur lors de la création du webhook", http.StatusInternalServerError)
+			log.Println("Erreur lors de la création du webhook:", err)
+			return
+		}
+		http.Redirect(w, r, webhookURL(id), http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("webhook_id"))
+	if err != nil {
+		http.Error(w, "Webhook non trouvé", http.StatusNotFound)
+		return
+	}
+	redirect := webhookURL(id)
+	switch r.FormValue("action") {
+	case "enable":
+		err = store.Webhooks.SetActive(ctx, id, true)
+	case "disable":
+		err = store.Webhooks.SetActive(ctx, id, false)
+	case "delete":
+		err = store.Webhooks.Delete(ctx, id)
+		redirect = "/admin/webhooks"
+	case "redeliver":
+		// La relance est une nouvelle livraison : le journal garde l'historique de l'originale
+		deliveryID, convErr := strconv.Atoi(r.FormValue("delivery_id"))
+		if convErr != nil {
+			err = data.ErrNotFound
+			break
+		}
+		var d *data.WebhookDelivery
+		d, err = store.Webhooks.Delivery(ctx, deliveryID)
+		if err == nil && d.WebhookID != id {
+			err = data.ErrNotFound
+		}
+		if err == nil {
+			_, err = store.Webhooks.Enqueue(ctx, d.WebhookID, d.Event, d.Payload)
+		}
+	default:
+		http.Error(w, "Action inconnue", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, data.ErrNotFound) {
+		http.Error(w, "Webhook non trouvé", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur lors de la mise à jour du webhook", http.StatusInternalServerError)
+		log.Println("Erreur lors de la mise à jour du webhook:", err)
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+func webhookURL(id int) string {
+	return fmt.Sprintf("/admin/webhooks?id=%d", id)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	data "forum/Data"
+)
+
+// webhookReceiver est un destinataire de webhooks qui garde chaque requête reçue et répond
+// les statuts de statuses dans l'ordre, puis 200
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+	rcv := &webhookReceiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		rcv.received = append(rcv.received, receivedWebhook{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		rcv.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *webhookReceiver) requests() []receivedWebhook {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]receivedWebhook(nil), rcv.received...)
+}
+
+// assertSigned vérifie la signature comme le ferait un destinataire, sans passer par signWebhook
+func assertSigned(t *testing.T, secret string, req receivedWebhook) {
+	t.Helper()
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get("X-Forum-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("signature %q, attendu %q", got, want)
+	}
+}
+
+// makeDue avance la prochaine tentative des livraisons en attente pour qu'elles soient dues
+func makeDue(t *testing.T, s *data.Store, webhookID int) {
+	t.Helper()
+	ctx := context.Background()
+	deliveries, err := s.Webhooks.Deliveries(ctx, webhookID, webhookLogSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range deliveries {
+		d := &deliveries[i]
+		if d.Status == data.DeliveryPending && d.NextAttempt.Valid {
+			d.NextAttempt.Time = time.Now().Add(-time.Second)
+			if err := s.Webhooks.Record(ctx, d); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 7: 32 * time.Minute} {
+		if got := retryBackoff(webhookRetryDelay, attempt); got != want {
+			t.Errorf("retryBackoff(%d) = %s, attendu %s", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookDeliveryRetriesAndRedelivery(t *testing.T) {
+	openTestDatabase(t)
+	s := store
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+
+	secret := newWebhookSecret()
+	hookID, err := s.Webhooks.Create(ctx, &data.Webhook{URL: rcv.URL, Secret: secret, Events: []string{eventPostCreated}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Un webhook d'un autre événement ne reçoit rien
+	otherRcv := newWebhookReceiver(t)
+	if _, err := s.Webhooks.Create(ctx, &data.Webhook{URL: otherRcv.URL, Secret: newWebhookSecret(), Events: []string{eventUserRegistered}, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	emitEvent(ctx, eventPostCreated, map[string]string{"title": "Bonjour"})
+
+	delivery := func() data.WebhookDelivery {
+		t.Helper()
+		deliveries, err := s.Webhooks.Deliveries(ctx, hookID, webhookLogSize)
+		if err != nil || len(deliveries) == 0 {
+			t.Fatalf("livraisons : %v, %v", deliveries, err)
+		}
+		return deliveries[0]
+	}
+
+	// Première tentative : refusée, retentée après webhookRetryDelay
+	before := time.Now()
+	deliverDueWebhooks(ctx)
+	reqs := rcv.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("%d requêtes reçues, attendu 1", len(reqs))
+	}
+	assertSigned(t, secret, reqs[0])
+	var payload webhookPayload
+	if err := json.Unmarshal(reqs[0].body, &payload); err != nil || payload.Event != eventPostCreated {
+		t.Errorf("charge utile %s : %v", reqs[0].body, err)
+	}
+	if reqs[0].header.Get("X-Forum-Event") != eventPostCreated || reqs[0].header.Get("Content-Type") != "application/json" {
+		t.Errorf("en-têtes : %v", reqs[0].header)
+	}
+	d := delivery()
+	if d.Status != data.DeliveryPending || d.Attempts != 1 || d.StatusCode.Int64 != 500 || d.Error == "" {
+		t.Errorf("après un échec : %+v", d)
+	}
+	if wait := d.NextAttempt.Time.Sub(before); wait < webhookRetryDelay-time.Second || wait > webhookRetryDelay+5*time.Second {
+		t.Errorf("nouvelle tentative dans %s, attendu %s", wait, webhookRetryDelay)
+	}
+
+	// Pas de nouvelle tentative avant l'échéance
+	deliverDueWebhooks(ctx)
+	if n := len(rcv.requests()); n != 1 {
+		t.Fatalf("%d requêtes reçues avant l'échéance, attendu 1", n)
+	}
+
+	// Deuxième échec : le délai double
+	makeDue(t, s, hookID)
+	before = time.Now()
+	deliverDueWebhooks(ctx)
+	d = delivery()
+	if d.Attempts != 2 || d.StatusCode.Int64 != 503 {
+		t.Errorf("après deux échecs : %+v", d)
+	}
+	if wait := d.NextAttempt.Time.Sub(before); wait < 2*webhookRetryDelay-time.Second || wait > 2*webhookRetryDelay+5*time.Second {
+		t.Errorf("nouvelle tentative dans %s, attendu %s", wait, 2*webhookRetryDelay)
+	}
+
+	// Troisième tentative acceptée, avec le même corps et la même signature
+	makeDue(t, s, hookID)
+	deliverDueWebhooks(ctx)
+	reqs = rcv.requests()
+	if len(reqs) != 3 || string(reqs[2].body) != string(reqs[0].body) {
+		t.Fatalf("%d requêtes reçues, attendu 3 au même corps", len(reqs))
+	}
+	assertSigned(t, secret, reqs[2])
+	d = delivery()
+	if d.Status != data.DeliveryDelivered || d.Attempts != 3 || !d.Delivered.Valid || d.NextAttempt.Valid || d.Error != "" {
+		t.Errorf("après la livraison : %+v", d)
+	}
+	if n := len(otherRcv.requests()); n != 0 {
+		t.Errorf("%d requêtes reçues par le webhook non abonné", n)
+	}
+
+	// Relance manuelle par un administrateur : nouvelle livraison du même corps
+	setRole(t, createUser(t, "admin"), data.RoleAdmin)
+	redeliver := func(webhookID, deliveryID int) *httptest.ResponseRecorder {
+		r := postForm("/admin/webhooks", url.Values{"action": {"redeliver"}, "webhook_id": {strconv.Itoa(webhookID)}, "delivery_id": {strconv.Itoa(deliveryID)}})
+		w := httptest.NewRecorder()
+		(&webhooksHandler{}).ServeHTTP(w, withSession(t, r, "admin@example.com"))
+		return w
+	}
+	if w := redeliver(hookID+1, d.ID); w.Code != http.StatusNotFound {
+		t.Errorf("relance par un autre webhook : statut %d, attendu 404", w.Code)
+	}
+	assertRedirect(t, redeliver(hookID, d.ID), webhookURL(hookID))
+
+	deliverDueWebhooks(ctx)
+	reqs = rcv.requests()
+	if len(reqs) != 4 || string(reqs[3].body) != string(reqs[0].body) {
+		t.Fatalf("%d requêtes reçues, attendu 4 au même corps", len(reqs))
+	}
+	assertSigned(t, secret, reqs[3])
+	redelivered := delivery()
+	if redelivered.ID == d.ID || reqs[3].header.Get("X-Forum-Delivery") != strconv.Itoa(redelivered.ID) {
+		t.Errorf("relance livrée sous l'ID %s, attendu une nouvelle livraison", reqs[3].header.Get("X-Forum-Delivery"))
+	}
+	if redelivered.Status != data.DeliveryDelivered || redelivered.Attempts != 1 {
+		t.Errorf("relance : %+v", redelivered)
+	}
+	deliveries, _ := s.Webhooks.Deliveries(ctx, hookID, webhookLogSize)
+	if len(deliveries) != 2 {
+		t.Errorf("%d livraisons au journal, attendu l'originale et sa relance", len(deliveries))
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	rcv := newWebhookReceiver(t, http.StatusBadGateway)
+	hook := &data.Webhook{ID: 1, URL: rcv.URL, Secret: "secret"}
+	d := &data.WebhookDelivery{ID: 1, WebhookID: 1, Event: eventPostCreated, Payload: "{}", Status: data.DeliveryPending, Attempts: webhookMaxAttempts - 1}
+	attemptDelivery(context.Background(), hook, d)
+	if d.Status != data.DeliveryFailed || d.Attempts != webhookMaxAttempts || d.NextAttempt.Valid || d.StatusCode.Int64 != 502 {
+		t.Errorf("après la dernière tentative : %+v", d)
+	}
+}